@@ -0,0 +1,326 @@
+// Package access keeps who may do what on each board: members with a role and
+// share links that grant a role to whoever holds them until they expire or are
+// revoked. A board without members is open and everyone is its owner, which is
+// how boards created before roles existed, or created anonymously, behave.
+package access
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"test1/storage"
+)
+
+// Role is what a caller may do on a board. Each role includes the ones below it.
+type Role string
+
+const (
+	// None grants nothing; the board is not visible.
+	None Role = ""
+	// Viewer can read the board and follow its events.
+	Viewer Role = "viewer"
+	// Commenter can also add comments.
+	Commenter Role = "commenter"
+	// Editor can change anything on the board.
+	Editor Role = "editor"
+	// Owner can also manage members and share links and delete the board.
+	Owner Role = "owner"
+)
+
+var ranks = map[Role]int{None: 0, Viewer: 1, Commenter: 2, Editor: 3, Owner: 4}
+
+// ParseRole validates a role name.
+func ParseRole(s string) (Role, bool) {
+	r := Role(s)
+	_, ok := ranks[r]
+	return r, ok && r != None
+}
+
+// Allows reports whether r includes min.
+func (r Role) Allows(min Role) bool {
+	return ranks[r] >= ranks[min]
+}
+
+var (
+	// ErrNotFound is returned for unknown members and share links.
+	ErrNotFound = errors.New("not found")
+	// ErrLastOwner is returned when a change would leave a board without an owner.
+	ErrLastOwner = errors.New("a board needs at least one owner")
+	// ErrOwnerLink is returned for share links granting ownership, which are not allowed.
+	ErrOwnerLink = errors.New("share links cannot grant the owner role")
+	// ErrOpenBoard is returned when sharing an open board, which everyone can already use.
+	ErrOpenBoard = errors.New("the board is open to everyone; add an owner before sharing it")
+)
+
+// Member is a participant or user with a role on a board.
+type Member struct {
+	ID   string `json:"id"`
+	Role Role   `json:"role"`
+}
+
+// Link describes a share link. Its secret is only returned when it is created.
+type Link struct {
+	ID        string     `json:"id"`
+	Role      Role       `json:"role"`
+	CreatedBy string     `json:"createdBy,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+type linkRecord struct {
+	Link
+	Hash string `json:"hash"`
+}
+
+type boardACL struct {
+	Members map[string]Role `json:"members"`
+	Links   []*linkRecord   `json:"links,omitempty"`
+}
+
+// Store holds the access lists of all boards, in memory and, when given a
+// path, in a JSON file rewritten on every change.
+type Store struct {
+	mu     sync.RWMutex
+	path   string
+	now    func() time.Time
+	boards map[string]*boardACL
+}
+
+// NewStore loads the store from path when it exists. An empty path keeps access lists in memory.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, now: time.Now, boards: make(map[string]*boardACL)}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read access lists: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.boards); err != nil {
+		return nil, fmt.Errorf("decode access lists: %w", err)
+	}
+	return s, nil
+}
+
+// Role returns the role of principal on the board, raised to the role of the
+// share link whose secret is given, if it is valid.
+func (s *Store) Role(boardID, principal, linkSecret string) Role {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	acl := s.boards[boardID]
+	if acl == nil || len(acl.Members) == 0 {
+		return Owner
+	}
+	role := None
+	if principal != "" {
+		role = acl.Members[principal]
+	}
+	if linkSecret != "" {
+		hash := hashSecret(linkSecret)
+		now := s.now()
+		for _, l := range acl.Links {
+			if l.Hash == hash && (l.ExpiresAt == nil || now.Before(*l.ExpiresAt)) && !role.Allows(l.Role) {
+				role = l.Role
+			}
+		}
+	}
+	return role
+}
+
+// Open reports whether the board has no members and so is open to everyone.
+func (s *Store) Open(boardID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	acl := s.boards[boardID]
+	return acl == nil || len(acl.Members) == 0
+}
+
+// Members lists the board's members, owners first.
+func (s *Store) Members(boardID string) []Member {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	members := []Member{}
+	if acl := s.boards[boardID]; acl != nil {
+		for id, role := range acl.Members {
+			members = append(members, Member{ID: id, Role: role})
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Role != members[j].Role {
+			return ranks[members[i].Role] > ranks[members[j].Role]
+		}
+		return members[i].ID < members[j].ID
+	})
+	return members
+}
+
+// SetMember gives principal a role on the board. The first member of an open
+// board must be an owner, and the last owner cannot be demoted.
+func (s *Store) SetMember(boardID, principal string, role Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acl := s.boards[boardID]
+	if acl == nil {
+		acl = &boardACL{Members: make(map[string]Role)}
+	}
+	if len(acl.Members) == 0 && role != Owner {
+		return ErrLastOwner
+	}
+	if acl.Members[principal] == Owner && role != Owner && owners(acl) == 1 {
+		return ErrLastOwner
+	}
+	previous, had := acl.Members[principal]
+	acl.Members[principal] = role
+	s.boards[boardID] = acl
+	if err := s.saveLocked(); err != nil {
+		if had {
+			acl.Members[principal] = previous
+		} else {
+			delete(acl.Members, principal)
+		}
+		return err
+	}
+	return nil
+}
+
+// RemoveMember takes principal's role on the board away.
+func (s *Store) RemoveMember(boardID, principal string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acl := s.boards[boardID]
+	if acl == nil {
+		return ErrNotFound
+	}
+	role, ok := acl.Members[principal]
+	if !ok {
+		return ErrNotFound
+	}
+	if role == Owner && owners(acl) == 1 {
+		return ErrLastOwner
+	}
+	delete(acl.Members, principal)
+	if err := s.saveLocked(); err != nil {
+		acl.Members[principal] = role
+		return err
+	}
+	return nil
+}
+
+// CreateLink issues a share link granting role. A zero ttl never expires.
+func (s *Store) CreateLink(boardID string, role Role, createdBy string, ttl time.Duration) (Link, string, error) {
+	if role == Owner {
+		return Link{}, "", ErrOwnerLink
+	}
+	secret := randomSecret()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acl := s.boards[boardID]
+	if acl == nil || len(acl.Members) == 0 {
+		return Link{}, "", ErrOpenBoard
+	}
+	l := &linkRecord{Link: Link{ID: storage.NewID(), Role: role, CreatedBy: createdBy, CreatedAt: s.now().UTC()}, Hash: hashSecret(secret)}
+	if ttl > 0 {
+		expires := l.CreatedAt.Add(ttl)
+		l.ExpiresAt = &expires
+	}
+	acl.Links = append(acl.Links, l)
+	if err := s.saveLocked(); err != nil {
+		acl.Links = acl.Links[:len(acl.Links)-1]
+		return Link{}, "", err
+	}
+	return l.Link, secret, nil
+}
+
+// Links lists the board's share links, oldest first. Expired links are listed
+// until they are revoked so owners can see why a link stopped working.
+func (s *Store) Links(boardID string) []Link {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	links := []Link{}
+	if acl := s.boards[boardID]; acl != nil {
+		for _, l := range acl.Links {
+			links = append(links, l.Link)
+		}
+	}
+	return links
+}
+
+// RevokeLink deletes a share link; holders lose the role it granted.
+func (s *Store) RevokeLink(boardID, linkID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acl := s.boards[boardID]
+	if acl == nil {
+		return ErrNotFound
+	}
+	for i, l := range acl.Links {
+		if l.ID == linkID {
+			links := acl.Links
+			acl.Links = append(append([]*linkRecord(nil), links[:i]...), links[i+1:]...)
+			if err := s.saveLocked(); err != nil {
+				acl.Links = links
+				return err
+			}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// Forget drops the access list of a deleted board.
+func (s *Store) Forget(boardID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.boards[boardID]; !ok {
+		return nil
+	}
+	delete(s.boards, boardID)
+	return s.saveLocked()
+}
+
+func owners(acl *boardACL) int {
+	n := 0
+	for _, role := range acl.Members {
+		if role == Owner {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Store) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.boards, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode access lists: %w", err)
+	}
+	if err := storage.WriteFileAtomic(s.path, data, 0o600); err != nil {
+		return fmt.Errorf("write access lists: %w", err)
+	}
+	return nil
+}
+
+func randomSecret() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
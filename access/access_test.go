@@ -0,0 +1,97 @@
+package access
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRolesAndOwnership(t *testing.T) {
+	s, err := NewStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Role("b", "anyone", ""); got != Owner {
+		t.Fatalf("expected an open board to let anyone own it, got %q", got)
+	}
+	if err := s.SetMember("b", "bob", Editor); !errors.Is(err, ErrLastOwner) {
+		t.Fatalf("expected the first member to have to be an owner, got %v", err)
+	}
+	if err := s.SetMember("b", "alice", Owner); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetMember("b", "bob", Commenter); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Role("b", "anyone", ""); got != None {
+		t.Fatalf("expected non-members to lose access once the board has an owner, got %q", got)
+	}
+	if !s.Role("b", "bob", "").Allows(Viewer) || s.Role("b", "bob", "").Allows(Editor) {
+		t.Fatal("expected a commenter to be able to view but not edit")
+	}
+
+	if err := s.SetMember("b", "alice", Editor); !errors.Is(err, ErrLastOwner) {
+		t.Fatalf("expected the last owner to stay, got %v", err)
+	}
+	if err := s.RemoveMember("b", "alice"); !errors.Is(err, ErrLastOwner) {
+		t.Fatalf("expected the last owner not to be removable, got %v", err)
+	}
+	members := s.Members("b")
+	if len(members) != 2 || members[0].ID != "alice" || members[1].Role != Commenter {
+		t.Fatalf("expected owners first, got %+v", members)
+	}
+}
+
+func TestShareLinksExpireAndRevoke(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.json")
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.CreateLink("b", Viewer, "", 0); !errors.Is(err, ErrOpenBoard) {
+		t.Fatalf("expected open boards not to be shareable, got %v", err)
+	}
+	s.SetMember("b", "alice", Owner)
+	if _, _, err := s.CreateLink("b", Owner, "alice", 0); !errors.Is(err, ErrOwnerLink) {
+		t.Fatalf("expected owner links to be refused, got %v", err)
+	}
+	link, secret, err := s.CreateLink("b", Editor, "alice", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetMember("b", "vic", Viewer)
+
+	// Links and members survive a restart.
+	if s, err = NewStore(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Role("b", "", secret); got != Editor {
+		t.Fatalf("expected the link to grant editor, got %q", got)
+	}
+	if got := s.Role("b", "vic", secret); got != Editor {
+		t.Fatalf("expected the link to raise a viewer, got %q", got)
+	}
+	if got := s.Role("b", "alice", secret); got != Owner {
+		t.Fatalf("expected the link not to lower an owner, got %q", got)
+	}
+	if got := s.Role("other", "", secret); got != Owner {
+		t.Fatalf("expected the open board to be unaffected, got %q", got)
+	}
+
+	s.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if got := s.Role("b", "", secret); got != None {
+		t.Fatalf("expected the link to expire, got %q", got)
+	}
+	s.now = time.Now
+
+	if err := s.RevokeLink("b", link.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Role("b", "vic", secret); got != Viewer {
+		t.Fatalf("expected a revoked link to grant nothing, got %q", got)
+	}
+	if err := s.RevokeLink("b", link.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected revoking twice to report not found, got %v", err)
+	}
+}
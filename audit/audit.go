@@ -0,0 +1,258 @@
+// Package audit keeps an append-only record of who changed what: every board
+// write, access change and workspace change, with the acting participant or
+// user, the board and the elements it touched. Entries are never changed or
+// removed, not even when the board they describe is purged.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by Append after Close.
+var ErrClosed = errors.New("audit log closed")
+
+// Entry is one recorded change.
+type Entry struct {
+	// Seq numbers entries from 1 in the order they were recorded.
+	Seq      int64     `json:"seq"`
+	At       time.Time `json:"at"`
+	Actor    string    `json:"actor,omitempty"`
+	Action   string    `json:"action"`
+	BoardID  string    `json:"boardId,omitempty"`
+	Revision int64     `json:"revision,omitempty"`
+	// Elements are the IDs of the board items the change added, changed or removed.
+	Elements []string `json:"elements,omitempty"`
+	// Details carries what else identifies the change, such as the member and
+	// role of an access change or the workspace of a folder.
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Query selects entries. Zero fields match everything.
+type Query struct {
+	BoardID string
+	Actor   string
+	// Action matches actions starting with it, so "member." selects all member changes.
+	Action  string
+	Element string
+	Since   time.Time
+	Until   time.Time
+	// After skips entries up to and including this sequence number.
+	After int64
+	// Limit caps the number of entries returned by Query; Export ignores it.
+	Limit int
+}
+
+func (q Query) matches(e Entry) bool {
+	switch {
+	case e.Seq <= q.After:
+		return false
+	case q.BoardID != "" && e.BoardID != q.BoardID:
+		return false
+	case q.Actor != "" && e.Actor != q.Actor:
+		return false
+	case q.Action != "" && !strings.HasPrefix(e.Action, q.Action):
+		return false
+	case !q.Since.IsZero() && e.At.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !e.At.Before(q.Until):
+		return false
+	case q.Element != "":
+		for _, id := range e.Elements {
+			if id == q.Element {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Log holds the entries in memory and, when opened with a path, appends each
+// one to a JSON Lines file that is synced before Append returns.
+type Log struct {
+	mu   sync.RWMutex
+	file logFile
+	// size is the length of the file up to the end of the last entry.
+	size    int64
+	now     func() time.Time
+	entries []Entry
+	closed  bool
+	// torn is set when a failed append could not be cut back out of the
+	// file; appending after it would bury the torn line, so appends stop.
+	torn error
+}
+
+// logFile is the part of *os.File the log writes through.
+type logFile interface {
+	io.WriteSeeker
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// Open loads the log at path, creating it if needed. A torn final line left by
+// a crash is cut off. An empty path keeps the log in memory only.
+func Open(path string) (*Log, error) {
+	l := &Log{now: time.Now}
+	if path == "" {
+		return l, nil
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	if err := l.load(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	l.file, l.size = file, size
+	return l, nil
+}
+
+func (l *Log) load(file *os.File) error {
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var e Entry
+			if err := json.Unmarshal(line, &e); err != nil || !bytes.HasSuffix(line, []byte("\n")) {
+				if _, peekErr := reader.Peek(1); peekErr != io.EOF {
+					return fmt.Errorf("corrupt audit entry at offset %d", offset)
+				}
+				if err := file.Truncate(offset); err != nil {
+					return fmt.Errorf("truncate audit log: %w", err)
+				}
+				return nil
+			}
+			offset += int64(len(line))
+			l.entries = append(l.entries, e)
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return fmt.Errorf("read audit log: %w", readErr)
+		}
+	}
+}
+
+// Append records e, stamping its sequence number and, unless set, its time.
+func (l *Log) Append(e Entry) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return Entry{}, ErrClosed
+	}
+	if l.torn != nil {
+		return Entry{}, l.torn
+	}
+	e.Seq = 1
+	if len(l.entries) > 0 {
+		e.Seq = l.entries[len(l.entries)-1].Seq + 1
+	}
+	if e.At.IsZero() {
+		e.At = l.now().UTC()
+	}
+	if l.file != nil {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return Entry{}, fmt.Errorf("encode audit entry: %w", err)
+		}
+		line = append(line, '\n')
+		if _, err := l.file.Write(line); err != nil {
+			return Entry{}, l.rewindLocked(fmt.Errorf("write audit log: %w", err))
+		}
+		if err := l.file.Sync(); err != nil {
+			return Entry{}, l.rewindLocked(fmt.Errorf("sync audit log: %w", err))
+		}
+		l.size += int64(len(line))
+	}
+	l.entries = append(l.entries, e)
+	return e, nil
+}
+
+// rewindLocked cuts the file back to the end of the last entry after a failed
+// append, so a partly written line cannot end up in the middle of the log
+// once later entries follow it. If that fails too, the log takes no more
+// entries.
+func (l *Log) rewindLocked(cause error) error {
+	if err := l.file.Truncate(l.size); err != nil {
+		l.torn = fmt.Errorf("%w (truncate audit log: %v)", cause, err)
+		return l.torn
+	}
+	if _, err := l.file.Seek(l.size, io.SeekStart); err != nil {
+		l.torn = fmt.Errorf("%w (seek audit log: %v)", cause, err)
+		return l.torn
+	}
+	return cause
+}
+
+// Query returns the matching entries, oldest first, and whether more match
+// beyond the limit.
+func (l *Log) Query(q Query) (entries []Entry, more bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	entries = []Entry{}
+	for _, e := range l.entries {
+		if !q.matches(e) {
+			continue
+		}
+		if q.Limit > 0 && len(entries) == q.Limit {
+			return entries, true
+		}
+		entries = append(entries, e)
+	}
+	return entries, false
+}
+
+// Export writes every matching entry to w as JSON Lines, oldest first.
+// Entries appended while it runs are not included.
+func (l *Log) Export(w io.Writer, q Query) error {
+	// Recorded entries never change, so the slice can be read without holding
+	// the lock while a slow reader drains w.
+	l.mu.RLock()
+	entries := l.entries
+	l.mu.RUnlock()
+
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if !q.matches(e) {
+			continue
+		}
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the log file; later appends fail with ErrClosed.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
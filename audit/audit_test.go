@@ -0,0 +1,152 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogAppendsQueriesAndSurvivesTornWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []Entry{
+		{Actor: "alice", Action: "board.created", BoardID: "b1", Revision: 1},
+		{Actor: "bob", Action: "note.updated", BoardID: "b1", Revision: 2, Elements: []string{"n1"}},
+		{Actor: "alice", Action: "member.set", BoardID: "b1", Details: map[string]string{"principal": "bob", "role": "editor"}},
+		{Actor: "bob", Action: "note.created", BoardID: "b2", Revision: 2, Elements: []string{"n9"}},
+	} {
+		if _, err := l.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+
+	// A crash in the middle of an append leaves half a line behind.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	f.WriteString(`{"seq":5,"action":"boa`)
+	f.Close()
+
+	if l, err = Open(path); err != nil {
+		t.Fatalf("reopen after a torn write: %v", err)
+	}
+	defer l.Close()
+	next, err := l.Append(Entry{Actor: "carol", Action: "board.trashed", BoardID: "b2"})
+	if err != nil || next.Seq != 5 {
+		t.Fatalf("expected the torn entry to be dropped and numbering to continue at 5, got %d (%v)", next.Seq, err)
+	}
+
+	if got, _ := l.Query(Query{Actor: "bob"}); len(got) != 2 || got[0].Seq != 2 {
+		t.Fatalf("expected bob's two entries, got %+v", got)
+	}
+	if got, _ := l.Query(Query{BoardID: "b1", Action: "note."}); len(got) != 1 || got[0].Elements[0] != "n1" {
+		t.Fatalf("expected one note change on b1, got %+v", got)
+	}
+	if got, _ := l.Query(Query{Element: "n9"}); len(got) != 1 || got[0].BoardID != "b2" {
+		t.Fatalf("expected the entry touching n9, got %+v", got)
+	}
+	page, more := l.Query(Query{Limit: 2})
+	if len(page) != 2 || !more {
+		t.Fatalf("expected a first page of two with more to come, got %d %v", len(page), more)
+	}
+	if rest, more := l.Query(Query{After: page[1].Seq}); len(rest) != 3 || more {
+		t.Fatalf("expected the remaining three entries, got %d %v", len(rest), more)
+	}
+
+	var buf bytes.Buffer
+	if err := l.Export(&buf, Query{BoardID: "b2"}); err != nil {
+		t.Fatal(err)
+	}
+	var lines []Entry
+	for scanner := bufio.NewScanner(&buf); scanner.Scan(); {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("export line is not JSON: %v", err)
+		}
+		lines = append(lines, e)
+	}
+	if len(lines) != 2 || lines[1].Action != "board.trashed" {
+		t.Fatalf("expected two exported entries for b2, got %+v", lines)
+	}
+}
+
+// failingFile writes through to a real file but can be made to fail part way
+// through a write, on sync or on truncate.
+type failingFile struct {
+	*os.File
+	shortWrite, failSync, failTruncate bool
+}
+
+func (f *failingFile) Write(p []byte) (int, error) {
+	if f.shortWrite {
+		n, _ := f.File.Write(p[:len(p)/2])
+		return n, errors.New("disk full")
+	}
+	return f.File.Write(p)
+}
+
+func (f *failingFile) Sync() error {
+	if f.failSync {
+		return errors.New("sync failed")
+	}
+	return f.File.Sync()
+}
+
+func (f *failingFile) Truncate(size int64) error {
+	if f.failTruncate {
+		return errors.New("truncate failed")
+	}
+	return f.File.Truncate(size)
+}
+
+func TestLogCutsFailedAppendsBackOut(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := &failingFile{File: l.file.(*os.File)}
+	l.file = file
+	if _, err := l.Append(Entry{Action: "board.created"}); err != nil {
+		t.Fatal(err)
+	}
+
+	file.shortWrite = true
+	if _, err := l.Append(Entry{Action: "note.created"}); err == nil {
+		t.Fatal("expected a short write to fail the append")
+	}
+	file.shortWrite, file.failSync = false, true
+	if _, err := l.Append(Entry{Action: "note.updated"}); err == nil {
+		t.Fatal("expected a failed sync to fail the append")
+	}
+	file.failSync = false
+	if e, err := l.Append(Entry{Action: "note.deleted"}); err != nil || e.Seq != 2 {
+		t.Fatalf("expected the next entry to be numbered 2, got %d (%v)", e.Seq, err)
+	}
+
+	file.shortWrite, file.failTruncate = true, true
+	if _, err := l.Append(Entry{Action: "note.created"}); err == nil {
+		t.Fatal("expected a short write to fail the append")
+	}
+	file.shortWrite, file.failTruncate = false, false
+	if _, err := l.Append(Entry{Action: "note.updated"}); err == nil {
+		t.Fatal("expected appends to stop once a torn line could not be cut out")
+	}
+	l.Close()
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopen after failed appends: %v", err)
+	}
+	defer reopened.Close()
+	got, _ := reopened.Query(Query{})
+	if len(got) != 2 || got[0].Action != "board.created" || got[1].Action != "note.deleted" || got[1].Seq != 2 {
+		t.Fatalf("expected only the two appended entries on disk, got %+v", got)
+	}
+}
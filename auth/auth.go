@@ -0,0 +1,467 @@
+// Package auth manages user accounts and how requests prove who they are:
+// browser sessions kept in a cookie, personal API tokens for scripts, and
+// sign-in through an external OpenID Connect provider.
+package auth
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"test1/storage"
+)
+
+var (
+	// ErrInvalidCredentials is returned for an unknown email or a wrong password.
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	// ErrEmailTaken is returned when registering an email that already has an account.
+	ErrEmailTaken = errors.New("email already registered")
+	// ErrNotFound is returned for unknown users and tokens.
+	ErrNotFound = errors.New("not found")
+)
+
+// User is an account. Accounts created through OpenID Connect are identified
+// by their provider's issuer and subject and have no password.
+type User struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email,omitempty"`
+	Issuer    string    `json:"issuer,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Token describes a personal API token. The secret itself is only returned
+// once, when the token is created.
+type Token struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"userId"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Options configures a Service.
+type Options struct {
+	// Path is the JSON file accounts, tokens and sessions are kept in. Empty keeps them in memory.
+	Path string
+	// SessionTTL is how long a login session lasts.
+	SessionTTL time.Duration
+	// Registration lets anyone create a password account. The first account can always be created.
+	Registration bool
+	// SecureCookies marks session cookies Secure, for deployments behind HTTPS.
+	SecureCookies bool
+	// OIDC enables sign-in through an OpenID Connect provider.
+	OIDC *OIDCProvider
+}
+
+// DefaultOptions keeps accounts in memory with week-long sessions and open registration.
+func DefaultOptions() Options {
+	return Options{SessionTTL: 7 * 24 * time.Hour, Registration: true}
+}
+
+// passwordIterations is the PBKDF2-SHA256 work factor for new password hashes.
+const passwordIterations = 600000
+
+// dummyHash is checked against when there is no password to check, at the
+// same work factor as real hashes. Its fixed salt and key match no password
+// in practice, and the answer is ignored anyway.
+var dummyHash = fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIterations,
+	base64.RawStdEncoding.EncodeToString(make([]byte, 16)), base64.RawStdEncoding.EncodeToString(make([]byte, 32)))
+
+type account struct {
+	User
+	PasswordHash string `json:"passwordHash,omitempty"`
+}
+
+type tokenRecord struct {
+	Token
+	Hash string `json:"hash"`
+}
+
+type session struct {
+	UserID    string    `json:"userId"`
+	CSRF      string    `json:"csrf"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// state is what the Service persists. Tokens and sessions are keyed by the
+// SHA-256 of their secret, so the file alone cannot be used to sign in.
+type state struct {
+	Users    []*account              `json:"users"`
+	Tokens   map[string]*tokenRecord `json:"tokens"`
+	Sessions map[string]*session     `json:"sessions"`
+}
+
+// Service stores accounts, sessions and tokens and authenticates requests.
+type Service struct {
+	mu    sync.Mutex
+	opts  Options
+	now   func() time.Time
+	users map[string]*account
+	// byEmail and bySubject index users by lowercased email and by issuer+subject.
+	byEmail   map[string]*account
+	bySubject map[string]*account
+	tokens    map[string]*tokenRecord
+	sessions  map[string]*session
+	logins    map[string]pendingLogin
+}
+
+// NewService loads the service state from opts.Path when it exists.
+func NewService(opts Options) (*Service, error) {
+	if opts.SessionTTL <= 0 {
+		opts.SessionTTL = DefaultOptions().SessionTTL
+	}
+	s := &Service{
+		opts:      opts,
+		now:       time.Now,
+		users:     make(map[string]*account),
+		byEmail:   make(map[string]*account),
+		bySubject: make(map[string]*account),
+		tokens:    make(map[string]*tokenRecord),
+		sessions:  make(map[string]*session),
+		logins:    make(map[string]pendingLogin),
+	}
+	if opts.Path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(opts.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read auth state: %w", err)
+	}
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("decode auth state: %w", err)
+	}
+	for _, a := range st.Users {
+		s.indexLocked(a)
+	}
+	for hash, t := range st.Tokens {
+		s.tokens[hash] = t
+	}
+	for hash, sess := range st.Sessions {
+		s.sessions[hash] = sess
+	}
+	return s, nil
+}
+
+// OIDCEnabled reports whether sign-in through an OpenID Connect provider is configured.
+func (s *Service) OIDCEnabled() bool {
+	return s.opts.OIDC != nil
+}
+
+// Register creates a password account and returns it.
+func (s *Service) Register(name, email, password string) (User, error) {
+	email = strings.TrimSpace(email)
+	if email == "" || password == "" {
+		return User{}, errors.New("email and password are required")
+	}
+	if name == "" {
+		name = email
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.opts.Registration && len(s.users) > 0 {
+		return User{}, errors.New("registration is closed")
+	}
+	if _, ok := s.byEmail[strings.ToLower(email)]; ok {
+		return User{}, ErrEmailTaken
+	}
+	a := &account{User: User{ID: storage.NewID(), Name: name, Email: email, CreatedAt: s.now().UTC()}, PasswordHash: hash}
+	s.indexLocked(a)
+	if err := s.saveLocked(); err != nil {
+		s.unindexLocked(a)
+		return User{}, err
+	}
+	return a.User, nil
+}
+
+// CheckPassword returns the password account for email when password matches.
+func (s *Service) CheckPassword(email, password string) (User, error) {
+	s.mu.Lock()
+	a, ok := s.byEmail[strings.ToLower(strings.TrimSpace(email))]
+	s.mu.Unlock()
+	if !ok || a.PasswordHash == "" {
+		// Spend as long as a real check would, so the answer does not tell
+		// which emails have a password account.
+		verifyPassword(dummyHash, password)
+		return User{}, ErrInvalidCredentials
+	}
+	if !verifyPassword(a.PasswordHash, password) {
+		return User{}, ErrInvalidCredentials
+	}
+	return a.User, nil
+}
+
+// User returns the account with the given ID.
+func (s *Service) User(id string) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.users[id]
+	if !ok {
+		return User{}, false
+	}
+	return a.User, true
+}
+
+// IsUser reports whether id belongs to an account. Anonymous participants may
+// not claim such an ID.
+func (s *Service) IsUser(id string) bool {
+	_, ok := s.User(id)
+	return ok
+}
+
+// externalUser returns the account linked to the provider subject, creating it
+// on first sign-in and refreshing its name and email afterwards.
+func (s *Service) externalUser(issuer, subject, name, email string) (User, error) {
+	if name == "" {
+		name = email
+	}
+	if name == "" {
+		name = subject
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.bySubject[issuer+"\x00"+subject]
+	if ok {
+		if a.Name == name && a.Email == email {
+			return a.User, nil
+		}
+		s.unindexLocked(a)
+		a.Name, a.Email = name, email
+	} else {
+		a = &account{User: User{ID: storage.NewID(), Name: name, Email: email, Issuer: issuer, Subject: subject, CreatedAt: s.now().UTC()}}
+	}
+	s.indexLocked(a)
+	if err := s.saveLocked(); err != nil {
+		return User{}, err
+	}
+	return a.User, nil
+}
+
+// CreateSession starts a login session for the user and returns its secret
+// and CSRF token.
+func (s *Service) CreateSession(userID string) (secret, csrf string, err error) {
+	secret, csrf = randomSecret(), randomSecret()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[userID]; !ok {
+		return "", "", ErrNotFound
+	}
+	now := s.now()
+	for hash, sess := range s.sessions {
+		if now.After(sess.ExpiresAt) {
+			delete(s.sessions, hash)
+		}
+	}
+	s.sessions[hashSecret(secret)] = &session{UserID: userID, CSRF: csrf, ExpiresAt: now.Add(s.opts.SessionTTL)}
+	if err := s.saveLocked(); err != nil {
+		return "", "", err
+	}
+	return secret, csrf, nil
+}
+
+// EndSession signs the session out.
+func (s *Service) EndSession(secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hash := hashSecret(secret)
+	if _, ok := s.sessions[hash]; !ok {
+		return nil
+	}
+	delete(s.sessions, hash)
+	return s.saveLocked()
+}
+
+// session returns the user and CSRF token of a live session.
+func (s *Service) session(secret string) (User, string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[hashSecret(secret)]
+	if !ok || s.now().After(sess.ExpiresAt) {
+		return User{}, "", false
+	}
+	a, ok := s.users[sess.UserID]
+	if !ok {
+		return User{}, "", false
+	}
+	return a.User, sess.CSRF, true
+}
+
+// tokenPrefix marks personal API tokens so they are recognisable in scripts and logs.
+const tokenPrefix = "pat_"
+
+// CreateToken issues a personal API token for the user. A zero ttl never expires.
+// The returned secret is not stored and cannot be retrieved again.
+func (s *Service) CreateToken(userID, name string, ttl time.Duration) (Token, string, error) {
+	secret := tokenPrefix + randomSecret()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[userID]; !ok {
+		return Token{}, "", ErrNotFound
+	}
+	t := &tokenRecord{
+		Token: Token{ID: storage.NewID(), UserID: userID, Name: name, Prefix: secret[:len(tokenPrefix)+6], CreatedAt: s.now().UTC()},
+		Hash:  hashSecret(secret),
+	}
+	if ttl > 0 {
+		expires := t.CreatedAt.Add(ttl)
+		t.ExpiresAt = &expires
+	}
+	s.tokens[t.Hash] = t
+	if err := s.saveLocked(); err != nil {
+		delete(s.tokens, t.Hash)
+		return Token{}, "", err
+	}
+	return t.Token, secret, nil
+}
+
+// Tokens lists the user's tokens, oldest first.
+func (s *Service) Tokens(userID string) []Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens := []Token{}
+	for _, t := range s.tokens {
+		if t.UserID == userID {
+			tokens = append(tokens, t.Token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+	return tokens
+}
+
+// RevokeToken deletes one of the user's tokens.
+func (s *Service) RevokeToken(userID, tokenID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, t := range s.tokens {
+		if t.ID == tokenID && t.UserID == userID {
+			delete(s.tokens, hash)
+			return s.saveLocked()
+		}
+	}
+	return ErrNotFound
+}
+
+// tokenUser returns the owner of a valid, unexpired token.
+func (s *Service) tokenUser(secret string) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[hashSecret(secret)]
+	if !ok || (t.ExpiresAt != nil && s.now().After(*t.ExpiresAt)) {
+		return User{}, false
+	}
+	a, ok := s.users[t.UserID]
+	if !ok {
+		return User{}, false
+	}
+	return a.User, true
+}
+
+func (s *Service) indexLocked(a *account) {
+	s.users[a.ID] = a
+	if a.Email != "" && a.PasswordHash != "" {
+		s.byEmail[strings.ToLower(a.Email)] = a
+	}
+	if a.Subject != "" {
+		s.bySubject[a.Issuer+"\x00"+a.Subject] = a
+	}
+}
+
+func (s *Service) unindexLocked(a *account) {
+	delete(s.users, a.ID)
+	if s.byEmail[strings.ToLower(a.Email)] == a {
+		delete(s.byEmail, strings.ToLower(a.Email))
+	}
+	if a.Subject != "" {
+		delete(s.bySubject, a.Issuer+"\x00"+a.Subject)
+	}
+}
+
+func (s *Service) saveLocked() error {
+	if s.opts.Path == "" {
+		return nil
+	}
+	st := state{Users: make([]*account, 0, len(s.users)), Tokens: s.tokens, Sessions: s.sessions}
+	for _, a := range s.users {
+		st.Users = append(st.Users, a)
+	}
+	sort.Slice(st.Users, func(i, j int) bool { return st.Users[i].CreatedAt.Before(st.Users[j].CreatedAt) })
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode auth state: %w", err)
+	}
+	if err := storage.WriteFileAtomic(s.opts.Path, data, 0o600); err != nil {
+		return fmt.Errorf("write auth state: %w", err)
+	}
+	return nil
+}
+
+// hashPassword encodes a salted PBKDF2-SHA256 hash as "pbkdf2-sha256$iterations$salt$key".
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, 32)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIterations, enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+func verifyPassword(encoded, password string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	enc := base64.RawStdEncoding
+	salt, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := enc.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	return err == nil && subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// randomSecret returns 32 random bytes, base64url encoded.
+func randomSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
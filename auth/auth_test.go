@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"test1/auth/mockoidc"
+)
+
+// newTestServer serves the auth endpoints plus /whoami, which requires a
+// signed-in user and echoes their identity for GET and POST.
+func newTestServer(t *testing.T, s *Service) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle("/auth/", s.Handler())
+	mux.Handle("/whoami", s.Middleware(true, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := FromContext(r.Context())
+		respondJSON(w, http.StatusOK, id)
+	})))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newClient(t *testing.T) *http.Client {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{Jar: jar}
+}
+
+func do(t *testing.T, c *http.Client, method, url, body string, header map[string]string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer res.Body.Close()
+	data, _ := io.ReadAll(res.Body)
+	return res.StatusCode, string(data)
+}
+
+func TestSessionsRequireCSRFForWrites(t *testing.T) {
+	s, err := NewService(DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t, s)
+	client := newClient(t)
+
+	if code, _ := do(t, client, "GET", srv.URL+"/whoami", "", nil); code != http.StatusUnauthorized {
+		t.Fatalf("expected anonymous requests to be rejected, got %d", code)
+	}
+	code, body := do(t, client, "POST", srv.URL+"/auth/register", `{"name":"Ada","email":"ada@example.com","password":"hunter22"}`, nil)
+	if code != http.StatusCreated {
+		t.Fatalf("register: %d %s", code, body)
+	}
+	var started sessionResponse
+	json.Unmarshal([]byte(body), &started)
+
+	if code, body := do(t, client, "GET", srv.URL+"/whoami", "", nil); code != http.StatusOK || !strings.Contains(body, `"name":"Ada"`) {
+		t.Fatalf("expected the session cookie to sign in, got %d %s", code, body)
+	}
+	if code, _ := do(t, client, "POST", srv.URL+"/whoami", "", nil); code != http.StatusForbidden {
+		t.Fatalf("expected a write without the CSRF token to be forbidden, got %d", code)
+	}
+	if code, _ := do(t, client, "POST", srv.URL+"/whoami", "", map[string]string{CSRFHeader: started.CSRFToken}); code != http.StatusOK {
+		t.Fatalf("expected a write with the CSRF token to pass, got %d", code)
+	}
+
+	if code, _ := do(t, newClient(t), "POST", srv.URL+"/auth/login", `{"email":"ada@example.com","password":"wrong"}`, nil); code != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong password to be rejected, got %d", code)
+	}
+	if code, _ := do(t, client, "POST", srv.URL+"/auth/logout", "", map[string]string{CSRFHeader: started.CSRFToken}); code != http.StatusNoContent {
+		t.Fatalf("logout: %d", code)
+	}
+	if code, _ := do(t, client, "GET", srv.URL+"/whoami", "", nil); code != http.StatusUnauthorized {
+		t.Fatalf("expected the session to end on logout, got %d", code)
+	}
+}
+
+func TestTokensAuthenticateUntilRevoked(t *testing.T) {
+	dir := t.TempDir()
+	opts := DefaultOptions()
+	opts.Path = filepath.Join(dir, "auth.json")
+	s, err := NewService(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := s.Register("Grace", "grace@example.com", "cobol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, secret, err := s.CreateToken(user.ID, "ci", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// State survives a restart; the token file only holds hashes.
+	s, err = NewService(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t, s)
+	bearer := map[string]string{"Authorization": "Bearer " + secret}
+	if code, body := do(t, http.DefaultClient, "POST", srv.URL+"/whoami", "", bearer); code != http.StatusOK || !strings.Contains(body, `"method":"token"`) {
+		t.Fatalf("expected the token to authenticate without CSRF, got %d %s", code, body)
+	}
+	if code, _ := do(t, http.DefaultClient, "GET", srv.URL+"/whoami", "", map[string]string{"Authorization": "Bearer pat_nope"}); code != http.StatusUnauthorized {
+		t.Fatalf("expected an unknown token to be rejected, got %d", code)
+	}
+	if _, err := s.CheckPassword("grace@example.com", "cobol"); err != nil {
+		t.Fatalf("expected the password to survive a restart: %v", err)
+	}
+
+	if code, _ := do(t, http.DefaultClient, "DELETE", srv.URL+"/auth/tokens/"+token.ID, "", bearer); code != http.StatusNoContent {
+		t.Fatalf("revoke: %d", code)
+	}
+	if code, _ := do(t, http.DefaultClient, "GET", srv.URL+"/whoami", "", bearer); code != http.StatusUnauthorized {
+		t.Fatalf("expected a revoked token to be rejected, got %d", code)
+	}
+
+	s.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, expiring, _ := s.CreateToken(user.ID, "short", time.Hour)
+	s.now = time.Now
+	if _, ok := s.tokenUser(expiring); !ok {
+		t.Fatal("expected the token to be valid before it expires")
+	}
+	s.now = func() time.Time { return time.Now().Add(4 * time.Hour) }
+	if _, ok := s.tokenUser(expiring); ok {
+		t.Fatal("expected the token to expire")
+	}
+}
+
+func TestOIDCLoginWithMockProvider(t *testing.T) {
+	var mock *mockoidc.Provider
+	providerSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { mock.ServeHTTP(w, r) }))
+	defer providerSrv.Close()
+	mock, err := mockoidc.New(providerSrv.URL, "boards", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The redirect URL is only known once the app server listens.
+	cfg := OIDCConfig{Issuer: providerSrv.URL, ClientID: "boards", ClientSecret: "s3cret"}
+	opts := DefaultOptions()
+	opts.OIDC = NewOIDCProvider(cfg)
+	s, err := NewService(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t, s)
+	opts.OIDC.cfg.RedirectURL = srv.URL + "/auth/oidc/callback"
+
+	client := newClient(t)
+	code, body := do(t, client, "GET", srv.URL+"/auth/oidc/login?return=/whoami&login_hint="+url.QueryEscape("lin@example.com"), "", nil)
+	if code != http.StatusOK || !strings.Contains(body, `"name":"lin"`) {
+		t.Fatalf("expected to land on /whoami signed in, got %d %s", code, body)
+	}
+	// Signing in again reuses the account linked to the provider subject.
+	first := body
+	if _, body = do(t, client, "GET", srv.URL+"/auth/oidc/login?return=/whoami&login_hint="+url.QueryEscape("lin@example.com"), "", nil); body != first {
+		t.Fatalf("expected the same account, got %s and %s", first, body)
+	}
+
+	// A callback without the state cookie of the browser that started the login is refused.
+	if code, _ := do(t, newClient(t), "GET", srv.URL+"/auth/oidc/callback?code=x&state=y", "", nil); code != http.StatusBadRequest {
+		t.Fatalf("expected a foreign callback to be refused, got %d", code)
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{"iss": providerSrv.URL, "sub": "x", "aud": "boards", "exp": now.Add(time.Hour).Unix(), "nonce": "n"}
+	valid, _ := mock.Sign(claims)
+	if _, err := opts.OIDC.Verify(t.Context(), valid, "n"); err != nil {
+		t.Fatalf("expected a well-formed token to verify: %v", err)
+	}
+	for name, change := range map[string]func(){
+		"audience": func() { claims["aud"] = "someone-else" },
+		"expiry":   func() { claims["exp"] = now.Add(-time.Hour).Unix() },
+		"issuer":   func() { claims["iss"] = "https://evil.example" },
+	} {
+		saved := map[string]interface{}{"iss": claims["iss"], "aud": claims["aud"], "exp": claims["exp"]}
+		change()
+		forged, _ := mock.Sign(claims)
+		if _, err := opts.OIDC.Verify(t.Context(), forged, "n"); err == nil {
+			t.Fatalf("expected a token with a bad %s to be rejected", name)
+		}
+		for k, v := range saved {
+			claims[k] = v
+		}
+	}
+	if _, err := opts.OIDC.Verify(t.Context(), valid, "other"); err == nil {
+		t.Fatal("expected a nonce mismatch to be rejected")
+	}
+	tampered := valid[:len(valid)-4] + "AAAA"
+	if _, err := opts.OIDC.Verify(t.Context(), tampered, "n"); err == nil {
+		t.Fatal("expected a bad signature to be rejected")
+	}
+}
+
+func TestDummyHashCostsAsMuchAsARealOne(t *testing.T) {
+	// CheckPassword verifies against dummyHash for unknown emails; it has to be
+	// a well-formed hash at the full work factor, or the check would return early.
+	parts := strings.Split(dummyHash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" || parts[1] != strconv.Itoa(passwordIterations) {
+		t.Fatalf("unexpected dummy hash %q", dummyHash)
+	}
+	enc := base64.RawStdEncoding
+	if salt, err := enc.DecodeString(parts[2]); err != nil || len(salt) != 16 {
+		t.Fatalf("expected a 16-byte salt, got %d bytes (%v)", len(salt), err)
+	}
+	if key, err := enc.DecodeString(parts[3]); err != nil || len(key) != 32 {
+		t.Fatalf("expected a 32-byte key, got %d bytes (%v)", len(key), err)
+	}
+
+	s, err := NewService(DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CheckPassword("nobody@example.com", "secret"); err != ErrInvalidCredentials {
+		t.Fatalf("expected invalid credentials for an unknown email, got %v", err)
+	}
+}
@@ -0,0 +1,320 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// SessionCookie holds the session secret. It is HttpOnly.
+	SessionCookie = "board_session"
+	// CSRFCookie holds the session's CSRF token for scripts to echo in CSRFHeader.
+	CSRFCookie = "board_csrf"
+	// CSRFHeader must carry the CSRF token on unsafe requests authenticated by the session cookie.
+	CSRFHeader = "X-CSRF-Token"
+
+	// MethodSession and MethodToken say how an Identity was authenticated.
+	MethodSession = "session"
+	MethodToken   = "token"
+)
+
+// Identity is the authenticated user behind a request.
+type Identity struct {
+	UserID string `json:"id"`
+	Name   string `json:"name"`
+	Email  string `json:"email,omitempty"`
+	Method string `json:"method"`
+	csrf   string
+}
+
+// CheckCSRF reports whether token is the CSRF token of the identity's session.
+// Token-authenticated requests are not exposed to CSRF and always pass.
+func (id Identity) CheckCSRF(token string) bool {
+	if id.Method != MethodSession {
+		return true
+	}
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(id.csrf)) == 1
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a context carrying id.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity the request was authenticated as, if any.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+var errInvalidToken = errors.New("invalid or expired token")
+
+// Authenticate identifies the request from its bearer token or session cookie.
+// A request without either is anonymous (ok is false); a bearer token that is
+// not valid is an error rather than anonymous, so scripts notice it.
+func (s *Service) Authenticate(r *http.Request) (id Identity, ok bool, err error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		secret, found := strings.CutPrefix(header, "Bearer ")
+		if !found {
+			return Identity{}, false, errInvalidToken
+		}
+		user, valid := s.tokenUser(strings.TrimSpace(secret))
+		if !valid {
+			return Identity{}, false, errInvalidToken
+		}
+		return Identity{UserID: user.ID, Name: user.Name, Email: user.Email, Method: MethodToken}, true, nil
+	}
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		if user, csrf, valid := s.session(cookie.Value); valid {
+			return Identity{UserID: user.ID, Name: user.Name, Email: user.Email, Method: MethodSession, csrf: csrf}, true, nil
+		}
+	}
+	return Identity{}, false, nil
+}
+
+// Middleware authenticates every request and stores the identity in its
+// context. Unsafe requests made with the session cookie must echo the CSRF
+// token in CSRFHeader. With required set, anonymous requests are rejected.
+func (s *Service) Middleware(required bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok, err := s.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if !ok {
+			if required {
+				http.Error(w, "authentication required", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !safeMethod(r.Method) && !id.CheckCSRF(r.Header.Get(CSRFHeader)) {
+			http.Error(w, "missing or invalid CSRF token", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+	})
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// Handler serves the account endpoints under /auth/:
+//
+//	GET    /auth/config          which sign-in options are available
+//	POST   /auth/register        create a password account and sign in
+//	POST   /auth/login           sign in with email and password
+//	POST   /auth/logout          end the session
+//	GET    /auth/me              the signed-in user
+//	GET    /auth/tokens          list personal API tokens
+//	POST   /auth/tokens          create a personal API token
+//	DELETE /auth/tokens/{id}     revoke a personal API token
+//	GET    /auth/oidc/login      start signing in with the OpenID Connect provider (?return=, ?login_hint=)
+//	GET    /auth/oidc/callback   finish signing in with the provider
+func (s *Service) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /auth/config", s.serveConfig)
+	mux.HandleFunc("POST /auth/register", s.register)
+	mux.HandleFunc("POST /auth/login", s.login)
+	mux.HandleFunc("POST /auth/logout", s.logout)
+	mux.HandleFunc("GET /auth/me", s.me)
+	mux.HandleFunc("GET /auth/tokens", s.listTokens)
+	mux.HandleFunc("POST /auth/tokens", s.createToken)
+	mux.HandleFunc("DELETE /auth/tokens/{id}", s.revokeToken)
+	mux.HandleFunc("GET /auth/oidc/login", s.oidcLogin)
+	mux.HandleFunc("GET /auth/oidc/callback", s.oidcCallback)
+	return s.Middleware(false, mux)
+}
+
+type credentials struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// sessionResponse is returned when a session starts. The CSRF token is also
+// set as CSRFCookie, so pages can read it from either.
+type sessionResponse struct {
+	User      User   `json:"user"`
+	CSRFToken string `json:"csrfToken"`
+}
+
+func (s *Service) serveConfig(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	registration := s.opts.Registration || len(s.users) == 0
+	s.mu.Unlock()
+	respondJSON(w, http.StatusOK, map[string]bool{"registration": registration, "oidc": s.OIDCEnabled()})
+}
+
+func (s *Service) register(w http.ResponseWriter, r *http.Request) {
+	var c credentials
+	if !decodeCredentials(w, r, &c) {
+		return
+	}
+	user, err := s.Register(c.Name, c.Email, c.Password)
+	if errors.Is(err, ErrEmailTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.startSession(w, r, user, http.StatusCreated)
+}
+
+func (s *Service) login(w http.ResponseWriter, r *http.Request) {
+	var c credentials
+	if !decodeCredentials(w, r, &c) {
+		return
+	}
+	user, err := s.CheckPassword(c.Email, c.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	s.startSession(w, r, user, http.StatusOK)
+}
+
+// decodeCredentials only accepts JSON bodies: browsers cannot send those
+// cross-site without a CORS preflight, which keeps other sites from signing a
+// visitor in to an account of their choosing.
+func decodeCredentials(w http.ResponseWriter, r *http.Request, c *credentials) bool {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(c); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (s *Service) startSession(w http.ResponseWriter, r *http.Request, user User, status int) {
+	secret, csrf, err := s.CreateSession(user.ID)
+	if err != nil {
+		http.Error(w, "failed to start session", http.StatusInternalServerError)
+		return
+	}
+	s.setSessionCookies(w, secret, csrf)
+	respondJSON(w, status, sessionResponse{User: user, CSRFToken: csrf})
+}
+
+func (s *Service) setSessionCookies(w http.ResponseWriter, secret, csrf string) {
+	maxAge := int(s.opts.SessionTTL / time.Second)
+	http.SetCookie(w, &http.Cookie{Name: SessionCookie, Value: secret, Path: "/", MaxAge: maxAge, HttpOnly: true, Secure: s.opts.SecureCookies, SameSite: http.SameSiteLaxMode})
+	http.SetCookie(w, &http.Cookie{Name: CSRFCookie, Value: csrf, Path: "/", MaxAge: maxAge, Secure: s.opts.SecureCookies, SameSite: http.SameSiteStrictMode})
+}
+
+func (s *Service) logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		if _, ok := FromContext(r.Context()); ok {
+			if err := s.EndSession(cookie.Value); err != nil {
+				http.Error(w, "failed to end session", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	for _, name := range []string{SessionCookie, CSRFCookie} {
+		http.SetCookie(w, &http.Cookie{Name: name, Path: "/", MaxAge: -1, Secure: s.opts.SecureCookies})
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) me(w http.ResponseWriter, r *http.Request) {
+	id, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "not signed in", http.StatusUnauthorized)
+		return
+	}
+	respondJSON(w, http.StatusOK, id)
+}
+
+func (s *Service) listTokens(w http.ResponseWriter, r *http.Request) {
+	id, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "not signed in", http.StatusUnauthorized)
+		return
+	}
+	respondJSON(w, http.StatusOK, s.Tokens(id.UserID))
+}
+
+// createdToken is the only response that includes a token's secret.
+type createdToken struct {
+	Token
+	Secret string `json:"token"`
+}
+
+func (s *Service) createToken(w http.ResponseWriter, r *http.Request) {
+	id, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "not signed in", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Name      string `json:"name"`
+		ExpiresIn string `json:"expiresIn"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	var ttl time.Duration
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			http.Error(w, "expiresIn must be a positive duration such as 720h", http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+	if req.Name == "" {
+		req.Name = "token"
+	}
+	token, secret, err := s.CreateToken(id.UserID, req.Name, ttl)
+	if err != nil {
+		http.Error(w, "failed to create token", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusCreated, createdToken{Token: token, Secret: secret})
+}
+
+func (s *Service) revokeToken(w http.ResponseWriter, r *http.Request) {
+	id, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "not signed in", http.StatusUnauthorized)
+		return
+	}
+	err := s.RevokeToken(id.UserID, r.PathValue("id"))
+	if errors.Is(err, ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func respondJSON(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
@@ -0,0 +1,367 @@
+// Package crdt implements a replicated growable array (RGA) for collaborative
+// text. Replicas that apply the same set of operations, in any order, converge
+// to the same string.
+package crdt
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"unicode/utf8"
+)
+
+// ID identifies one inserted character by a Lamport counter and the site that created it.
+type ID struct {
+	Counter uint64 `json:"c"`
+	Site    string `json:"s"`
+}
+
+// IsZero reports whether id refers to the start of the document.
+func (id ID) IsZero() bool {
+	return id.Counter == 0 && id.Site == ""
+}
+
+// after orders concurrent inserts at the same anchor: the greater ID is placed first.
+func (id ID) after(other ID) bool {
+	if id.Counter != other.Counter {
+		return id.Counter > other.Counter
+	}
+	return id.Site > other.Site
+}
+
+// Op kinds.
+const (
+	OpInsert = "insert"
+	OpDelete = "delete"
+)
+
+// Op is a single insert or delete. Inserts place Value (one character) after the
+// character identified by After, or at the start when After is zero. Deletes
+// tombstone the character identified by ID.
+type Op struct {
+	Kind  string `json:"kind"`
+	ID    ID     `json:"id"`
+	After ID     `json:"after,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// Element is a character in the sequence; deleted characters stay as tombstones
+// so later operations can still refer to them.
+type Element struct {
+	ID      ID     `json:"id"`
+	Value   string `json:"v"`
+	Deleted bool   `json:"d,omitempty"`
+}
+
+// Text is the replicated state of one text field. Its characters form a
+// linked list indexed by ID, so integrating an operation does not scan the
+// document; the index is rebuilt when a document is decoded.
+type Text struct {
+	Clock uint64
+	// Pending holds operations that arrived before the character they depend on.
+	Pending []Op
+	// Floor is the highest counter among the tombstones Compact dropped. An
+	// unknown character at or below it may have been one of them.
+	Floor uint64
+
+	head  *node
+	nodes map[ID]*node
+}
+
+type node struct {
+	Element
+	next *node
+}
+
+// textJSON is the stored form of a Text.
+type textJSON struct {
+	Elements []Element `json:"elements"`
+	Clock    uint64    `json:"clock"`
+	Pending  []Op      `json:"pending,omitempty"`
+	Floor    uint64    `json:"floor,omitempty"`
+}
+
+// ErrInvalidOp reports a malformed operation.
+var ErrInvalidOp = errors.New("invalid text operation")
+
+// ErrStale reports operations that depend on characters the document does
+// not have, or no longer has; the sender has to reload the document.
+var ErrStale = errors.New("text operations are based on an out-of-date document")
+
+// FromString builds a document whose characters were all inserted by site.
+func FromString(site, s string) *Text {
+	t := &Text{}
+	t.Apply(t.Edit(site, s))
+	return t
+}
+
+func fromElements(elements []Element) *Text {
+	t := &Text{}
+	t.init()
+	tail := t.head
+	for _, e := range elements {
+		if _, dup := t.nodes[e.ID]; dup {
+			continue
+		}
+		n := &node{Element: e}
+		t.nodes[e.ID] = n
+		tail.next = n
+		tail = n
+	}
+	return t
+}
+
+func (t *Text) init() {
+	if t.head == nil {
+		t.head = &node{}
+		t.nodes = make(map[ID]*node)
+	}
+}
+
+// Elements returns the characters in order, tombstones included.
+func (t *Text) Elements() []Element {
+	var elements []Element
+	if t.head == nil {
+		return elements
+	}
+	for n := t.head.next; n != nil; n = n.next {
+		elements = append(elements, n.Element)
+	}
+	return elements
+}
+
+// String returns the visible text.
+func (t *Text) String() string {
+	var buf []byte
+	if t.head == nil {
+		return ""
+	}
+	for n := t.head.next; n != nil; n = n.next {
+		if !n.Deleted {
+			buf = append(buf, n.Value...)
+		}
+	}
+	return string(buf)
+}
+
+// Clone returns a deep copy.
+func (t *Text) Clone() *Text {
+	if t == nil {
+		return nil
+	}
+	dst := fromElements(t.Elements())
+	dst.Clock = t.Clock
+	dst.Pending = append([]Op(nil), t.Pending...)
+	dst.Floor = t.Floor
+	return dst
+}
+
+// MarshalJSON encodes the characters as a list.
+func (t *Text) MarshalJSON() ([]byte, error) {
+	elements := t.Elements()
+	if elements == nil {
+		elements = []Element{}
+	}
+	return json.Marshal(textJSON{Elements: elements, Clock: t.Clock, Pending: t.Pending, Floor: t.Floor})
+}
+
+// UnmarshalJSON decodes a document and rebuilds its index.
+func (t *Text) UnmarshalJSON(data []byte) error {
+	var stored textJSON
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	*t = *fromElements(stored.Elements)
+	t.Clock = stored.Clock
+	t.Pending = stored.Pending
+	t.Floor = stored.Floor
+	return nil
+}
+
+// Validate checks the shape of ops without applying them. An insert must be
+// counted past its anchor, as inserts are ordered by assuming so.
+func Validate(ops []Op) error {
+	for _, op := range ops {
+		if op.ID.Counter == 0 || op.ID.Site == "" {
+			return ErrInvalidOp
+		}
+		switch op.Kind {
+		case OpInsert:
+			if utf8.RuneCountInString(op.Value) != 1 {
+				return ErrInvalidOp
+			}
+			if !op.After.IsZero() && op.ID.Counter <= op.After.Counter {
+				return ErrInvalidOp
+			}
+		case OpDelete:
+		default:
+			return ErrInvalidOp
+		}
+	}
+	return nil
+}
+
+// Apply integrates ops and returns those that changed the document. Duplicates are
+// ignored and operations whose dependency is missing wait in Pending until it arrives.
+func (t *Text) Apply(ops []Op) []Op {
+	t.init()
+	var applied []Op
+	queue := append(append([]Op(nil), t.Pending...), ops...)
+	t.Pending = nil
+
+	for progress := true; progress; {
+		progress = false
+		var waiting []Op
+		for _, op := range queue {
+			done, ready := t.integrate(op)
+			if !ready {
+				waiting = append(waiting, op)
+				continue
+			}
+			if done {
+				applied = append(applied, op)
+			}
+			progress = true
+		}
+		queue = waiting
+	}
+	t.Pending = queue
+	return applied
+}
+
+// Merge integrates ops from a replica that has seen every character they
+// depend on, either in the document or earlier in the same batch. Unlike
+// Apply it leaves nothing waiting: if any op cannot be integrated, or inserts
+// a character that may have been compacted away, it returns ErrStale and
+// leaves the document as it was.
+func (t *Text) Merge(ops []Op) ([]Op, error) {
+	t.init()
+	for _, op := range ops {
+		if _, known := t.nodes[op.ID]; op.Kind == OpInsert && !known && op.ID.Counter <= t.Floor {
+			return nil, ErrStale
+		}
+	}
+	trial := t.Clone()
+	applied := trial.Apply(ops)
+	waiting := make(map[Op]bool, len(trial.Pending))
+	for _, op := range trial.Pending {
+		waiting[op] = true
+	}
+	for _, op := range ops {
+		if waiting[op] {
+			return nil, ErrStale
+		}
+	}
+	*t = *trial
+	return applied, nil
+}
+
+// Compact drops the oldest tombstones beyond keep. Ops that still refer to
+// them are stale and rejected by Merge.
+func (t *Text) Compact(keep int) {
+	t.init()
+	var tombstones []ID
+	for n := t.head.next; n != nil; n = n.next {
+		if n.Deleted {
+			tombstones = append(tombstones, n.ID)
+		}
+	}
+	if len(tombstones) <= keep {
+		return
+	}
+	sort.Slice(tombstones, func(i, j int) bool { return tombstones[j].after(tombstones[i]) })
+	for _, id := range tombstones[:len(tombstones)-keep] {
+		delete(t.nodes, id)
+		t.Floor = max(t.Floor, id.Counter)
+	}
+	for p := t.head; p.next != nil; {
+		if _, kept := t.nodes[p.next.ID]; kept {
+			p = p.next
+		} else {
+			p.next = p.next.next
+		}
+	}
+}
+
+// integrate applies one op. ready is false when the op depends on a character not
+// yet seen; changed is false when the op was already applied.
+func (t *Text) integrate(op Op) (changed, ready bool) {
+	if op.ID.Counter > t.Clock {
+		t.Clock = op.ID.Counter
+	}
+
+	switch op.Kind {
+	case OpInsert:
+		if _, dup := t.nodes[op.ID]; dup {
+			return false, true
+		}
+		at := t.head
+		if !op.After.IsZero() {
+			anchor, ok := t.nodes[op.After]
+			if !ok {
+				return false, false
+			}
+			at = anchor
+		}
+		// Skip concurrent inserts at the same anchor that sort before this one.
+		for at.next != nil && at.next.ID.after(op.ID) {
+			at = at.next
+		}
+		n := &node{Element: Element{ID: op.ID, Value: op.Value}, next: at.next}
+		at.next = n
+		t.nodes[op.ID] = n
+		return true, true
+	case OpDelete:
+		n, ok := t.nodes[op.ID]
+		if !ok {
+			return false, false
+		}
+		if n.Deleted {
+			return false, true
+		}
+		n.Deleted = true
+		return true, true
+	}
+	return false, true
+}
+
+// Edit returns the operations, attributed to site, that turn the visible text into
+// target. Only the differing middle section is replaced, so unchanged characters
+// keep their identities and concurrent edits elsewhere still merge.
+func (t *Text) Edit(site, target string) []Op {
+	var visible []Element
+	for _, e := range t.Elements() {
+		if !e.Deleted {
+			visible = append(visible, e)
+		}
+	}
+	want := []rune(target)
+
+	prefix := 0
+	for prefix < len(visible) && prefix < len(want) && visible[prefix].Value == string(want[prefix]) {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(visible)-prefix && suffix < len(want)-prefix &&
+		visible[len(visible)-1-suffix].Value == string(want[len(want)-1-suffix]) {
+		suffix++
+	}
+
+	var ops []Op
+	clock := t.Clock
+	for _, e := range visible[prefix : len(visible)-suffix] {
+		ops = append(ops, Op{Kind: OpDelete, ID: e.ID})
+	}
+
+	var after ID
+	if prefix > 0 {
+		after = visible[prefix-1].ID
+	}
+	for _, r := range want[prefix : len(want)-suffix] {
+		clock++
+		id := ID{Counter: clock, Site: site}
+		ops = append(ops, Op{Kind: OpInsert, ID: id, After: after, Value: string(r)})
+		after = id
+	}
+	return ops
+}
@@ -0,0 +1,137 @@
+package crdt
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConcurrentEditsConverge(t *testing.T) {
+	base := FromString("server", "hello world")
+
+	alice := base.Clone()
+	aliceOps := alice.Edit("alice", "hello brave world")
+	alice.Apply(aliceOps)
+
+	bob := base.Clone()
+	bobOps := bob.Edit("bob", "hello world!")
+	bob.Apply(bobOps)
+
+	alice.Apply(bobOps)
+	bob.Apply(aliceOps)
+
+	if alice.String() != bob.String() {
+		t.Fatalf("replicas diverged: %q vs %q", alice.String(), bob.String())
+	}
+	if alice.String() != "hello brave world!" {
+		t.Fatalf("unexpected merge result %q", alice.String())
+	}
+}
+
+func TestValidateRejectsInsertsNotCountedPastTheirAnchor(t *testing.T) {
+	doc := FromString("server", "ab")
+	ops := doc.Edit("alice", "abc")
+	if err := Validate(ops); err != nil {
+		t.Fatalf("expected edits to validate, got %v", err)
+	}
+	anchor := ops[0].After
+	for _, counter := range []uint64{anchor.Counter, anchor.Counter - 1} {
+		op := Op{Kind: OpInsert, ID: ID{Counter: counter, Site: "mallory"}, After: anchor, Value: "x"}
+		if err := Validate([]Op{op}); err != ErrInvalidOp {
+			t.Fatalf("expected an insert counted %d after anchor %d to be rejected, got %v", counter, anchor.Counter, err)
+		}
+	}
+	start := Op{Kind: OpInsert, ID: ID{Counter: 1, Site: "mallory"}, Value: "x"}
+	if err := Validate([]Op{start}); err != nil {
+		t.Fatalf("expected an insert at the start to validate, got %v", err)
+	}
+}
+
+func TestSameAnchorInsertsConvergeAndDuplicatesAreIgnored(t *testing.T) {
+	base := FromString("server", "ab")
+	one := base.Clone()
+	two := base.Clone()
+
+	opsOne := one.Edit("one", "aXb")
+	opsTwo := two.Edit("two", "aYb")
+	one.Apply(opsOne)
+	two.Apply(opsTwo)
+
+	one.Apply(opsTwo)
+	two.Apply(opsOne)
+	two.Apply(opsOne)
+
+	if one.String() != two.String() || len(one.String()) != 4 {
+		t.Fatalf("expected convergence on one string, got %q and %q", one.String(), two.String())
+	}
+}
+
+func TestOutOfOrderOpsWaitForDependencies(t *testing.T) {
+	src := &Text{}
+	ops := src.Edit("a", "xyz")
+
+	dst := &Text{}
+	if applied := dst.Apply([]Op{ops[2], ops[1]}); len(applied) != 0 {
+		t.Fatalf("expected ops to wait for their anchor, applied %d", len(applied))
+	}
+	dst.Apply(ops[:1])
+	if dst.String() != "xyz" || len(dst.Pending) != 0 {
+		t.Fatalf("expected pending ops to drain, got %q with %d pending", dst.String(), len(dst.Pending))
+	}
+
+	del := dst.Edit("a", "xz")
+	dst.Apply(del)
+	if dst.String() != "xz" {
+		t.Fatalf("expected delete to apply, got %q", dst.String())
+	}
+}
+
+func TestMergeRejectsOpsWithUnknownDependencies(t *testing.T) {
+	doc := FromString("server", "ab")
+	other := &Text{}
+	orphans := other.Edit("c", "xyz")
+
+	if _, err := doc.Merge(orphans[1:]); err != ErrStale {
+		t.Fatalf("expected ops anchored on unknown characters to be stale, got %v", err)
+	}
+	if doc.String() != "ab" || len(doc.Pending) != 0 {
+		t.Fatalf("expected the document to be left alone, got %q with %d pending", doc.String(), len(doc.Pending))
+	}
+
+	edit := doc.Edit("c", "abcd")
+	if applied, err := doc.Merge(edit); err != nil || len(applied) != 2 || doc.String() != "abcd" {
+		t.Fatalf("expected a batch anchored on itself to merge, got %v, %d applied, %q", err, len(applied), doc.String())
+	}
+}
+
+func TestCompactDropsOldestTombstones(t *testing.T) {
+	doc := FromString("server", "abcd")
+	stale := doc.Clone()
+	doc.Apply(doc.Edit("x", ""))
+	doc.Apply(doc.Edit("x", "e"))
+
+	doc.Compact(1)
+	if got := len(doc.Elements()); got != 2 || doc.String() != "e" || doc.Floor != 3 {
+		t.Fatalf("expected one tombstone kept after floor 3, got %d elements, %q, floor %d", got, doc.String(), doc.Floor)
+	}
+	if _, err := doc.Merge(stale.Edit("y", "azbcd")); err != ErrStale {
+		t.Fatalf("expected an edit anchored on a dropped tombstone to be stale, got %v", err)
+	}
+	if _, err := doc.Merge([]Op{{Kind: OpInsert, ID: ID{Counter: 2, Site: "server"}, Value: "b"}}); err != ErrStale {
+		t.Fatalf("expected a re-sent insert of a dropped character to be stale, got %v", err)
+	}
+}
+
+func TestDecodedDocumentsKeepMerging(t *testing.T) {
+	doc := FromString("server", "hello")
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Text
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decoded.Merge(doc.Edit("a", "hello!")); err != nil || decoded.String() != "hello!" {
+		t.Fatalf("expected the decoded document to merge, got %v and %q", err, decoded.String())
+	}
+}
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"test1/access"
+	"test1/audit"
+	"test1/patch"
+)
+
+// WithAccess keeps board members and share links in store instead of in memory.
+func WithAccess(store *access.Store) Option {
+	return func(h *Handler) { h.access = store }
+}
+
+// shareHeader carries a share link secret on API requests. Pages, event
+// streams and sockets pass it as ?share= instead.
+const shareHeader = "X-Share-Token"
+
+// membersUpdated is broadcast when a board's members change.
+const membersUpdated = "members.updated"
+
+func shareSecret(r *http.Request) string {
+	if secret := r.Header.Get(shareHeader); secret != "" {
+		return secret
+	}
+	return r.URL.Query().Get("share")
+}
+
+// boardRole is the caller's role on the board. Event streams and sockets are
+// identified like their presence, so anonymous browsers are matched by ?participant=.
+func (h *Handler) boardRole(r *http.Request, boardID string) access.Role {
+	principal, _ := h.connectingParticipant(r)
+	return h.roleOf(boardID, principal, shareSecret(r))
+}
+
+// roleOf is principal's role on the board: its role as a board member or
+// share link holder, raised to its role in the board's workspace. Boards in a
+// workspace are never open; without members of their own only the workspace's
+// members can use them.
+func (h *Handler) roleOf(boardID, principal, share string) access.Role {
+	workspaceID := h.workspaces.Placement(boardID).WorkspaceID
+	if workspaceID == "" {
+		return h.access.Role(boardID, principal, share)
+	}
+	role := access.None
+	if !h.access.Open(boardID) {
+		role = h.access.Role(boardID, principal, share)
+	}
+	if inherited := h.workspaces.Role(workspaceID, principal); !role.Allows(inherited) {
+		role = inherited
+	}
+	return role
+}
+
+// openBoard reports whether everyone is the board's owner: it is a personal
+// board without members.
+func (h *Handler) openBoard(boardID string) bool {
+	return h.workspaces.Placement(boardID).WorkspaceID == "" && h.access.Open(boardID)
+}
+
+// requiredRole is the least role a request to /boards/{id}/... needs; parts
+// is the path below /boards/. Viewers may read and follow a board and show
+// their cursor, commenters may also add comments, and owners manage access,
+// move, archive and delete the board. Ops from commenters are narrowed further by commentOnly.
+func requiredRole(method string, parts []string) access.Role {
+	sub := ""
+	if len(parts) > 1 {
+		sub = parts[1]
+	}
+	switch {
+	case sub == "links":
+		return access.Owner
+	case method == http.MethodGet || method == http.MethodHead:
+		return access.Viewer
+	case sub == "cursor", sub == "what-if":
+		return access.Viewer
+	case sub == "ops", sub == "comments" && method == http.MethodPost && len(parts) == 2:
+		return access.Commenter
+	case sub == "members", sub == "move", sub == "archive", sub == "unarchive", sub == "" && method == http.MethodDelete:
+		return access.Owner
+	}
+	return access.Editor
+}
+
+// authorize reports whether role on a board or workspace (the scope) is enough
+// for the request and otherwise answers it: callers without any role do not
+// learn that it exists.
+func authorize(w http.ResponseWriter, r *http.Request, scope string, role, required access.Role) bool {
+	if role.Allows(required) {
+		return true
+	}
+	if role == access.None {
+		http.NotFound(w, r)
+		return false
+	}
+	http.Error(w, "this requires the "+string(required)+" role on the "+scope, http.StatusForbidden)
+	return false
+}
+
+// commentOnly reports whether ops only add comments, which commenters may do.
+func commentOnly(ops []patch.Operation) bool {
+	for _, op := range ops {
+		if op.Op != "add" || !strings.HasPrefix(op.Path, "/comments/") || strings.Count(op.Path, "/") != 2 {
+			return false
+		}
+	}
+	return true
+}
+
+// membersResponse lists a board's members along with the caller's own role.
+type membersResponse struct {
+	Role    access.Role     `json:"role"`
+	Open    bool            `json:"open"`
+	Members []access.Member `json:"members"`
+}
+
+func (h *Handler) handleMembers(w http.ResponseWriter, r *http.Request, boardID string, rest []string) {
+	if len(rest) > 1 {
+		http.NotFound(w, r)
+		return
+	}
+	if len(rest) == 0 {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.respondMembers(w, r, boardID, http.StatusOK)
+		return
+	}
+
+	principal, err := url.PathUnescape(rest[0])
+	if err != nil || principal == "" {
+		http.Error(w, "invalid member id", http.StatusBadRequest)
+		return
+	}
+	entry := audit.Entry{Actor: h.actorID(r), BoardID: boardID, Details: map[string]string{"principal": principal}}
+	switch r.Method {
+	case http.MethodPut:
+		var req struct {
+			Role string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		role, ok := access.ParseRole(req.Role)
+		if !ok {
+			http.Error(w, "role must be owner, editor, commenter or viewer", http.StatusBadRequest)
+			return
+		}
+		err = h.access.SetMember(boardID, principal, role)
+		entry.Action, entry.Details["role"] = "member.set", string(role)
+	case http.MethodDelete:
+		err = h.access.RemoveMember(boardID, principal)
+		entry.Action = "member.removed"
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		h.accessError(w, r, err)
+		return
+	}
+	h.record(entry)
+	h.accessChanged(boardID)
+	h.respondMembers(w, r, boardID, http.StatusOK)
+}
+
+func (h *Handler) respondMembers(w http.ResponseWriter, r *http.Request, boardID string, status int) {
+	respondJSON(w, status, membersResponse{Role: h.boardRole(r, boardID), Open: h.openBoard(boardID), Members: h.access.Members(boardID)})
+}
+
+// createdLink is the only response that includes a share link's secret.
+type createdLink struct {
+	access.Link
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+func (h *Handler) handleLinks(w http.ResponseWriter, r *http.Request, boardID string, rest []string) {
+	switch {
+	case len(rest) == 0 && r.Method == http.MethodGet:
+		respondJSON(w, http.StatusOK, h.access.Links(boardID))
+	case len(rest) == 0 && r.Method == http.MethodPost:
+		var req struct {
+			Role      string `json:"role"`
+			ExpiresIn string `json:"expiresIn"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		role, ok := access.ParseRole(req.Role)
+		if !ok {
+			http.Error(w, "role must be editor, commenter or viewer", http.StatusBadRequest)
+			return
+		}
+		var ttl time.Duration
+		if req.ExpiresIn != "" {
+			d, err := time.ParseDuration(req.ExpiresIn)
+			if err != nil || d <= 0 {
+				http.Error(w, "expiresIn must be a positive duration such as 72h", http.StatusBadRequest)
+				return
+			}
+			ttl = d
+		}
+		link, secret, err := h.access.CreateLink(boardID, role, h.actorID(r), ttl)
+		if err != nil {
+			h.accessError(w, r, err)
+			return
+		}
+		details := map[string]string{"link": link.ID, "role": string(link.Role)}
+		if link.ExpiresAt != nil {
+			details["expiresAt"] = link.ExpiresAt.Format(time.RFC3339)
+		}
+		h.record(audit.Entry{Actor: h.actorID(r), Action: "link.created", BoardID: boardID, Details: details})
+		q := url.Values{"board": {boardID}, "share": {secret}}
+		respondJSON(w, http.StatusCreated, createdLink{Link: link, Token: secret, URL: "/?" + q.Encode()})
+	case len(rest) == 1 && r.Method == http.MethodDelete:
+		if err := h.access.RevokeLink(boardID, rest[0]); err != nil {
+			h.accessError(w, r, err)
+			return
+		}
+		h.record(audit.Entry{Actor: h.actorID(r), Action: "link.revoked", BoardID: boardID, Details: map[string]string{"link": rest[0]}})
+		h.accessChanged(boardID)
+		w.WriteHeader(http.StatusNoContent)
+	case len(rest) > 1:
+		http.NotFound(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// accessChanged disconnects sockets that lost access and tells the board's
+// participants who its members are now.
+func (h *Handler) accessChanged(boardID string) {
+	h.hubs.Revalidate(boardID)
+	h.broadcastBoardEvent(boardID, membersUpdated, h.access.Members(boardID))
+}
+
+func (h *Handler) accessError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, access.ErrNotFound):
+		http.NotFound(w, r)
+	case errors.Is(err, access.ErrLastOwner), errors.Is(err, access.ErrOpenBoard):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, access.ErrOwnerLink):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		if h.logger != nil {
+			h.logger.Printf("access error: %v", err)
+		}
+		http.Error(w, "failed to save access list", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"test1/access"
+	"test1/models"
+	"test1/patch"
+)
+
+// createOwnedBoard creates a board as the anonymous participant owner and
+// gives each of members its role on it.
+func (s *testServer) createOwnedBoard(t *testing.T, owner string, members map[string]access.Role) models.Board {
+	t.Helper()
+	resp := s.do(t, http.MethodPost, "/boards", models.Board{
+		Name:  "Plan",
+		Notes: []models.StickyNote{{ID: "n1", Content: "a"}},
+	}, "X-Participant", owner)
+	expectStatus(t, resp, http.StatusCreated)
+	board := decode[models.Board](t, resp)
+	for principal, role := range members {
+		resp := s.do(t, http.MethodPut, "/boards/"+board.ID+"/members/"+principal, map[string]string{"role": string(role)}, "X-Participant", owner)
+		expectStatus(t, resp, http.StatusOK)
+	}
+	return board
+}
+
+func addComment(content string) patch.Operation {
+	value, _ := json.Marshal(models.Comment{ID: "c-" + content, Content: content})
+	return patch.Operation{Op: "add", Path: "/comments/-", Value: value}
+}
+
+func TestViewersCannotWrite(t *testing.T) {
+	s := newTestServer(t)
+	board := s.createOwnedBoard(t, "olive", map[string]access.Role{"vera": access.Viewer})
+	path := "/boards/" + board.ID
+	as := []string{"X-Participant", "vera"}
+
+	expectStatus(t, s.do(t, http.MethodGet, path, nil, as...), http.StatusOK)
+	expectStatus(t, s.do(t, http.MethodGet, path+"/notes", nil, as...), http.StatusOK)
+	for _, resp := range []*http.Response{
+		s.do(t, http.MethodPut, path, models.Board{Name: "Mine"}, append(as, "If-Match", "*")...),
+		s.do(t, http.MethodPost, path+"/notes", models.StickyNote{}, as...),
+		s.do(t, http.MethodPatch, path+"/notes/n1", map[string]string{"content": "b"}, as...),
+		s.do(t, http.MethodDelete, path+"/notes/n1", nil, as...),
+		s.do(t, http.MethodPost, path+"/comments", models.Comment{Content: "hi"}, as...),
+		s.do(t, http.MethodPost, path+"/ops", opsRequest{BaseRevision: board.Revision, Ops: []patch.Operation{addComment("hi")}}, as...),
+	} {
+		expectStatus(t, resp, http.StatusForbidden)
+	}
+}
+
+func TestCommentersCanOnlyAddComments(t *testing.T) {
+	s := newTestServer(t)
+	board := s.createOwnedBoard(t, "olive", map[string]access.Role{"cole": access.Commenter})
+	path := "/boards/" + board.ID
+	as := []string{"X-Participant", "cole"}
+
+	expectStatus(t, s.do(t, http.MethodPost, path+"/comments", models.Comment{Content: "first"}, as...), http.StatusCreated)
+	resp := s.do(t, http.MethodPost, path+"/ops", opsRequest{BaseRevision: board.Revision + 1, Ops: []patch.Operation{addComment("second")}}, as...)
+	expectStatus(t, resp, http.StatusOK)
+
+	edit := patch.Operation{Op: "replace", Path: "/notes/0/content", Value: json.RawMessage(`"b"`)}
+	for _, resp := range []*http.Response{
+		s.do(t, http.MethodPatch, path+"/notes/n1", map[string]string{"content": "b"}, as...),
+		s.do(t, http.MethodPost, path+"/notes", models.StickyNote{}, as...),
+		s.do(t, http.MethodPatch, path+"/comments/c-second", map[string]string{"content": "edited"}, as...),
+		s.do(t, http.MethodPost, path+"/ops", opsRequest{BaseRevision: board.Revision + 2, Ops: []patch.Operation{edit}}, as...),
+		s.do(t, http.MethodPost, path+"/ops", opsRequest{BaseRevision: board.Revision + 2, Ops: []patch.Operation{addComment("third"), edit}}, as...),
+		s.do(t, http.MethodPost, path+"/ops", opsRequest{BaseRevision: board.Revision + 2, Ops: []patch.Operation{
+			{Op: "add", Path: "/comments/0/content", Value: json.RawMessage(`"edited"`)},
+		}}, as...),
+	} {
+		expectStatus(t, resp, http.StatusForbidden)
+	}
+
+	current, _ := s.h.store.GetBoard(board.ID)
+	if len(current.Comments) != 2 || current.Notes[0].Content != "a" {
+		t.Fatalf("expected two comments and an untouched note, got %+v and %+v", current.Comments, current.Notes)
+	}
+}
+
+func TestBoardsAreHiddenFromThoseWithoutARole(t *testing.T) {
+	s := newTestServer(t)
+	board := s.createOwnedBoard(t, "olive", nil)
+	path := "/boards/" + board.ID
+
+	for _, as := range [][]string{{"X-Participant", "stranger"}, nil} {
+		for _, resp := range []*http.Response{
+			s.do(t, http.MethodGet, path, nil, as...),
+			s.do(t, http.MethodGet, path+"/notes", nil, as...),
+			s.do(t, http.MethodPut, path, models.Board{Name: "Mine"}, append(as, "If-Match", "*")...),
+			s.do(t, http.MethodPost, path+"/notes", models.StickyNote{}, as...),
+			s.do(t, http.MethodDelete, path, nil, append(as, "If-Match", "*")...),
+			s.do(t, http.MethodGet, path+"/members", nil, as...),
+		} {
+			expectStatus(t, resp, http.StatusNotFound)
+		}
+	}
+}
+
+func TestOnlyOwnersManageTheBoard(t *testing.T) {
+	s := newTestServer(t)
+	board := s.createOwnedBoard(t, "olive", map[string]access.Role{"eddie": access.Editor})
+	path := "/boards/" + board.ID
+	editor := []string{"X-Participant", "eddie"}
+
+	expectStatus(t, s.do(t, http.MethodPost, path+"/notes", models.StickyNote{Content: "b"}, editor...), http.StatusCreated)
+	for _, resp := range []*http.Response{
+		s.do(t, http.MethodGet, path+"/links", nil, editor...),
+		s.do(t, http.MethodPost, path+"/links", map[string]string{"role": "viewer"}, editor...),
+		s.do(t, http.MethodPut, path+"/members/eddie", map[string]string{"role": "owner"}, editor...),
+		s.do(t, http.MethodDelete, path+"/members/olive", nil, editor...),
+		s.do(t, http.MethodPost, path+"/move", map[string]string{"workspace": ""}, editor...),
+		s.do(t, http.MethodPost, path+"/archive", nil, editor...),
+		s.do(t, http.MethodPost, path+"/unarchive", nil, editor...),
+		s.do(t, http.MethodDelete, path, nil, append(editor, "If-Match", "*")...),
+	} {
+		expectStatus(t, resp, http.StatusForbidden)
+	}
+	expectStatus(t, s.do(t, http.MethodGet, path+"/members", nil, editor...), http.StatusOK)
+
+	owner := []string{"X-Participant", "olive"}
+	expectStatus(t, s.do(t, http.MethodPost, path+"/links", map[string]string{"role": "viewer"}, owner...), http.StatusCreated)
+	expectStatus(t, s.do(t, http.MethodGet, path+"/links", nil, owner...), http.StatusOK)
+	expectStatus(t, s.do(t, http.MethodPost, path+"/archive", nil, owner...), http.StatusOK)
+	expectStatus(t, s.do(t, http.MethodPost, path+"/unarchive", nil, owner...), http.StatusOK)
+	expectStatus(t, s.do(t, http.MethodDelete, path, nil, append(owner, "If-Match", "*")...), http.StatusNoContent)
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+
+	"test1/models"
+	"test1/status"
+)
+
+// scenarioOutcome serves GET /boards/{id}/scenarios/{scenarioId}/outcome: the
+// board's causal model propagated under a saved scenario, with the nodes whose
+// status changed from the baseline.
+func (h *Handler) scenarioOutcome(w http.ResponseWriter, r *http.Request, boardID, scenarioID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	board, ok := h.store.GetBoard(boardID)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	for _, scenario := range board.Scenarios {
+		if scenario.ID == scenarioID {
+			h.respondOutcome(w, board, scenario)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// whatIf serves POST /boards/{id}/what-if, which runs a scenario given in the
+// body without saving it. Viewers may run one, since the board is not changed.
+func (h *Handler) whatIf(w http.ResponseWriter, r *http.Request, boardID string) {
+	var scenario models.Scenario
+	if err := json.NewDecoder(r.Body).Decode(&scenario); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	board, ok := h.store.GetBoard(boardID)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	h.respondOutcome(w, board, scenario)
+}
+
+func (h *Handler) respondOutcome(w http.ResponseWriter, board models.Board, scenario models.Scenario) {
+	w.Header().Set("ETag", boardETag(board.Revision))
+	respondJSON(w, http.StatusOK, status.WhatIf(board, scenario))
+}
+
+const (
+	defaultDriverPaths = 5
+	maxDriverPaths     = 50
+)
+
+// nodeDrivers serves GET /boards/{id}/causal-nodes/{nodeId}/drivers: the
+// nodes upstream of a goal ranked by their influence on it, and the strongest
+// paths into it (?paths=, default 5, at most 50) for the UI to highlight.
+func (h *Handler) nodeDrivers(w http.ResponseWriter, r *http.Request, boardID, nodeID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	maxPaths := defaultDriverPaths
+	if v := r.URL.Query().Get("paths"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxDriverPaths {
+			http.Error(w, "paths must be between 0 and "+strconv.Itoa(maxDriverPaths), http.StatusBadRequest)
+			return
+		}
+		maxPaths = n
+	}
+	board, ok := h.store.GetBoard(boardID)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	analysis, ok := status.Drivers(board, nodeID, maxPaths)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("ETag", boardETag(board.Revision))
+	respondJSON(w, http.StatusOK, analysis)
+}
+
+// simulate serves GET /boards/{id}/simulation: the causal model stepped
+// through ?ticks= time steps (default 50, at most 10000) with each node's
+// values and the behaviour they show.
+func (h *Handler) simulate(w http.ResponseWriter, r *http.Request, boardID string) {
+	ticks := status.DefaultTicks
+	if v := r.URL.Query().Get("ticks"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > status.MaxTicks {
+			http.Error(w, "ticks must be between 0 and "+strconv.Itoa(status.MaxTicks), http.StatusBadRequest)
+			return
+		}
+		ticks = n
+	}
+	board, ok := h.store.GetBoard(boardID)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("ETag", boardETag(board.Revision))
+	respondJSON(w, http.StatusOK, status.Simulate(board, ticks))
+}
+
+// uncertainty serves GET /boards/{id}/uncertainty: the causal model
+// propagated ?runs= times (default 2000, at most 10000) with guessed statuses
+// and weights drawn at random, giving each node's chance of every status and
+// the interval holding the middle ?level= of its scores (default 0.9).
+// ?seed= repeats an earlier analysis.
+func (h *Handler) uncertainty(w http.ResponseWriter, r *http.Request, boardID string) {
+	query := r.URL.Query()
+	runs := status.DefaultRuns
+	if v := query.Get("runs"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > status.MaxRuns {
+			http.Error(w, "runs must be between 1 and "+strconv.Itoa(status.MaxRuns), http.StatusBadRequest)
+			return
+		}
+		runs = n
+	}
+	level := status.DefaultLevel
+	if v := query.Get("level"); v != "" {
+		l, err := strconv.ParseFloat(v, 64)
+		if err != nil || !(l > 0 && l < 1) {
+			http.Error(w, "level must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+		level = l
+	}
+	// Seeds stay within what JavaScript numbers hold exactly.
+	seed := rand.Uint64N(1 << 53)
+	if v := query.Get("seed"); v != "" {
+		s, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid seed", http.StatusBadRequest)
+			return
+		}
+		seed = s
+	}
+	board, ok := h.store.GetBoard(boardID)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("ETag", boardETag(board.Revision))
+	respondJSON(w, http.StatusOK, status.Analyze(board, runs, level, seed))
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"test1/audit"
+	"test1/auth"
+	"test1/history"
+	"test1/models"
+)
+
+// WithAudit records changes in log instead of an in-memory audit log. admins
+// are the user IDs or email addresses of the signed-in users who may read it.
+func WithAudit(log *audit.Log, admins ...string) Option {
+	return func(h *Handler) {
+		h.audit = log
+		h.admins = make(map[string]bool, len(admins))
+		for _, admin := range admins {
+			if admin = strings.TrimSpace(admin); admin != "" {
+				h.admins[admin] = true
+			}
+		}
+	}
+}
+
+// maxAuditPage caps the entries returned by one GET /admin/audit.
+const maxAuditPage = 1000
+
+// record appends an entry to the audit log. A change that has been made is not
+// undone when it cannot be recorded; the failure is logged instead.
+func (h *Handler) record(e audit.Entry) {
+	if _, err := h.audit.Append(e); err != nil && h.logger != nil {
+		h.logger.Printf("failed to record %s by %q in the audit log: %v", e.Action, e.Actor, err)
+	}
+}
+
+// changedElements lists the IDs of the items that differ between two versions of a board.
+func changedElements(before, after models.Board) []string {
+	diff, err := history.Diff(before, after)
+	if err != nil {
+		return nil
+	}
+	return diff.ItemIDs()
+}
+
+// isAdmin reports whether the request comes from a signed-in administrator.
+// Participant IDs are claimed rather than proven, so they never count.
+func (h *Handler) isAdmin(r *http.Request) bool {
+	id, ok := auth.FromContext(r.Context())
+	return ok && (h.admins[id.UserID] || (id.Email != "" && h.admins[id.Email]))
+}
+
+// handleAudit serves the audit log to administrators:
+//
+//	GET /admin/audit         entries as a JSON array, oldest first; a Link header
+//	                         with rel="next" points at the next page
+//	GET /admin/audit/export  every matching entry as JSON Lines
+//
+// Both take board, actor, action (a prefix such as "member."), element,
+// since and until (RFC 3339) and after (a sequence number); the array also
+// takes limit (default 100, at most 1000).
+func (h *Handler) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.isAdmin(r) {
+		http.Error(w, "the audit log is only available to administrators", http.StatusForbidden)
+		return
+	}
+	q, err := parseAuditQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch strings.TrimPrefix(r.URL.Path, "/admin/audit") {
+	case "", "/":
+		entries, more := h.audit.Query(q)
+		if more {
+			next := r.URL.Query()
+			next.Set("after", strconv.FormatInt(entries[len(entries)-1].Seq, 10))
+			w.Header().Set("Link", "<"+r.URL.Path+"?"+next.Encode()+`>; rel="next"`)
+		}
+		respondJSON(w, http.StatusOK, entries)
+	case "/export":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+		if err := h.audit.Export(w, q); err != nil && h.logger != nil {
+			h.logger.Printf("audit export failed: %v", err)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func parseAuditQuery(r *http.Request) (audit.Query, error) {
+	v := r.URL.Query()
+	q := audit.Query{BoardID: v.Get("board"), Actor: v.Get("actor"), Action: v.Get("action"), Element: v.Get("element"), Limit: 100}
+	for name, dst := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if s := v.Get(name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return q, errors.New(name + " must be an RFC 3339 time")
+			}
+			*dst = t
+		}
+	}
+	if s := v.Get("after"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 0 {
+			return q, errors.New("after must be a sequence number")
+		}
+		q.After = n
+	}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxAuditPage {
+			return q, errors.New("limit must be between 1 and " + strconv.Itoa(maxAuditPage))
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
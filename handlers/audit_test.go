@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"test1/audit"
+	"test1/auth"
+	"test1/crdt"
+	"test1/models"
+	"test1/patch"
+)
+
+// auditServer is a test server with the audit log readable by one signed-in
+// administrator; admin and user hold bearer headers for it and another account.
+type auditServer struct {
+	*testServer
+	admin, user []string
+}
+
+func newAuditServer(t *testing.T) *auditServer {
+	t.Helper()
+	svc, err := auth.NewService(auth.DefaultOptions())
+	if err != nil {
+		t.Fatalf("new auth service: %v", err)
+	}
+	bearer := func(email string) []string {
+		user, err := svc.Register("", email, "secret")
+		if err != nil {
+			t.Fatalf("register %s: %v", email, err)
+		}
+		_, secret, err := svc.CreateToken(user.ID, "test", time.Hour)
+		if err != nil {
+			t.Fatalf("create token: %v", err)
+		}
+		return []string{"Authorization", "Bearer " + secret}
+	}
+	log, _ := audit.Open("")
+	s := newTestServer(t, WithAuth(svc, false), WithAudit(log, "admin@example.com"))
+	return &auditServer{testServer: s, admin: bearer("admin@example.com"), user: bearer("user@example.com")}
+}
+
+// entries queries the audit log as the administrator.
+func (s *auditServer) entries(t *testing.T, query string) []audit.Entry {
+	t.Helper()
+	resp := s.do(t, http.MethodGet, "/admin/audit?"+query, nil, s.admin...)
+	expectStatus(t, resp, http.StatusOK)
+	return decode[[]audit.Entry](t, resp)
+}
+
+func actions(entries []audit.Entry) []string {
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Action)
+	}
+	return names
+}
+
+func TestAuditLogIsOnlyForAdministrators(t *testing.T) {
+	s := newAuditServer(t)
+	for _, path := range []string{"/admin/audit", "/admin/audit/export"} {
+		expectStatus(t, s.do(t, http.MethodGet, path, nil), http.StatusForbidden)
+		expectStatus(t, s.do(t, http.MethodGet, path, nil, "X-Participant", "admin@example.com"), http.StatusForbidden)
+		expectStatus(t, s.do(t, http.MethodGet, path, nil, s.user...), http.StatusForbidden)
+		expectStatus(t, s.do(t, http.MethodGet, path, nil, s.admin...), http.StatusOK)
+	}
+}
+
+func TestAuditLogFiltersPagesAndExports(t *testing.T) {
+	s := newAuditServer(t)
+	start := time.Now().UTC().Add(-time.Second)
+	plan := s.createBoard(t, models.Board{Name: "Plan"})
+	other := s.createBoard(t, models.Board{Name: "Other"})
+	for _, id := range []string{"n1", "n2", "n3"} {
+		expectStatus(t, s.do(t, http.MethodPost, "/boards/"+plan.ID+"/notes", models.StickyNote{ID: id}, "X-Participant", "pat"), http.StatusCreated)
+	}
+	expectStatus(t, s.do(t, http.MethodPatch, "/boards/"+plan.ID+"/notes/n1", map[string]string{"content": "b"}, "X-Participant", "sam"), http.StatusOK)
+	expectStatus(t, s.do(t, http.MethodPost, "/boards/"+other.ID+"/shapes", models.Shape{ID: "s1"}), http.StatusCreated)
+
+	if got := actions(s.entries(t, "board="+plan.ID)); !slices.Equal(got, []string{"board.created", "note.created", "note.created", "note.created", "note.updated"}) {
+		t.Fatalf("unexpected entries for the board: %v", got)
+	}
+	if got := s.entries(t, "actor=sam"); len(got) != 1 || got[0].Action != "note.updated" {
+		t.Fatalf("expected sam's one entry, got %+v", got)
+	}
+	if got := actions(s.entries(t, "action=note.")); len(got) != 4 {
+		t.Fatalf("expected the four note entries, got %v", got)
+	}
+	if got := actions(s.entries(t, "element=n1")); !slices.Equal(got, []string{"note.created", "note.updated"}) {
+		t.Fatalf("expected the entries touching n1, got %v", got)
+	}
+	if got := s.entries(t, "until="+url.QueryEscape(start.Format(time.RFC3339))); len(got) != 0 {
+		t.Fatalf("expected nothing before the test started, got %+v", got)
+	}
+	if got := s.entries(t, "since="+url.QueryEscape(start.Format(time.RFC3339))); len(got) != 7 {
+		t.Fatalf("expected every entry since the test started, got %+v", got)
+	}
+	expectStatus(t, s.do(t, http.MethodGet, "/admin/audit?since=yesterday", nil, s.admin...), http.StatusBadRequest)
+	expectStatus(t, s.do(t, http.MethodGet, "/admin/audit?limit=0", nil, s.admin...), http.StatusBadRequest)
+
+	next := regexp.MustCompile(`^<([^>]+)>; rel="next"$`)
+	var paged []audit.Entry
+	for path, pages := "/admin/audit?limit=3", 0; path != ""; pages++ {
+		if pages > 3 {
+			t.Fatal("expected paging to end")
+		}
+		resp := s.do(t, http.MethodGet, path, nil, s.admin...)
+		expectStatus(t, resp, http.StatusOK)
+		page := decode[[]audit.Entry](t, resp)
+		if len(page) > 3 {
+			t.Fatalf("expected at most three entries a page, got %d", len(page))
+		}
+		paged = append(paged, page...)
+		path = ""
+		if m := next.FindStringSubmatch(resp.Header.Get("Link")); m != nil {
+			path = m[1]
+		}
+	}
+	all := s.entries(t, "")
+	if len(paged) != len(all) || len(all) != 7 {
+		t.Fatalf("expected paging to return all %d entries once, got %d", len(all), len(paged))
+	}
+	for i := range all {
+		if paged[i].Seq != all[i].Seq {
+			t.Fatalf("expected paged entries in order, got %d at %d", paged[i].Seq, i)
+		}
+	}
+
+	resp := s.do(t, http.MethodGet, "/admin/audit/export?board="+plan.ID, nil, s.admin...)
+	expectStatus(t, resp, http.StatusOK)
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("expected JSON Lines, got %q", ct)
+	}
+	var exported []audit.Entry
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var e audit.Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("decode exported line %q: %v", scanner.Text(), err)
+		}
+		exported = append(exported, e)
+	}
+	if len(exported) != 5 || exported[0].Action != "board.created" || exported[4].Action != "note.updated" {
+		t.Fatalf("expected the board's five entries exported, got %+v", exported)
+	}
+}
+
+func TestEveryWriteIsAuditedWithTheElementsItTouched(t *testing.T) {
+	s := newAuditServer(t)
+	as := []string{"X-Participant", "pat"}
+	board := s.createBoard(t, models.Board{
+		Notes:       []models.StickyNote{{ID: "n1", Content: "a"}},
+		CausalNodes: []models.CausalNode{{ID: "a"}, {ID: "b"}},
+		CausalLinks: []models.CausalLink{{ID: "ab", From: "a", To: "b", Weight: 1}},
+	})
+	path := "/boards/" + board.ID
+
+	writes := []struct {
+		name     string
+		send     func() *http.Response
+		status   int
+		action   string
+		elements []string
+	}{
+		{"create item", func() *http.Response {
+			return s.do(t, http.MethodPost, path+"/notes", models.StickyNote{ID: "n2"}, as...)
+		}, http.StatusCreated, "note.created", []string{"n2"}},
+		{"patch item", func() *http.Response {
+			return s.do(t, http.MethodPatch, path+"/notes/n2", map[string]string{"content": "b"}, as...)
+		}, http.StatusOK, "note.updated", []string{"n2"}},
+		{"delete node", func() *http.Response {
+			return s.do(t, http.MethodDelete, path+"/causal-nodes/a", nil, as...)
+		}, http.StatusNoContent, "causalNode.deleted", []string{"a", "ab"}},
+		{"update board", func() *http.Response {
+			current, _ := s.h.store.GetBoard(board.ID)
+			current.Notes[0].Content = "changed"
+			return s.do(t, http.MethodPut, path, current, append(as, "If-Match", "*")...)
+		}, http.StatusOK, "board.updated", []string{"n1"}},
+		{"ops", func() *http.Response {
+			current, _ := s.h.store.GetBoard(board.ID)
+			return s.do(t, http.MethodPost, path+"/ops", opsRequest{BaseRevision: current.Revision, Ops: []patch.Operation{
+				{Op: "remove", Path: "/notes/1"},
+			}}, as...)
+		}, http.StatusOK, "board.ops", []string{"n2"}},
+		{"text", func() *http.Response {
+			return s.do(t, http.MethodPost, path+"/notes/n1/text", textRequest{Ops: []crdt.Op{
+				{Kind: crdt.OpInsert, ID: crdt.ID{Counter: 100, Site: "pat"}, Value: "x"},
+			}}, as...)
+		}, http.StatusOK, "content.delta", []string{"n1"}},
+		{"undo", func() *http.Response {
+			return s.do(t, http.MethodPost, path+"/undo", nil, as...)
+		}, http.StatusOK, "board.undo", []string{"n1"}},
+		{"restore version", func() *http.Response {
+			return s.do(t, http.MethodPost, path+"/versions/1/restore", nil, as...)
+		}, http.StatusOK, "board.restored", []string{"a", "ab", "n1"}},
+	}
+	for _, w := range writes {
+		expectStatus(t, w.send(), w.status)
+		entries := s.entries(t, "board="+board.ID)
+		last := entries[len(entries)-1]
+		elements := slices.Sorted(slices.Values(last.Elements))
+		if last.Action != w.action || !slices.Equal(elements, w.elements) || last.Actor != "pat" {
+			t.Fatalf("%s: expected %s by pat touching %v, got %s by %q touching %v", w.name, w.action, w.elements, last.Action, last.Actor, last.Elements)
+		}
+		current, _ := s.h.store.GetBoard(board.ID)
+		if last.Revision != current.Revision {
+			t.Fatalf("%s: expected the entry at revision %d, got %d", w.name, current.Revision, last.Revision)
+		}
+	}
+
+	expectStatus(t, s.do(t, http.MethodPost, path+"/archive", nil, as...), http.StatusOK)
+	expectStatus(t, s.do(t, http.MethodPost, path+"/unarchive", nil, as...), http.StatusOK)
+	expectStatus(t, s.do(t, http.MethodDelete, path, nil, append(as, "If-Match", "*")...), http.StatusNoContent)
+	expectStatus(t, s.do(t, http.MethodPost, "/trash/"+board.ID+"/restore", nil, as...), http.StatusOK)
+	entries := s.entries(t, "board="+board.ID)
+	want := []string{"board.archived", "board.unarchived", "board.trashed", "board.untrashed"}
+	if got := actions(entries[len(entries)-len(want):]); !slices.Equal(got, want) {
+		t.Fatalf("expected lifecycle changes to be audited, got %v", got)
+	}
+	if entries[0].Action != "board.created" {
+		t.Fatalf("expected the board's creation first, got %s", entries[0].Action)
+	}
+}
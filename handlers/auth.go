@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+
+	"test1/auth"
+	"test1/models"
+	"test1/presence"
+)
+
+// WithAuth authenticates requests with svc. Writes are then attributed to the
+// signed-in user rather than to what the client claims; with required set,
+// the board API refuses anonymous requests and the page asks to sign in.
+func WithAuth(svc *auth.Service, required bool) Option {
+	return func(h *Handler) {
+		h.auth = svc
+		h.authRequired = required
+	}
+}
+
+// actorID identifies the participant making a request: the signed-in user,
+// or else the X-Participant the client names itself with. Anonymous clients
+// cannot take the ID of an account.
+func (h *Handler) actorID(r *http.Request) string {
+	if id, ok := auth.FromContext(r.Context()); ok {
+		return id.UserID
+	}
+	return h.claimable(r.Header.Get("X-Participant"))
+}
+
+// cursorSender is who cursor moves of the request count against for rate
+// limiting: the signed-in user, or else the remote address, since anonymous
+// clients pick their cursor IDs themselves.
+func cursorSender(r *http.Request) string {
+	if id, ok := auth.FromContext(r.Context()); ok {
+		return "user:" + id.UserID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// claimable returns id unless it belongs to an account, in which case an
+// anonymous client may not use it and it is dropped.
+func (h *Handler) claimable(id string) string {
+	if h.auth != nil && id != "" && h.auth.IsUser(id) {
+		return ""
+	}
+	return id
+}
+
+// connectingParticipant identifies who an event stream or socket belongs to.
+// EventSource and WebSocket cannot send headers, so anonymous participants
+// name themselves in the query; signed-in users are shown by their account name.
+func (h *Handler) connectingParticipant(r *http.Request) (string, presence.Update) {
+	update := presenceFromQuery(r)
+	if id, ok := auth.FromContext(r.Context()); ok {
+		update.Label = id.Name
+		return id.UserID, update
+	}
+	participant := r.URL.Query().Get("participant")
+	if participant == "" {
+		participant = r.Header.Get("X-Participant")
+	}
+	return h.claimable(participant), update
+}
+
+// authorName is the name comments written by the request are stamped with,
+// empty for anonymous requests.
+func authorName(r *http.Request) string {
+	if id, ok := auth.FromContext(r.Context()); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// stampComments attributes comments to a signed-in author: comments new to the
+// board get author and existing ones keep the author they had, so nobody can
+// post or rewrite a comment in someone else's name. before is the board's
+// comments prior to the write. Anonymous writes (author == "") are left as sent.
+// It reports whether any author had to be changed.
+func stampComments(before []models.Comment, b *models.Board, author string) bool {
+	if author == "" {
+		return false
+	}
+	authors := make(map[string]string, len(before))
+	for _, c := range before {
+		authors[c.ID] = c.Author
+	}
+	changed := false
+	for i := range b.Comments {
+		want, ok := authors[b.Comments[i].ID]
+		if !ok {
+			want = author
+		}
+		if b.Comments[i].Author != want {
+			b.Comments[i].Author = want
+			changed = true
+		}
+	}
+	return changed
+}
+
+// stampCursor shows a signed-in user's cursor under their account.
+func stampCursor(cursor *models.Cursor, id auth.Identity, ok bool) {
+	if ok {
+		cursor.ID = id.UserID
+		cursor.Label = id.Name
+	}
+}
+
+// serveLogin serves the sign-in page.
+func (h *Handler) serveLogin(w http.ResponseWriter, r *http.Request) {
+	if h.auth == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	setPageHeaders(w)
+	http.ServeFileFS(w, r, staticFS, "login.html")
+}
@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"test1/models"
+	"test1/status"
+	"test1/storage"
+)
+
+// requestError carries an HTTP status out of a store mutation callback.
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e *requestError) Error() string { return e.message }
+
+func newRequestError(status int, message string) error {
+	return &requestError{status: status, message: message}
+}
+
+// collection describes one list of board items that can be edited item by item
+// under /boards/{id}/{path}/{itemId}.
+type collection struct {
+	path   string
+	event  string
+	causal bool
+	items  itemList
+}
+
+// itemList performs item operations on one slice of a board.
+type itemList interface {
+	list(board models.Board) interface{}
+	get(board models.Board, id string) (interface{}, bool)
+	create(board *models.Board, body []byte) (string, interface{}, error)
+	patch(board *models.Board, id string, body []byte) (interface{}, error)
+	remove(board *models.Board, id string) error
+}
+
+var collections = map[string]collection{
+	"shapes":       {path: "shapes", event: "shape", items: sliceOf(func(b *models.Board) *[]models.Shape { return &b.Shapes }, func(s *models.Shape) *string { return &s.ID })},
+	"strokes":      {path: "strokes", event: "stroke", items: sliceOf(func(b *models.Board) *[]models.Stroke { return &b.Strokes }, func(s *models.Stroke) *string { return &s.ID })},
+	"texts":        {path: "texts", event: "text", items: sliceOf(func(b *models.Board) *[]models.TextItem { return &b.Texts }, func(t *models.TextItem) *string { return &t.ID })},
+	"notes":        {path: "notes", event: "note", items: sliceOf(func(b *models.Board) *[]models.StickyNote { return &b.Notes }, func(n *models.StickyNote) *string { return &n.ID })},
+	"connectors":   {path: "connectors", event: "connector", items: sliceOf(func(b *models.Board) *[]models.Connector { return &b.Connectors }, func(c *models.Connector) *string { return &c.ID })},
+	"causal-nodes": {path: "causal-nodes", event: "causalNode", causal: true, items: sliceOf(func(b *models.Board) *[]models.CausalNode { return &b.CausalNodes }, func(n *models.CausalNode) *string { return &n.ID })},
+	"causal-links": {path: "causal-links", event: "causalLink", causal: true, items: sliceOf(func(b *models.Board) *[]models.CausalLink { return &b.CausalLinks }, func(l *models.CausalLink) *string { return &l.ID })},
+	"comments":     {path: "comments", event: "comment", items: sliceOf(func(b *models.Board) *[]models.Comment { return &b.Comments }, func(c *models.Comment) *string { return &c.ID })},
+	"scenarios":    {path: "scenarios", event: "scenario", items: sliceOf(func(b *models.Board) *[]models.Scenario { return &b.Scenarios }, func(s *models.Scenario) *string { return &s.ID })},
+}
+
+// sliceItems implements itemList for any board slice whose items carry a string ID.
+type sliceItems[T any] struct {
+	slice func(b *models.Board) *[]T
+	id    func(item *T) *string
+}
+
+func sliceOf[T any](slice func(b *models.Board) *[]T, id func(item *T) *string) itemList {
+	return sliceItems[T]{slice: slice, id: id}
+}
+
+func (s sliceItems[T]) list(board models.Board) interface{} {
+	items := *s.slice(&board)
+	if items == nil {
+		items = []T{}
+	}
+	return items
+}
+
+func (s sliceItems[T]) index(board *models.Board, id string) int {
+	items := *s.slice(board)
+	for i := range items {
+		if *s.id(&items[i]) == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s sliceItems[T]) get(board models.Board, id string) (interface{}, bool) {
+	i := s.index(&board, id)
+	if i < 0 {
+		return nil, false
+	}
+	return (*s.slice(&board))[i], true
+}
+
+func (s sliceItems[T]) create(board *models.Board, body []byte) (string, interface{}, error) {
+	var item T
+	if err := json.Unmarshal(body, &item); err != nil {
+		return "", nil, newRequestError(http.StatusBadRequest, "invalid request body")
+	}
+	id := s.id(&item)
+	if *id == "" {
+		*id = storage.NewID()
+	}
+	if s.index(board, *id) >= 0 {
+		return "", nil, newRequestError(http.StatusConflict, "item already exists")
+	}
+	items := s.slice(board)
+	*items = append(*items, item)
+	return *id, item, nil
+}
+
+// patch merges the JSON body into the existing item: fields missing from the body keep their values.
+func (s sliceItems[T]) patch(board *models.Board, id string, body []byte) (interface{}, error) {
+	i := s.index(board, id)
+	if i < 0 {
+		return nil, newRequestError(http.StatusNotFound, "item not found")
+	}
+	item := (*s.slice(board))[i]
+	if err := json.Unmarshal(body, &item); err != nil {
+		return nil, newRequestError(http.StatusBadRequest, "invalid request body")
+	}
+	*s.id(&item) = id
+	(*s.slice(board))[i] = item
+	return item, nil
+}
+
+func (s sliceItems[T]) remove(board *models.Board, id string) error {
+	i := s.index(board, id)
+	if i < 0 {
+		return newRequestError(http.StatusNotFound, "item not found")
+	}
+	items := s.slice(board)
+	*items = append((*items)[:i], (*items)[i+1:]...)
+	return nil
+}
+
+// handleCollection serves /boards/{id}/{collection} and /boards/{id}/{collection}/{itemId}.
+func (h *Handler) handleCollection(w http.ResponseWriter, r *http.Request, boardID string, coll collection, itemID string) {
+	if itemID == "" {
+		switch r.Method {
+		case http.MethodGet:
+			board, ok := h.store.GetBoard(boardID)
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			respondJSON(w, http.StatusOK, coll.items.list(board))
+		case http.MethodPost:
+			h.createItem(w, r, boardID, coll)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		board, ok := h.store.GetBoard(boardID)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		item, ok := coll.items.get(board, itemID)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		respondJSON(w, http.StatusOK, item)
+	case http.MethodPatch:
+		h.patchItem(w, r, boardID, coll, itemID)
+	case http.MethodDelete:
+		h.deleteItem(w, r, boardID, coll, itemID)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) createItem(w http.ResponseWriter, r *http.Request, boardID string, coll collection) {
+	expected, body, ok := readItemRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var itemID string
+	board, err := h.mutateBoard(boardID, func(b *models.Board) error {
+		if err := expectRevision(b, expected); err != nil {
+			return err
+		}
+		before := append([]models.Comment(nil), b.Comments...)
+		id, _, err := coll.items.create(b, body)
+		if err != nil {
+			return err
+		}
+		stampComments(before, b, authorName(r))
+		itemID = id
+		if coll.causal {
+			*b = status.Propagate(*b)
+		}
+		return nil
+	})
+	if err != nil {
+		h.itemError(w, r, err)
+		return
+	}
+
+	item, _ := coll.items.get(board, itemID)
+	h.committed(board, h.actorID(r), coll.event+".created", []string{itemID})
+	h.broadcastBoardChange(board, coll.event+".created", item)
+	h.broadcastCausalUpdate(board, coll)
+	w.Header().Set("ETag", boardETag(board.Revision))
+	respondJSON(w, http.StatusCreated, item)
+}
+
+func (h *Handler) patchItem(w http.ResponseWriter, r *http.Request, boardID string, coll collection, itemID string) {
+	expected, body, ok := readItemRequest(w, r)
+	if !ok {
+		return
+	}
+
+	board, err := h.mutateBoard(boardID, func(b *models.Board) error {
+		if err := expectRevision(b, expected); err != nil {
+			return err
+		}
+		before := append([]models.Comment(nil), b.Comments...)
+		if _, err := coll.items.patch(b, itemID, body); err != nil {
+			return err
+		}
+		stampComments(before, b, authorName(r))
+		if coll.causal {
+			*b = status.Propagate(*b)
+		}
+		return nil
+	})
+	if err != nil {
+		h.itemError(w, r, err)
+		return
+	}
+
+	item, _ := coll.items.get(board, itemID)
+	h.committed(board, h.actorID(r), coll.event+".updated", []string{itemID})
+	h.broadcastBoardChange(board, coll.event+".updated", item)
+	h.broadcastCausalUpdate(board, coll)
+	w.Header().Set("ETag", boardETag(board.Revision))
+	respondJSON(w, http.StatusOK, item)
+}
+
+func (h *Handler) deleteItem(w http.ResponseWriter, r *http.Request, boardID string, coll collection, itemID string) {
+	expected, _, ok := readItemRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var removedLinks []string
+	board, err := h.mutateBoard(boardID, func(b *models.Board) error {
+		if err := expectRevision(b, expected); err != nil {
+			return err
+		}
+		if err := coll.items.remove(b, itemID); err != nil {
+			return err
+		}
+		if coll.path == "causal-nodes" {
+			removedLinks = removeDanglingLinks(b, itemID)
+		}
+		if coll.causal {
+			*b = status.Propagate(*b)
+		}
+		return nil
+	})
+	if err != nil {
+		h.itemError(w, r, err)
+		return
+	}
+
+	h.committed(board, h.actorID(r), coll.event+".deleted", append([]string{itemID}, removedLinks...))
+	h.broadcastBoardChange(board, coll.event+".deleted", map[string]string{"id": itemID})
+	for _, linkID := range removedLinks {
+		h.broadcastBoardChange(board, "causalLink.deleted", map[string]string{"id": linkID})
+	}
+	h.broadcastCausalUpdate(board, coll)
+	w.Header().Set("ETag", boardETag(board.Revision))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readItemRequest reads the optional If-Match revision and the request body of an item write.
+func readItemRequest(w http.ResponseWriter, r *http.Request) (int64, []byte, bool) {
+	expected, _, err := ifMatchRevision(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return 0, nil, false
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return 0, nil, false
+	}
+	return expected, body, true
+}
+
+// itemError reports item write failures; item writes only check revisions through If-Match.
+func (h *Handler) itemError(w http.ResponseWriter, r *http.Request, err error) {
+	if !conflictError(w, err, http.StatusPreconditionFailed) {
+		h.storeError(w, r, err)
+	}
+}
+
+// causalUpdate is the payload of a causalNodes.recomputed event.
+type causalUpdate struct {
+	Nodes          []models.CausalNode   `json:"nodes"`
+	UnsettledLoops []models.FeedbackLoop `json:"unsettledLoops"`
+}
+
+// broadcastCausalUpdate publishes the recomputed causal nodes, and the feedback
+// loops that did not settle, after a change that may have moved downstream statuses.
+func (h *Handler) broadcastCausalUpdate(board models.Board, coll collection) {
+	if !coll.causal {
+		return
+	}
+	h.broadcastBoardChange(board, "causalNodes.recomputed", causalUpdate{Nodes: board.CausalNodes, UnsettledLoops: board.UnsettledLoops})
+}
+
+// removeDanglingLinks drops causal links touching a deleted node and returns their IDs.
+func removeDanglingLinks(board *models.Board, nodeID string) []string {
+	var removed []string
+	kept := board.CausalLinks[:0]
+	for _, link := range board.CausalLinks {
+		if link.From == nodeID || link.To == nodeID {
+			removed = append(removed, link.ID)
+			continue
+		}
+		kept = append(kept, link)
+	}
+	board.CausalLinks = kept
+	return removed
+}
+
+// writeRequestError reports err when it was raised by request validation.
+func writeRequestError(w http.ResponseWriter, err error) bool {
+	var reqErr *requestError
+	if !errors.As(err, &reqErr) {
+		return false
+	}
+	http.Error(w, reqErr.message, reqErr.status)
+	return true
+}
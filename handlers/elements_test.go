@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"test1/models"
+)
+
+func TestItemsAreEditedOneByOneWithTheirOwnEvents(t *testing.T) {
+	s := newTestServer(t)
+	board := s.createBoard(t, models.Board{Name: "Plan"})
+	notes := "/boards/" + board.ID + "/notes"
+
+	resp := s.do(t, http.MethodPost, notes, models.StickyNote{ID: "n1", Content: "draft", Color: "yellow"})
+	expectStatus(t, resp, http.StatusCreated)
+	if created := decode[models.StickyNote](t, resp); created.Content != "draft" {
+		t.Fatalf("expected the created note back, got %+v", created)
+	}
+	if resp.Header.Get("ETag") != boardETag(board.Revision+1) {
+		t.Fatalf("expected the new revision as ETag, got %q", resp.Header.Get("ETag"))
+	}
+
+	resp = s.do(t, http.MethodPatch, notes+"/n1", map[string]string{"content": "final"})
+	expectStatus(t, resp, http.StatusOK)
+	if patched := decode[models.StickyNote](t, resp); patched.Content != "final" || patched.Color != "yellow" {
+		t.Fatalf("expected the patch to keep fields it leaves out, got %+v", patched)
+	}
+
+	resp = s.do(t, http.MethodGet, notes, nil)
+	expectStatus(t, resp, http.StatusOK)
+	if list := decode[[]models.StickyNote](t, resp); len(list) != 1 || list[0].Content != "final" {
+		t.Fatalf("expected the one patched note, got %+v", list)
+	}
+
+	expectStatus(t, s.do(t, http.MethodDelete, notes+"/n1", nil), http.StatusNoContent)
+	expectStatus(t, s.do(t, http.MethodGet, notes+"/n1", nil), http.StatusNotFound)
+	expectStatus(t, s.do(t, http.MethodPatch, notes+"/n1", map[string]string{"content": "gone"}), http.StatusNotFound)
+
+	want := []string{"board.created", "note.created", "note.updated", "note.deleted"}
+	if got := s.eventTypes(t, board.ID); !slices.Equal(got, want) {
+		t.Fatalf("expected events %v, got %v", want, got)
+	}
+}
+
+func TestCausalItemsAnnounceRecomputedNodes(t *testing.T) {
+	s := newTestServer(t)
+	board := s.createBoard(t, models.Board{CausalNodes: []models.CausalNode{{ID: "a", Status: "positive"}, {ID: "b"}}})
+
+	resp := s.do(t, http.MethodPost, "/boards/"+board.ID+"/causal-links", models.CausalLink{ID: "l", From: "a", To: "b", Weight: 1})
+	expectStatus(t, resp, http.StatusCreated)
+	expectStatus(t, s.do(t, http.MethodDelete, "/boards/"+board.ID+"/causal-nodes/a", nil), http.StatusNoContent)
+
+	want := []string{"board.created", "causalLink.created", "causalNodes.recomputed", "causalNode.deleted", "causalLink.deleted", "causalNodes.recomputed"}
+	if got := s.eventTypes(t, board.ID); !slices.Equal(got, want) {
+		t.Fatalf("expected events %v, got %v", want, got)
+	}
+}
+
+func TestItemWritesWithAStaleIfMatchFail(t *testing.T) {
+	s := newTestServer(t)
+	board := s.createBoard(t, models.Board{Notes: []models.StickyNote{{ID: "n1", Content: "a"}}})
+	notes := "/boards/" + board.ID + "/notes"
+	stale := boardETag(board.Revision)
+	expectStatus(t, s.do(t, http.MethodPatch, notes+"/n1", map[string]string{"content": "b"}, "If-Match", stale), http.StatusOK)
+
+	for _, resp := range []*http.Response{
+		s.do(t, http.MethodPost, notes, models.StickyNote{ID: "n2"}, "If-Match", stale),
+		s.do(t, http.MethodPatch, notes+"/n1", map[string]string{"content": "c"}, "If-Match", stale),
+		s.do(t, http.MethodDelete, notes+"/n1", nil, "If-Match", stale),
+	} {
+		expectStatus(t, resp, http.StatusPreconditionFailed)
+		if resp.Header.Get("ETag") != boardETag(board.Revision+1) {
+			t.Fatalf("expected the current revision as ETag, got %q", resp.Header.Get("ETag"))
+		}
+	}
+
+	current, _ := s.h.store.GetBoard(board.ID)
+	if len(current.Notes) != 1 || current.Notes[0].Content != "b" {
+		t.Fatalf("expected refused writes to leave the notes alone, got %+v", current.Notes)
+	}
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"test1/access"
+	"test1/models"
+)
+
+// resyncEvent tells a client that events were lost and it must reload the board.
+const resyncEvent = "resync.required"
+
+// resyncData explains a resync: events after LastEventID could not be replayed.
+type resyncData struct {
+	LastEventID string `json:"lastEventId"`
+}
+
+// streamBoardEvents serves the board's events as server-sent events. Each frame
+// carries its sequence number as the event ID, so a reconnecting EventSource
+// resumes from Last-Event-ID; when that is no longer possible the stream starts
+// with a resync.required event instead.
+func (h *Handler) streamBoardEvents(w http.ResponseWriter, r *http.Request, boardID string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	lastID := lastEventID(r)
+	messages, cancel, resumed := h.events.Subscribe(boardID, lastID)
+	defer cancel()
+
+	participant, update := h.connectingParticipant(r)
+	if participant != "" {
+		leave := h.presence.Join(boardID, participant, update)
+		defer leave()
+	}
+	share := shareSecret(r)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	// Send a comment to keep the connection alive immediately.
+	if _, err := w.Write([]byte(": connected\nretry: 1000\n\n")); err != nil {
+		return
+	}
+	if !resumed {
+		if _, err := w.Write(sseFrame("", resyncMessage(boardID, lastID))); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case evt, ok := <-messages:
+			if !ok {
+				// Cut off for falling behind; the client reconnects with Last-Event-ID.
+				return
+			}
+			if !h.roleOf(boardID, participant, share).Allows(access.Viewer) {
+				// Access was revoked; the reconnect is refused.
+				return
+			}
+			if _, err := w.Write(sseFrame(evt.ID, evt.Data)); err != nil {
+				return
+			}
+			flusher.Flush()
+			if !h.visible(boardID) {
+				// The board went to the trash; its board.deleted event was the last one.
+				return
+			}
+		}
+	}
+}
+
+// lastEventID reads the Last-Event-ID header, or ?lastEventId= for clients that
+// open a fresh connection.
+func lastEventID(r *http.Request) string {
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		return id
+	}
+	return r.URL.Query().Get("lastEventId")
+}
+
+// sseFrame formats one server-sent event; an empty id leaves the event ID unchanged.
+func sseFrame(id string, data []byte) []byte {
+	frame := make([]byte, 0, len(data)+len(id)+16)
+	if id != "" && !strings.ContainsAny(id, "\r\n") {
+		frame = append(frame, "id: "...)
+		frame = append(frame, id...)
+		frame = append(frame, '\n')
+	}
+	frame = append(frame, "data: "...)
+	frame = append(frame, data...)
+	return append(frame, "\n\n"...)
+}
+
+func resyncMessage(boardID, lastID string) []byte {
+	data, _ := json.Marshal(models.BoardEvent{Type: resyncEvent, BoardID: boardID, Data: resyncData{LastEventID: lastID}})
+	return data
+}
+
+// followEvents feeds a websocket hub. When the hub falls behind and is cut off it
+// resubscribes from the last event it saw, inserting a resync.required event if
+// the gap could not be replayed.
+func (h *Handler) followEvents(boardID string) (<-chan []byte, func()) {
+	out := make(chan []byte)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(out)
+		var last string
+		for {
+			events, cancel, resumed := h.events.Subscribe(boardID, last)
+			if !resumed && !h.deliver(out, done, resyncMessage(boardID, last)) {
+				cancel()
+				return
+			}
+			if !h.relay(events, out, done, &last) {
+				cancel()
+				return
+			}
+			cancel()
+		}
+	}()
+
+	var once sync.Once
+	return out, func() { once.Do(func() { close(done) }) }
+}
+
+// relay passes events on until the subscription is cut off, when it returns
+// true to resubscribe, or until done closes, when it returns false. It keeps
+// the ID of the last event relayed in last.
+func (h *Handler) relay(events <-chan Event, out chan<- []byte, done <-chan struct{}, last *string) bool {
+	for {
+		select {
+		case evt, ok := <-events:
+			if !ok {
+				return true
+			}
+			*last = evt.ID
+			if !h.deliver(out, done, evt.Data) {
+				return false
+			}
+		case <-done:
+			return false
+		}
+	}
+}
+
+func (h *Handler) deliver(out chan<- []byte, done <-chan struct{}, message []byte) bool {
+	select {
+	case out <- message:
+		return true
+	case <-done:
+		return false
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"test1/storage"
+)
+
+// fakeEvents is an in-memory EventBroadcaster that keeps every message.
+type fakeEvents struct {
+	mu          sync.Mutex
+	messages    map[string][][]byte
+	subscribers map[string][]chan Event
+	forgotten   []string
+}
+
+func newFakeEvents() *fakeEvents {
+	return &fakeEvents{messages: make(map[string][][]byte), subscribers: make(map[string][]chan Event)}
+}
+
+func (f *fakeEvents) Broadcast(boardID string, message []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages[boardID] = append(f.messages[boardID], message)
+	for _, ch := range f.subscribers[boardID] {
+		ch <- Event{Data: message}
+	}
+}
+
+func (f *fakeEvents) Subscribe(boardID, lastEventID string) (<-chan Event, func(), bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan Event, 16)
+	f.subscribers[boardID] = append(f.subscribers[boardID], ch)
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			subs := f.subscribers[boardID]
+			for i, c := range subs {
+				if c == ch {
+					f.subscribers[boardID] = append(subs[:i], subs[i+1:]...)
+					close(ch)
+				}
+			}
+		})
+	}, true
+}
+
+func (f *fakeEvents) Forget(boardID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.forgotten = append(f.forgotten, boardID)
+}
+
+func (f *fakeEvents) subscriberCount(boardID string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subscribers[boardID])
+}
+
+func TestFollowEventsUnsubscribesWhenStoppedWhileIdle(t *testing.T) {
+	events := newFakeEvents()
+	h := New(storage.NewInMemoryStore(), events, nil)
+	defer h.Close()
+
+	out, stop := h.followEvents("b")
+	for events.subscriberCount("b") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	events.Broadcast("b", []byte("first"))
+	if got := <-out; string(got) != "first" {
+		t.Fatalf("expected the first event, got %q", got)
+	}
+
+	stop()
+	select {
+	case _, ok := <-out:
+		if ok {
+			t.Fatal("expected no more events")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the relay to stop without another event")
+	}
+	if n := events.subscriberCount("b"); n != 0 {
+		t.Fatalf("expected the subscription to be cancelled, %d left", n)
+	}
+}
@@ -2,46 +2,156 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
+	"test1/access"
+	"test1/audit"
+	"test1/auth"
+	"test1/history"
 	"test1/models"
+	"test1/patch"
+	"test1/presence"
+	"test1/realtime"
 	"test1/status"
+	"test1/storage"
+	"test1/undo"
+	"test1/workspace"
 )
 
-// BoardStore abstracts persistence for boards.
+// BoardStore abstracts persistence for boards. Writes return storage.ErrNotFound
+// for unknown boards and any other error when the change could not be persisted.
 type BoardStore interface {
 	ListBoards() []models.Board
-	CreateBoard(board models.Board) models.Board
+	CreateBoard(board models.Board) (models.Board, error)
 	GetBoard(id string) (models.Board, bool)
-	UpdateBoard(board models.Board) (models.Board, bool)
-	DeleteBoard(id string) bool
+	HasBoard(id string) bool
+	// Lifecycle reports whether a board is archived or in the trash without copying it.
+	Lifecycle(id string) (models.Lifecycle, bool)
+	// UpdateBoard and DeleteBoard return *storage.ConflictError when a non-zero
+	// expected revision no longer matches the stored board.
+	UpdateBoard(board models.Board, expected int64) (models.Board, error)
+	// MutateBoard atomically applies fn to the stored board; an error from fn aborts the write and is returned as is.
+	MutateBoard(id string, fn func(board *models.Board) error) (models.Board, error)
+	DeleteBoard(id string, expected int64) error
 }
 
 // EventBroadcaster represents a pub-sub style event bus.
 type EventBroadcaster interface {
 	Broadcast(boardID string, message []byte)
-	Subscribe(boardID string) (<-chan []byte, func())
+	// Subscribe delivers a board's events, starting after lastEventID when it is set.
+	// resumed is false if events after lastEventID were lost. The channel is closed
+	// when the subscriber falls too far behind.
+	Subscribe(boardID, lastEventID string) (events <-chan Event, cancel func(), resumed bool)
+	// Forget drops a purged board's stream and replay buffer, closing the
+	// channels of any subscribers left.
+	Forget(boardID string)
+}
+
+// Event is a published board event message. ID identifies it for resuming a
+// stream; Seq is its position on the board's stream.
+type Event struct {
+	ID   string
+	Seq  uint64
+	Data []byte
 }
 
 // Handler encapsulates HTTP handlers for the collaborative board service.
 type Handler struct {
-	store  BoardStore
-	events EventBroadcaster
-	logger *log.Logger
+	store    BoardStore
+	events   EventBroadcaster
+	ops      *patch.Log
+	versions *history.Recorder
+	undo     *undo.Stacks
+	hubs     *realtime.Registry
+	presence *presence.Tracker
+	cursors  *presence.CursorBatcher
+	logger   *log.Logger
+
+	auth         *auth.Service
+	authRequired bool
+	access       *access.Store
+	workspaces   *workspace.Store
+	audit        *audit.Log
+	admins       map[string]bool
+
+	retention time.Duration
+	stopPurge chan struct{}
+}
+
+// Option configures optional Handler dependencies.
+type Option func(*Handler)
+
+// WithHistory records board versions in rec instead of an in-memory recorder.
+func WithHistory(rec *history.Recorder) Option {
+	return func(h *Handler) { h.versions = rec }
+}
+
+// opLogDepth is how many accepted patches per board are kept for transforming stale patches.
+const opLogDepth = 256
+
+func New(store BoardStore, events EventBroadcaster, logger *log.Logger, opts ...Option) *Handler {
+	h := &Handler{store: store, events: events, ops: patch.NewLog(opLogDepth), undo: undo.NewStacks(undoDepth), logger: logger, retention: DefaultTrashRetention}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.versions == nil {
+		h.versions, _ = history.NewRecorder("", history.DefaultLimit)
+	}
+	if h.access == nil {
+		h.access, _ = access.NewStore("")
+	}
+	if h.workspaces == nil {
+		h.workspaces, _ = workspace.NewStore("")
+	}
+	if h.audit == nil {
+		h.audit, _ = audit.Open("")
+	}
+	h.hubs = realtime.NewRegistry(h.followEvents)
+	h.presence = presence.NewTracker(presence.DefaultOptions(), func(boardID, eventType string, p presence.Participant) {
+		h.broadcastBoardEvent(boardID, eventType, p)
+	})
+	h.cursors = presence.NewCursorBatcher(presence.DefaultCursorOptions(), func(boardID string, cursors []models.Cursor) {
+		h.broadcastBoardEvent(boardID, presence.CursorsMoved, cursors)
+	})
+	h.stopPurge = make(chan struct{})
+	if h.retention > 0 {
+		go h.purgeLoop()
+	}
+	return h
 }
 
-func New(store BoardStore, events EventBroadcaster, logger *log.Logger) *Handler {
-	return &Handler{store: store, events: events, logger: logger}
+// Close stops background work such as presence sweeping, cursor batching and purging the trash.
+func (h *Handler) Close() {
+	h.cursors.Close()
+	h.presence.Close()
+	close(h.stopPurge)
 }
 
 // RegisterRoutes attaches handler functions to the provided ServeMux.
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(staticFS))))
-	mux.HandleFunc("/", h.serveIndex)
-	mux.HandleFunc("/boards", h.handleBoards)
-	mux.HandleFunc("/boards/", h.handleBoardByID)
+	api := func(f http.HandlerFunc) http.Handler { return f }
+	if h.auth != nil {
+		mux.Handle("/auth/", h.auth.Handler())
+		mux.HandleFunc("/login", h.serveLogin)
+		// The page itself stays reachable so it can send anonymous visitors to /login.
+		mux.Handle("/", h.auth.Middleware(false, http.HandlerFunc(h.serveIndex)))
+		api = func(f http.HandlerFunc) http.Handler { return h.auth.Middleware(h.authRequired, f) }
+	} else {
+		mux.HandleFunc("/", h.serveIndex)
+	}
+	mux.Handle("/boards", api(h.handleBoards))
+	mux.Handle("/boards/", api(h.handleBoardByID))
+	mux.Handle("/admin/audit", api(h.handleAudit))
+	mux.Handle("/admin/audit/", api(h.handleAudit))
+	mux.Handle("/trash", api(h.handleTrash))
+	mux.Handle("/trash/", api(h.handleTrash))
+	mux.Handle("/workspaces", api(h.handleWorkspaces))
+	mux.Handle("/workspaces/", api(h.handleWorkspaceByID))
 }
 
 func (h *Handler) handleBoards(w http.ResponseWriter, r *http.Request) {
@@ -63,9 +173,37 @@ func (h *Handler) handleBoardByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	boardID := parts[0]
+	if !h.visible(boardID) {
+		http.NotFound(w, r)
+		return
+	}
+	role := h.boardRole(r, boardID)
+	if !authorize(w, r, "board", role, requiredRole(r.Method, parts)) {
+		return
+	}
 
 	if len(parts) > 1 {
 		switch parts[1] {
+		case "members":
+			h.handleMembers(w, r, boardID, parts[2:])
+			return
+		case "links":
+			h.handleLinks(w, r, boardID, parts[2:])
+			return
+		case "move":
+			if r.Method != http.MethodPost || len(parts) > 2 {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.moveBoard(w, r, boardID)
+			return
+		case "archive", "unarchive":
+			if r.Method != http.MethodPost || len(parts) > 2 {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.setArchived(w, r, boardID, parts[1] == "archive")
+			return
 		case "events":
 			if r.Method != http.MethodGet {
 				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -73,6 +211,20 @@ func (h *Handler) handleBoardByID(w http.ResponseWriter, r *http.Request) {
 			}
 			h.streamBoardEvents(w, r, boardID)
 			return
+		case "ws":
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.serveBoardSocket(w, r, boardID)
+			return
+		case "participants":
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.listParticipants(w, r, boardID)
+			return
 		case "cursor":
 			if r.Method != http.MethodPost {
 				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -80,7 +232,77 @@ func (h *Handler) handleBoardByID(w http.ResponseWriter, r *http.Request) {
 			}
 			h.cursorUpdate(w, r, boardID)
 			return
+		case "ops":
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.handleOps(w, r, boardID, role)
+			return
+		case "versions":
+			h.handleVersions(w, r, boardID, parts[2:])
+			return
+		case "undo", "redo":
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.handleUndo(w, r, boardID, parts[1] == "redo")
+			return
+		case "diff":
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.diffVersions(w, r, boardID)
+			return
+		case "what-if":
+			if r.Method != http.MethodPost || len(parts) > 2 {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.whatIf(w, r, boardID)
+			return
+		case "simulation":
+			if r.Method != http.MethodGet || len(parts) > 2 {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.simulate(w, r, boardID)
+			return
+		case "uncertainty":
+			if r.Method != http.MethodGet || len(parts) > 2 {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.uncertainty(w, r, boardID)
+			return
+		}
+
+		coll, ok := collections[parts[1]]
+		if !ok || len(parts) > 4 {
+			http.NotFound(w, r)
+			return
+		}
+		if len(parts) == 4 {
+			switch {
+			case parts[3] == "text" && (coll.path == "notes" || coll.path == "texts"):
+				h.handleText(w, r, boardID, coll, parts[2])
+			case parts[3] == "outcome" && coll.path == "scenarios":
+				h.scenarioOutcome(w, r, boardID, parts[2])
+			case parts[3] == "drivers" && coll.path == "causal-nodes":
+				h.nodeDrivers(w, r, boardID, parts[2])
+			default:
+				http.NotFound(w, r)
+			}
+			return
 		}
+		itemID := ""
+		if len(parts) == 3 {
+			itemID = parts[2]
+		}
+		h.handleCollection(w, r, boardID, coll, itemID)
+		return
 	}
 
 	switch r.Method {
@@ -89,16 +311,12 @@ func (h *Handler) handleBoardByID(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPut:
 		h.updateBoard(w, r, boardID)
 	case http.MethodDelete:
-		h.deleteBoard(w, r, boardID)
+		h.trashBoard(w, r, boardID)
 	default:
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
-func (h *Handler) listBoards(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusOK, h.store.ListBoards())
-}
-
 func (h *Handler) createBoard(w http.ResponseWriter, r *http.Request) {
 	var incoming models.Board
 	if err := json.NewDecoder(r.Body).Decode(&incoming); err != nil {
@@ -108,9 +326,35 @@ func (h *Handler) createBoard(w http.ResponseWriter, r *http.Request) {
 	if incoming.Name == "" {
 		incoming.Name = "Untitled Board"
 	}
+	// ?workspace= and ?folder= file the new board in a workspace the caller can edit.
+	placement := workspace.Placement{WorkspaceID: r.URL.Query().Get("workspace"), FolderID: r.URL.Query().Get("folder")}
+	if !h.canPlace(w, r, placement) {
+		return
+	}
 
-	created := h.store.CreateBoard(status.Propagate(incoming))
-	h.broadcastBoardEvent(created.ID, "board.created", created)
+	stampComments(nil, &incoming, authorName(r))
+	created, err := h.store.CreateBoard(status.Propagate(incoming))
+	if err != nil {
+		h.storeError(w, r, err)
+		return
+	}
+	if placement != (workspace.Placement{}) {
+		if err := h.workspaces.Place(created.ID, placement); err != nil {
+			// Unplaced, the board would be personal, and open to everyone when
+			// created anonymously, so it goes again; if it cannot, it is at
+			// least given its owner and recorded.
+			if delErr := h.store.DeleteBoard(created.ID, created.Revision); delErr != nil {
+				if h.logger != nil {
+					h.logger.Printf("failed to drop board %s after placing it failed: %v", created.ID, delErr)
+				}
+				h.boardCreated(created, h.actorID(r))
+			}
+			h.workspaceError(w, r, err)
+			return
+		}
+	}
+	h.boardCreated(created, h.actorID(r))
+	w.Header().Set("ETag", boardETag(created.Revision))
 	respondJSON(w, http.StatusCreated, created)
 }
 
@@ -120,6 +364,12 @@ func (h *Handler) getBoard(w http.ResponseWriter, r *http.Request, id string) {
 		http.NotFound(w, r)
 		return
 	}
+	etag := boardETag(board.Revision)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 	respondJSON(w, http.StatusOK, board)
 }
 
@@ -130,26 +380,51 @@ func (h *Handler) updateBoard(w http.ResponseWriter, r *http.Request, id string)
 		return
 	}
 	updated.ID = id
-	board, ok := h.store.UpdateBoard(status.Propagate(updated))
-	if !ok {
-		http.NotFound(w, r)
+
+	// If-Match is the preferred precondition; a revision in the body is accepted
+	// from clients that cannot set headers and reports conflicts as 409.
+	expected, present, err := ifMatchRevision(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	h.broadcastBoardEvent(id, "board.updated", board)
-	respondJSON(w, http.StatusOK, board)
-}
+	conflictStatus := http.StatusPreconditionFailed
+	if !present {
+		if updated.Revision == 0 {
+			http.Error(w, "If-Match header required", http.StatusPreconditionRequired)
+			return
+		}
+		expected = updated.Revision
+		conflictStatus = http.StatusConflict
+	}
 
-func (h *Handler) deleteBoard(w http.ResponseWriter, r *http.Request, id string) {
-	if ok := h.store.DeleteBoard(id); !ok {
-		http.NotFound(w, r)
+	var before models.Board
+	board, err := h.mutateBoard(id, func(b *models.Board) error {
+		if err := expectRevision(b, expected); err != nil {
+			return err
+		}
+		before = *b
+		// Text documents are server state; keep them so in-flight CRDT edits still merge.
+		docs, comments := b.TextDocs, b.Comments
+		*b = status.Propagate(updated)
+		b.TextDocs = docs
+		stampComments(comments, b, authorName(r))
+		return nil
+	})
+	if err != nil {
+		if !conflictError(w, err, conflictStatus) {
+			h.storeError(w, r, err)
+		}
 		return
 	}
-	h.broadcastBoardEvent(id, "board.deleted", map[string]string{"id": id})
-	w.WriteHeader(http.StatusNoContent)
+	h.committed(board, h.actorID(r), "board.updated", changedElements(before, board))
+	h.broadcastBoardChange(board, "board.updated", board)
+	w.Header().Set("ETag", boardETag(board.Revision))
+	respondJSON(w, http.StatusOK, board)
 }
 
 func (h *Handler) cursorUpdate(w http.ResponseWriter, r *http.Request, boardID string) {
-	if _, ok := h.store.GetBoard(boardID); !ok {
+	if !h.store.HasBoard(boardID) {
 		http.NotFound(w, r)
 		return
 	}
@@ -160,59 +435,86 @@ func (h *Handler) cursorUpdate(w http.ResponseWriter, r *http.Request, boardID s
 		return
 	}
 
-	if cursor.ID == "" {
+	id, signedIn := auth.FromContext(r.Context())
+	stampCursor(&cursor, id, signedIn)
+	if cursor.ID = h.claimable(cursor.ID); cursor.ID == "" {
 		http.Error(w, "cursor id required", http.StatusBadRequest)
 		return
 	}
 
-	h.broadcastBoardEvent(boardID, "cursor.moved", cursor)
+	if !h.moveCursor(boardID, cursorSender(r), cursor) {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "too many cursor updates", http.StatusTooManyRequests)
+		return
+	}
 	w.WriteHeader(http.StatusAccepted)
 }
 
-func (h *Handler) streamBoardEvents(w http.ResponseWriter, r *http.Request, boardID string) {
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
-		return
+// moveCursor records the cursor as participant activity and queues it for the
+// board's next cursors.moved frame. It reports false when sender is moving
+// cursors faster than the rate limit allows or the frame is full.
+func (h *Handler) moveCursor(boardID, sender string, cursor models.Cursor) bool {
+	if !h.cursors.Move(boardID, sender, cursor) {
+		return false
 	}
+	position := cursor.Position
+	h.presence.Touch(boardID, cursor.ID, presence.Update{Label: cursor.Label, Color: cursor.Color, Cursor: &position})
+	return true
+}
 
-	messages, cancel := h.events.Subscribe(boardID)
-	defer cancel()
-
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-
-	// Send a comment to keep the connection alive immediately.
-	if _, err := w.Write([]byte(": connected\n\n")); err != nil {
+func (h *Handler) listParticipants(w http.ResponseWriter, r *http.Request, boardID string) {
+	if !h.store.HasBoard(boardID) {
+		http.NotFound(w, r)
 		return
 	}
-	flusher.Flush()
+	respondJSON(w, http.StatusOK, h.presence.List(boardID))
+}
 
-	for {
-		select {
-		case <-r.Context().Done():
-			return
-		case msg, ok := <-messages:
-			if !ok {
-				return
-			}
-			if _, err := w.Write([]byte("data: ")); err != nil {
-				return
-			}
-			if _, err := w.Write(msg); err != nil {
-				return
-			}
-			if _, err := w.Write([]byte("\n\n")); err != nil {
-				return
-			}
-			flusher.Flush()
+// presenceFromQuery reads the label and color a participant connects with.
+func presenceFromQuery(r *http.Request) presence.Update {
+	q := r.URL.Query()
+	return presence.Update{Label: q.Get("label"), Color: q.Get("color")}
+}
+
+// boardCreated makes the creator the owner of a new board; boards created
+// anonymously stay open to everyone. It then commits and announces the board.
+func (h *Handler) boardCreated(board models.Board, creator string) {
+	if creator != "" {
+		if err := h.access.SetMember(board.ID, creator, access.Owner); err != nil && h.logger != nil {
+			h.logger.Printf("failed to make %s the owner of board %s: %v", creator, board.ID, err)
 		}
 	}
+	h.committed(board, creator, "board.created", nil)
+	h.broadcastBoardChange(board, "board.created", board)
+}
+
+// committed runs the bookkeeping shared by every accepted write: the resulting
+// board is recorded as a new version attributed to actor and in the audit log
+// with the elements the write touched, the step joins the actor's undo stack
+// and counts as activity for their presence.
+func (h *Handler) committed(board models.Board, actor, action string, elements []string) {
+	h.record(audit.Entry{Actor: actor, Action: action, BoardID: board.ID, Revision: board.Revision, Elements: elements})
+	if err := h.versions.Record(board, actor, action); err != nil && h.logger != nil {
+		h.logger.Printf("failed to record version %d of board %s: %v", board.Revision, board.ID, err)
+	}
+	if actor != "" && undoable(action) {
+		h.undo.Record(board.ID, actor, board.Revision)
+	}
+	if actor != "" {
+		h.presence.Touch(board.ID, actor, presence.Update{})
+	}
 }
 
 func (h *Handler) broadcastBoardEvent(boardID, eventType string, payload interface{}) {
-	evt := models.BoardEvent{Type: eventType, BoardID: boardID, Data: payload}
+	h.publish(models.BoardEvent{Type: eventType, BoardID: boardID, Data: payload})
+}
+
+// broadcastBoardChange publishes an event caused by a write, tagged with the resulting board revision.
+func (h *Handler) broadcastBoardChange(board models.Board, eventType string, payload interface{}) {
+	h.publish(models.BoardEvent{Type: eventType, BoardID: board.ID, Data: payload, Revision: board.Revision})
+}
+
+func (h *Handler) publish(evt models.BoardEvent) {
 	data, err := json.Marshal(evt)
 	if err != nil {
 		if h.logger != nil {
@@ -220,7 +522,22 @@ func (h *Handler) broadcastBoardEvent(boardID, eventType string, payload interfa
 		}
 		return
 	}
-	h.events.Broadcast(boardID, data)
+	h.events.Broadcast(evt.BoardID, data)
+}
+
+// storeError maps a persistence error onto an HTTP response.
+func (h *Handler) storeError(w http.ResponseWriter, r *http.Request, err error) {
+	if writeRequestError(w, err) || conflictError(w, err, http.StatusConflict) {
+		return
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if h.logger != nil {
+		h.logger.Printf("store error: %v", err)
+	}
+	http.Error(w, "failed to persist board", http.StatusInternalServerError)
 }
 
 func respondJSON(w http.ResponseWriter, status int, payload interface{}) {
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"test1/models"
+	"test1/storage"
+)
+
+// testServer serves a handler over HTTP with in-memory storage and fake events.
+type testServer struct {
+	*httptest.Server
+	h      *Handler
+	events *fakeEvents
+}
+
+func newTestServer(t *testing.T, opts ...Option) *testServer {
+	t.Helper()
+	events := newFakeEvents()
+	h := New(storage.NewInMemoryStore(), events, nil, append([]Option{WithTrashRetention(0)}, opts...)...)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		srv.Close()
+		h.Close()
+	})
+	return &testServer{Server: srv, h: h, events: events}
+}
+
+// do sends a request with body encoded as JSON unless it is nil, setting
+// headers given as name, value pairs.
+func (s *testServer) do(t *testing.T, method, path string, body interface{}, headers ...string) *http.Response {
+	t.Helper()
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+	}
+	req, err := http.NewRequest(method, s.URL+path, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// createBoard creates a board anonymously, which leaves it open to everyone.
+func (s *testServer) createBoard(t *testing.T, board models.Board) models.Board {
+	t.Helper()
+	resp := s.do(t, http.MethodPost, "/boards", board)
+	expectStatus(t, resp, http.StatusCreated)
+	return decode[models.Board](t, resp)
+}
+
+// eventTypes lists the types of the events published on a board, oldest first.
+func (s *testServer) eventTypes(t *testing.T, boardID string) []string {
+	t.Helper()
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+	var types []string
+	for _, message := range s.events.messages[boardID] {
+		var evt models.BoardEvent
+		if err := json.Unmarshal(message, &evt); err != nil {
+			t.Fatalf("decode event: %v", err)
+		}
+		types = append(types, evt.Type)
+	}
+	return types
+}
+
+func expectStatus(t *testing.T, resp *http.Response, status int) {
+	t.Helper()
+	if resp.StatusCode != status {
+		var body bytes.Buffer
+		body.ReadFrom(resp.Body)
+		t.Fatalf("%s %s: expected %d, got %d: %s", resp.Request.Method, resp.Request.URL.Path, status, resp.StatusCode, body.String())
+	}
+}
+
+func decode[T any](t *testing.T, resp *http.Response) T {
+	t.Helper()
+	var v T
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return v
+}
+
+func TestCursorLimitsCannotBeDodgedWithNewIDs(t *testing.T) {
+	s := newTestServer(t)
+	board := s.createBoard(t, models.Board{Name: "Plan"})
+
+	limited := false
+	for i := 0; i < 50 && !limited; i++ {
+		resp := s.do(t, http.MethodPost, "/boards/"+board.ID+"/cursor", models.Cursor{ID: fmt.Sprintf("anon-%d", i)})
+		limited = resp.StatusCode == http.StatusTooManyRequests
+	}
+	if !limited {
+		t.Fatal("expected moves under fresh cursor IDs from one address to be rate limited")
+	}
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"test1/access"
+	"test1/models"
+	"test1/workspace"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+	// noneFilter selects personal boards with ?workspace=none and boards at the
+	// top of a workspace with ?folder=none.
+	noneFilter = "none"
+)
+
+// boardQuery is a parsed GET /boards query:
+//
+//	q             case-insensitive substring of the board name
+//	workspace     workspace ID, or "none" for personal boards
+//	folder        folder ID, or "none" for boards outside any folder
+//	role          least role the caller must have, e.g. "editor"
+//	updatedSince  RFC 3339 time; only boards updated at or after it
+//	sort, order   "updatedAt" (default, newest first) or "name" (A-Z); "asc" or "desc"
+//	limit, cursor page size (default 50, at most 200) and the cursor of the next page
+//	archived      archived boards are left out unless this is "include" or "only"
+//	view          "summary" lists names and placement instead of whole boards
+//
+// GET /trash takes the same query and lists deleted boards the caller owns.
+type boardQuery struct {
+	search       string
+	workspace    string
+	folder       string
+	minRole      access.Role
+	updatedSince time.Time
+	archived     string
+	trash        bool
+	sortBy       string
+	desc         bool
+	limit        int
+	after        *pageCursor
+	summary      bool
+}
+
+// pageCursor marks the last board of a page by its sort key and ID, so pages
+// stay consistent while boards are created or deleted in between.
+type pageCursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	ID   string `json:"id"`
+}
+
+func parseBoardQuery(q url.Values) (boardQuery, error) {
+	bq := boardQuery{
+		search:    strings.ToLower(strings.TrimSpace(q.Get("q"))),
+		workspace: q.Get("workspace"),
+		folder:    q.Get("folder"),
+		minRole:   access.Viewer,
+		sortBy:    "updatedAt",
+		limit:     defaultPageSize,
+		summary:   q.Get("view") == "summary",
+		archived:  q.Get("archived"),
+	}
+	if bq.archived != "" && bq.archived != "include" && bq.archived != "only" {
+		return bq, errors.New("archived must be include or only")
+	}
+	if v := q.Get("role"); v != "" {
+		role, ok := access.ParseRole(v)
+		if !ok {
+			return bq, errors.New("role must be owner, editor, commenter or viewer")
+		}
+		bq.minRole = role
+	}
+	if v := q.Get("updatedSince"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return bq, errors.New("updatedSince must be an RFC 3339 time")
+		}
+		bq.updatedSince = t
+	}
+	switch v := q.Get("sort"); v {
+	case "", "updatedAt":
+		bq.desc = true
+	case "name":
+		bq.sortBy = v
+	default:
+		return bq, errors.New("sort must be updatedAt or name")
+	}
+	switch q.Get("order") {
+	case "":
+	case "asc":
+		bq.desc = false
+	case "desc":
+		bq.desc = true
+	default:
+		return bq, errors.New("order must be asc or desc")
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			return bq, errors.New("limit must be between 1 and " + strconv.Itoa(maxPageSize))
+		}
+		bq.limit = n
+	}
+	if v := q.Get("cursor"); v != "" {
+		var c pageCursor
+		data, err := base64.RawURLEncoding.DecodeString(v)
+		if err == nil {
+			err = json.Unmarshal(data, &c)
+		}
+		if err != nil || c.Sort != bq.sortKind() {
+			return bq, errors.New("invalid cursor; start again without one")
+		}
+		bq.after = &c
+	}
+	return bq, nil
+}
+
+// sortKind names the ordering, so a cursor is only used with the sort it came from.
+func (bq boardQuery) sortKind() string {
+	if bq.desc {
+		return bq.sortBy + ":desc"
+	}
+	return bq.sortBy + ":asc"
+}
+
+// sortKey orders boards by string comparison: a fixed-width UTC time or a
+// lower-cased name, with the board ID breaking ties.
+func (bq boardQuery) sortKey(b models.Board) string {
+	if bq.sortBy == "name" {
+		return strings.ToLower(b.Name)
+	}
+	return b.UpdatedAt.UTC().Format("2006-01-02T15:04:05.000000000Z")
+}
+
+// before reports whether (keyA, idA) comes before (keyB, idB) in the listing.
+func (bq boardQuery) before(keyA, idA, keyB, idB string) bool {
+	if keyA == keyB {
+		keyA, keyB = idA, idB
+	}
+	if bq.desc {
+		return keyA > keyB
+	}
+	return keyA < keyB
+}
+
+// listedBoard is a board the caller may see, with what the listing needs to know about it.
+type listedBoard struct {
+	board     models.Board
+	key       string
+	role      access.Role
+	placement workspace.Placement
+}
+
+// boardSummary is a board as listed with ?view=summary.
+type boardSummary struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	WorkspaceID string      `json:"workspaceId,omitempty"`
+	FolderID    string      `json:"folderId,omitempty"`
+	UpdatedAt   time.Time   `json:"updatedAt"`
+	Revision    int64       `json:"revision"`
+	Role        access.Role `json:"role"`
+	models.Lifecycle
+	PurgeAt *time.Time `json:"purgeAt,omitempty"`
+}
+
+func (h *Handler) summarize(l listedBoard) boardSummary {
+	return boardSummary{
+		ID:          l.board.ID,
+		Name:        l.board.Name,
+		WorkspaceID: l.placement.WorkspaceID,
+		FolderID:    l.placement.FolderID,
+		UpdatedAt:   l.board.UpdatedAt,
+		Revision:    l.board.Revision,
+		Role:        l.role,
+		Lifecycle:   l.board.Lifecycle,
+		PurgeAt:     h.purgeAt(l.board.Lifecycle),
+	}
+}
+
+// matches reports whether a board passes the query's filters.
+func (bq boardQuery) matches(l listedBoard) bool {
+	switch {
+	case l.board.Trashed() != bq.trash:
+		return false
+	case bq.archived == "" && l.board.Archived(), bq.archived == "only" && !l.board.Archived():
+		return false
+	case !l.role.Allows(bq.minRole):
+		return false
+	case bq.search != "" && !strings.Contains(strings.ToLower(l.board.Name), bq.search):
+		return false
+	case bq.workspace == noneFilter && l.placement.WorkspaceID != "",
+		bq.workspace != "" && bq.workspace != noneFilter && l.placement.WorkspaceID != bq.workspace:
+		return false
+	case bq.folder == noneFilter && l.placement.FolderID != "",
+		bq.folder != "" && bq.folder != noneFilter && l.placement.FolderID != bq.folder:
+		return false
+	case !bq.updatedSince.IsZero() && l.board.UpdatedAt.Before(bq.updatedSince):
+		return false
+	}
+	return true
+}
+
+// listBoards lists the boards the caller can view, filtered, sorted and one
+// page at a time.
+func (h *Handler) listBoards(w http.ResponseWriter, r *http.Request) {
+	bq, err := parseBoardQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.respondBoards(w, r, bq)
+}
+
+// listTrash lists the deleted boards the caller could restore, as summaries
+// with the time each will be purged.
+func (h *Handler) listTrash(w http.ResponseWriter, r *http.Request) {
+	bq, err := parseBoardQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	bq.trash, bq.summary, bq.minRole = true, true, access.Owner
+	if bq.archived == "" {
+		bq.archived = "include"
+	}
+	h.respondBoards(w, r, bq)
+}
+
+// respondBoards answers with one page of the boards matching bq. The body is
+// a JSON array; X-Total-Count has the number of matching boards and a Link
+// header with rel="next" the URL of the next page.
+func (h *Handler) respondBoards(w http.ResponseWriter, r *http.Request, bq boardQuery) {
+	matched := []listedBoard{}
+	for _, b := range h.store.ListBoards() {
+		l := listedBoard{board: b, key: bq.sortKey(b), role: h.boardRole(r, b.ID), placement: h.workspaces.Placement(b.ID)}
+		if bq.matches(l) {
+			matched = append(matched, l)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return bq.before(matched[i].key, matched[i].board.ID, matched[j].key, matched[j].board.ID)
+	})
+
+	page := matched
+	if c := bq.after; c != nil {
+		start := sort.Search(len(page), func(i int) bool {
+			return bq.before(c.Key, c.ID, page[i].key, page[i].board.ID)
+		})
+		page = page[start:]
+	}
+	if len(page) > bq.limit {
+		page = page[:bq.limit]
+		last := page[len(page)-1]
+		w.Header().Set("Link", "<"+nextPageURL(r, bq, last)+`>; rel="next"`)
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(matched)))
+
+	if bq.summary {
+		summaries := make([]boardSummary, 0, len(page))
+		for _, l := range page {
+			summaries = append(summaries, h.summarize(l))
+		}
+		respondJSON(w, http.StatusOK, summaries)
+		return
+	}
+	boards := make([]models.Board, 0, len(page))
+	for _, l := range page {
+		boards = append(boards, l.board)
+	}
+	respondJSON(w, http.StatusOK, boards)
+}
+
+// nextPageURL is the request's URL with the cursor moved past last.
+func nextPageURL(r *http.Request, bq boardQuery, last listedBoard) string {
+	data, _ := json.Marshal(pageCursor{Sort: bq.sortKind(), Key: last.key, ID: last.board.ID})
+	q := r.URL.Query()
+	q.Set("cursor", base64.RawURLEncoding.EncodeToString(data))
+	return r.URL.Path + "?" + q.Encode()
+}
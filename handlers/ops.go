@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"test1/access"
+	"test1/models"
+	"test1/patch"
+	"test1/status"
+	"test1/storage"
+)
+
+// opsRequest is a JSON Patch made against a known board revision.
+type opsRequest struct {
+	BaseRevision int64             `json:"baseRevision"`
+	Ops          []patch.Operation `json:"ops"`
+	ClientID     string            `json:"clientId,omitempty"`
+}
+
+// opsResult describes an accepted patch. Ops apply to BaseRevision and produce Revision;
+// they include any server-side status changes so subscribers can apply them as is.
+type opsResult struct {
+	BaseRevision int64             `json:"baseRevision"`
+	Revision     int64             `json:"revision"`
+	Ops          []patch.Operation `json:"ops"`
+	ClientID     string            `json:"clientId,omitempty"`
+}
+
+// Board fields maintained by the server that patches may not touch.
+var protectedPaths = []string{"/id", "/revision", "/updatedAt", "/textDocs", "/archivedAt", "/deletedAt", "/deletedBy", "/unsettledLoops"}
+
+func (h *Handler) handleOps(w http.ResponseWriter, r *http.Request, boardID string, role access.Role) {
+	var req opsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.applyOps(boardID, opsCaller{actor: h.actorID(r), author: authorName(r), role: role}, req)
+	if err != nil {
+		h.storeError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", boardETag(result.Revision))
+	respondJSON(w, http.StatusOK, result)
+}
+
+// opsCaller is who sends a patch: actor is recorded in history and undo,
+// author is stamped on new comments and role limits what the patch may change.
+type opsCaller struct {
+	actor  string
+	author string
+	role   access.Role
+}
+
+// applyOps transforms the patch past any patches accepted since its base revision,
+// applies it to the stored board and broadcasts the accepted operations.
+func (h *Handler) applyOps(boardID string, from opsCaller, req opsRequest) (opsResult, error) {
+	if len(req.Ops) == 0 {
+		return opsResult{}, newRequestError(http.StatusBadRequest, "ops required")
+	}
+	switch {
+	case !from.role.Allows(access.Commenter):
+		return opsResult{}, newRequestError(http.StatusForbidden, "this requires the commenter role on the board")
+	case !from.role.Allows(access.Editor) && !commentOnly(req.Ops):
+		return opsResult{}, newRequestError(http.StatusForbidden, "commenters can only add comments")
+	}
+	for _, op := range req.Ops {
+		if touchesProtected(op) {
+			return opsResult{}, newRequestError(http.StatusBadRequest, "ops may not modify "+op.Path)
+		}
+	}
+
+	var result opsResult
+	var before models.Board
+	// logged is what later patches are transformed past: the accepted ops and
+	// the propagated statuses, so a stale edit of a causal node conflicts
+	// with the recalculation instead of silently overwriting it. The authors
+	// stamped on new comments are left out; they only touch what the ops added.
+	var logged []patch.Operation
+	board, err := h.mutateBoard(boardID, func(b *models.Board) error {
+		before = *b
+		ops := req.Ops
+		if req.BaseRevision != b.Revision {
+			concurrent, ok := h.ops.Since(boardID, req.BaseRevision, b.Revision)
+			if !ok || req.BaseRevision > b.Revision {
+				return &storage.ConflictError{Current: b.Revision}
+			}
+			transformed := make([]patch.Operation, len(ops))
+			for i, op := range ops {
+				t, err := patch.Transform(op, concurrent)
+				if err != nil {
+					return &storage.ConflictError{Current: b.Revision}
+				}
+				transformed[i] = t
+			}
+			ops = transformed
+		}
+
+		updated, err := patchBoard(*b, ops)
+		if err != nil {
+			return err
+		}
+		stamped := stampComments(b.Comments, &updated, from.author)
+		derived := []patch.Operation(nil)
+		if stamped {
+			// Replay the corrected authors so clients applying the ops converge on them.
+			comments, _ := json.Marshal(updated.Comments)
+			derived = append(derived, patch.Operation{Op: "replace", Path: "/comments", Value: comments})
+		}
+		logged = ops
+		if touchesCausalGraph(ops) {
+			updated = status.Propagate(updated)
+			nodes, _ := json.Marshal(updated.CausalNodes)
+			loops, _ := json.Marshal(updated.UnsettledLoops)
+			propagated := []patch.Operation{
+				{Op: "replace", Path: "/causalNodes", Value: nodes},
+				{Op: "add", Path: "/unsettledLoops", Value: loops},
+			}
+			derived = append(derived, propagated...)
+			logged = append(append([]patch.Operation(nil), ops...), propagated...)
+		}
+		*b = updated
+
+		// The store assigns the next revision once this callback succeeds.
+		revision := b.Revision + 1
+		result = opsResult{
+			BaseRevision: revision - 1,
+			Revision:     revision,
+			Ops:          append(append([]patch.Operation(nil), ops...), derived...),
+			ClientID:     req.ClientID,
+		}
+		return nil
+	})
+	if err != nil {
+		return opsResult{}, err
+	}
+
+	// Only committed patches may be transformed against.
+	h.ops.Record(boardID, board.Revision, logged)
+	h.committed(board, from.actor, "board.ops", changedElements(before, board))
+	h.broadcastBoardChange(board, "board.ops", result)
+	return result, nil
+}
+
+// patchBoard applies ops to the JSON form of board, keeping server-maintained fields.
+func patchBoard(board models.Board, ops []patch.Operation) (models.Board, error) {
+	doc, err := json.Marshal(board)
+	if err != nil {
+		return models.Board{}, err
+	}
+	patched, err := patch.Apply(doc, ops)
+	switch {
+	case errors.Is(err, patch.ErrTestFailed):
+		return models.Board{}, &storage.ConflictError{Current: board.Revision}
+	case errors.Is(err, patch.ErrInvalid):
+		return models.Board{}, newRequestError(http.StatusBadRequest, err.Error())
+	case err != nil:
+		return models.Board{}, newRequestError(http.StatusUnprocessableEntity, err.Error())
+	}
+
+	var updated models.Board
+	if err := json.Unmarshal(patched, &updated); err != nil {
+		return models.Board{}, newRequestError(http.StatusUnprocessableEntity, "patched board is invalid: "+err.Error())
+	}
+	updated.ID = board.ID
+	updated.Revision = board.Revision
+	updated.UpdatedAt = board.UpdatedAt
+	return updated, nil
+}
+
+func touchesProtected(op patch.Operation) bool {
+	for _, target := range opTargets(op) {
+		if target == "" {
+			return true
+		}
+		for _, p := range protectedPaths {
+			if within(target, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func touchesCausalGraph(ops []patch.Operation) bool {
+	for _, op := range ops {
+		for _, target := range opTargets(op) {
+			if within(target, "/causalNodes") || within(target, "/causalLinks") || within(target, "/propagation") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// opTargets lists the pointers an operation reads or writes.
+func opTargets(op patch.Operation) []string {
+	if op.Op == "move" || op.Op == "copy" {
+		return []string{op.Path, op.From}
+	}
+	return []string{op.Path}
+}
+
+// within reports whether pointer equals prefix or points inside it.
+func within(pointer, prefix string) bool {
+	return pointer == prefix || strings.HasPrefix(pointer, prefix+"/")
+}
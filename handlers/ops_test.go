@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"test1/models"
+	"test1/patch"
+)
+
+func TestRefusedPatchesAreNotTransformedAgainst(t *testing.T) {
+	s := newTestServer(t)
+	board := s.createBoard(t, models.Board{Notes: []models.StickyNote{{ID: "n1", Content: "a"}}})
+	path := "/boards/" + board.ID
+	edit := func(base int64, content string) *http.Response {
+		return s.do(t, http.MethodPost, path+"/ops", opsRequest{BaseRevision: base, Ops: []patch.Operation{
+			{Op: "replace", Path: "/notes/0/content", Value: json.RawMessage(`"` + content + `"`)},
+		}})
+	}
+
+	expectStatus(t, s.do(t, http.MethodPost, path+"/archive", nil), http.StatusOK)
+	expectStatus(t, edit(board.Revision+1, "refused"), http.StatusConflict)
+	expectStatus(t, s.do(t, http.MethodPost, path+"/unarchive", nil), http.StatusOK)
+
+	// Unarchiving was no patch, so a patch made before it cannot be transformed past it.
+	if ops, ok := s.h.ops.Since(board.ID, board.Revision+1, board.Revision+2); ok {
+		t.Fatalf("expected no patch logged for the unarchived revision, got %+v", ops)
+	}
+	expectStatus(t, edit(board.Revision+1, "stale"), http.StatusConflict)
+	expectStatus(t, edit(board.Revision+2, "current"), http.StatusOK)
+}
+
+func TestStaleEditsOfPropagatedStatusesConflict(t *testing.T) {
+	s := newTestServer(t)
+	board := s.createBoard(t, models.Board{
+		CausalNodes: []models.CausalNode{{ID: "a", Status: "positive"}, {ID: "b"}, {ID: "c"}},
+		CausalLinks: []models.CausalLink{{ID: "bc", From: "b", To: "c", Weight: 1}},
+	})
+	path := "/boards/" + board.ID
+
+	link, _ := json.Marshal(models.CausalLink{ID: "ab", From: "a", To: "b", Weight: 1})
+	resp := s.do(t, http.MethodPost, path+"/ops", opsRequest{BaseRevision: board.Revision, Ops: []patch.Operation{
+		{Op: "add", Path: "/causalLinks/-", Value: link},
+	}})
+	expectStatus(t, resp, http.StatusOK)
+
+	resp = s.do(t, http.MethodPost, path+"/ops", opsRequest{BaseRevision: board.Revision, Ops: []patch.Operation{
+		{Op: "replace", Path: "/causalNodes/1/status", Value: json.RawMessage(`"negative"`)},
+	}})
+	expectStatus(t, resp, http.StatusConflict)
+	current, _ := s.h.store.GetBoard(board.ID)
+	if current.CausalNodes[1].Status != "positive" {
+		t.Fatalf("expected the propagated status to stand, got %q", current.CausalNodes[1].Status)
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"test1/models"
+	"test1/storage"
+)
+
+var errBadPrecondition = errors.New("If-Match must be a board revision ETag or *")
+
+// boardETag formats a board revision as a strong entity tag.
+func boardETag(revision int64) string {
+	return `"` + strconv.FormatInt(revision, 10) + `"`
+}
+
+// ifMatchRevision parses the If-Match header. present is false when the header is
+// missing; "*" matches any revision and yields zero.
+func ifMatchRevision(r *http.Request) (revision int64, present bool, err error) {
+	raw := strings.TrimSpace(r.Header.Get("If-Match"))
+	if raw == "" {
+		return 0, false, nil
+	}
+	if raw == "*" {
+		return 0, true, nil
+	}
+	raw = strings.TrimPrefix(raw, "W/")
+	raw = strings.Trim(raw, `"`)
+	revision, err = strconv.ParseInt(raw, 10, 64)
+	if err != nil || revision <= 0 {
+		return 0, true, errBadPrecondition
+	}
+	return revision, true, nil
+}
+
+// expectRevision fails a mutation when the caller supplied a revision that is no longer current.
+func expectRevision(board *models.Board, expected int64) error {
+	if expected != 0 && board.Revision != expected {
+		return &storage.ConflictError{Current: board.Revision}
+	}
+	return nil
+}
+
+// conflictError writes a revision conflict and reports whether err was one. Conflicts
+// detected through If-Match answer 412, conflicts on a revision in the body answer 409.
+func conflictError(w http.ResponseWriter, err error, status int) bool {
+	var conflict *storage.ConflictError
+	if !errors.As(err, &conflict) {
+		return false
+	}
+	w.Header().Set("ETag", boardETag(conflict.Current))
+	respondJSON(w, status, map[string]interface{}{
+		"error":    "board has changed",
+		"revision": conflict.Current,
+	})
+	return true
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"test1/models"
+	"test1/patch"
+)
+
+func TestBoardUpdatesNeedACurrentRevision(t *testing.T) {
+	s := newTestServer(t)
+	board := s.createBoard(t, models.Board{Name: "Plan"})
+	path := "/boards/" + board.ID
+
+	resp := s.do(t, http.MethodPut, path, models.Board{Name: "Renamed"})
+	expectStatus(t, resp, http.StatusPreconditionRequired)
+
+	resp = s.do(t, http.MethodPut, path, models.Board{Name: "Renamed"}, "If-Match", boardETag(board.Revision))
+	expectStatus(t, resp, http.StatusOK)
+	if resp.Header.Get("ETag") != boardETag(board.Revision+1) {
+		t.Fatalf("expected the new revision as ETag, got %q", resp.Header.Get("ETag"))
+	}
+
+	resp = s.do(t, http.MethodPut, path, models.Board{Name: "Stale"}, "If-Match", boardETag(board.Revision))
+	expectStatus(t, resp, http.StatusPreconditionFailed)
+	if resp.Header.Get("ETag") != boardETag(board.Revision+1) {
+		t.Fatalf("expected the current revision as ETag, got %q", resp.Header.Get("ETag"))
+	}
+	if conflict := decode[map[string]interface{}](t, resp); conflict["revision"] != float64(board.Revision+1) {
+		t.Fatalf("expected the current revision in the body, got %+v", conflict)
+	}
+
+	resp = s.do(t, http.MethodPut, path, models.Board{Name: "Stale", Revision: board.Revision})
+	expectStatus(t, resp, http.StatusConflict)
+	resp = s.do(t, http.MethodPut, path, models.Board{Name: "Body", Revision: board.Revision + 1})
+	expectStatus(t, resp, http.StatusOK)
+
+	expectStatus(t, s.do(t, http.MethodPut, path, models.Board{Name: "Bad"}, "If-Match", "nonsense"), http.StatusBadRequest)
+
+	current, _ := s.h.store.GetBoard(board.ID)
+	if current.Name != "Body" || current.Revision != board.Revision+2 {
+		t.Fatalf("expected only the current writes to land, got %q at revision %d", current.Name, current.Revision)
+	}
+}
+
+func TestBoardReadsAndWritesReturnTheirRevisionAsETag(t *testing.T) {
+	s := newTestServer(t)
+	resp := s.do(t, http.MethodPost, "/boards", models.Board{Name: "Plan"})
+	expectStatus(t, resp, http.StatusCreated)
+	board := decode[models.Board](t, resp)
+	if resp.Header.Get("ETag") != boardETag(board.Revision) {
+		t.Fatalf("expected the created revision as ETag, got %q", resp.Header.Get("ETag"))
+	}
+
+	resp = s.do(t, http.MethodGet, "/boards/"+board.ID, nil)
+	expectStatus(t, resp, http.StatusOK)
+	etag := resp.Header.Get("ETag")
+	if etag != boardETag(board.Revision) {
+		t.Fatalf("expected the stored revision as ETag, got %q", etag)
+	}
+	expectStatus(t, s.do(t, http.MethodGet, "/boards/"+board.ID, nil, "If-None-Match", etag), http.StatusNotModified)
+
+	resp = s.do(t, http.MethodPost, "/boards/"+board.ID+"/ops", opsRequest{
+		BaseRevision: board.Revision,
+		Ops:          []patch.Operation{{Op: "replace", Path: "/name", Value: json.RawMessage(`"Renamed"`)}},
+	})
+	expectStatus(t, resp, http.StatusOK)
+	if resp.Header.Get("ETag") != boardETag(board.Revision+1) {
+		t.Fatalf("expected the patched revision as ETag, got %q", resp.Header.Get("ETag"))
+	}
+	resp = s.do(t, http.MethodGet, "/boards/"+board.ID, nil, "If-None-Match", etag)
+	expectStatus(t, resp, http.StatusOK)
+	if resp.Header.Get("ETag") != boardETag(board.Revision+1) {
+		t.Fatalf("expected a changed board to return its new ETag, got %q", resp.Header.Get("ETag"))
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"test1/crdt"
+	"test1/models"
+)
+
+// serverSite attributes CRDT operations the server derives from whole-content
+// writes. Clients may not insert characters under it.
+const serverSite = "server"
+
+// textTombstones is how many deleted characters a document keeps for clients
+// whose edits still refer to them; older ones are dropped and such edits are
+// refused until the client reloads the text.
+const textTombstones = 1024
+
+// textRequest carries CRDT operations for one note or text item.
+type textRequest struct {
+	Ops []crdt.Op `json:"ops"`
+}
+
+// textState is the merged document returned to clients.
+type textState struct {
+	Content string     `json:"content"`
+	Doc     *crdt.Text `json:"doc"`
+	Applied []crdt.Op  `json:"applied,omitempty"`
+}
+
+// textDelta is broadcast as "content.delta" after operations are merged.
+type textDelta struct {
+	Collection string    `json:"collection"`
+	ID         string    `json:"id"`
+	Ops        []crdt.Op `json:"ops"`
+	Content    string    `json:"content"`
+}
+
+// handleText serves /boards/{id}/{notes|texts}/{itemId}/text.
+func (h *Handler) handleText(w http.ResponseWriter, r *http.Request, boardID string, coll collection, itemID string) {
+	switch r.Method {
+	case http.MethodGet:
+		board, ok := h.store.GetBoard(boardID)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		content := textContent(&board, coll.path, itemID)
+		if content == nil {
+			http.NotFound(w, r)
+			return
+		}
+		doc := reconcileDoc(&board, coll.path, itemID, *content)
+		respondJSON(w, http.StatusOK, textState{Content: *content, Doc: doc})
+	case http.MethodPost:
+		h.mergeText(w, r, boardID, coll, itemID)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) mergeText(w http.ResponseWriter, r *http.Request, boardID string, coll collection, itemID string) {
+	var req textRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := crdt.Validate(req.Ops); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, op := range req.Ops {
+		if op.Kind == crdt.OpInsert && op.ID.Site == serverSite {
+			http.Error(w, "site "+serverSite+" is reserved", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var result textState
+	board, err := h.mutateBoard(boardID, func(b *models.Board) error {
+		content := textContent(b, coll.path, itemID)
+		if content == nil {
+			return newRequestError(http.StatusNotFound, "item not found")
+		}
+		doc := reconcileDoc(b, coll.path, itemID, *content)
+		applied, err := doc.Merge(req.Ops)
+		if err != nil {
+			return newRequestError(http.StatusConflict, err.Error())
+		}
+		doc.Compact(textTombstones)
+		result.Applied = applied
+		*content = doc.String()
+		result.Content = *content
+		result.Doc = doc.Clone()
+		pruneTextDocs(b)
+		return nil
+	})
+	if err != nil {
+		h.storeError(w, r, err)
+		return
+	}
+
+	h.committed(board, h.actorID(r), "content.delta", []string{itemID})
+	if len(result.Applied) > 0 {
+		item, _ := coll.items.get(board, itemID)
+		h.broadcastBoardChange(board, "content.delta", textDelta{
+			Collection: coll.path, ID: itemID, Ops: result.Applied, Content: result.Content,
+		})
+		h.broadcastBoardChange(board, coll.event+".updated", item)
+	}
+	w.Header().Set("ETag", boardETag(board.Revision))
+	respondJSON(w, http.StatusOK, result)
+}
+
+// textContent returns a pointer to the Content of a note or text item.
+func textContent(board *models.Board, collection, id string) *string {
+	switch collection {
+	case "notes":
+		for i := range board.Notes {
+			if board.Notes[i].ID == id {
+				return &board.Notes[i].Content
+			}
+		}
+	case "texts":
+		for i := range board.Texts {
+			if board.Texts[i].ID == id {
+				return &board.Texts[i].Content
+			}
+		}
+	}
+	return nil
+}
+
+// reconcileDoc returns the board's document for an item, creating it on first use and
+// folding in any whole-content write made through PUT, PATCH or ops since the last merge.
+func reconcileDoc(board *models.Board, collection, id, content string) *crdt.Text {
+	key := collection + "/" + id
+	if board.TextDocs == nil {
+		board.TextDocs = make(map[string]*crdt.Text)
+	}
+	doc, ok := board.TextDocs[key]
+	if !ok {
+		doc = crdt.FromString(serverSite, content)
+		board.TextDocs[key] = doc
+	}
+	if doc.String() != content {
+		doc.Apply(doc.Edit(serverSite, content))
+		doc.Compact(textTombstones)
+	}
+	return doc
+}
+
+// pruneTextDocs drops documents whose item no longer exists.
+func pruneTextDocs(board *models.Board) {
+	for key := range board.TextDocs {
+		collection, id, _ := strings.Cut(key, "/")
+		if textContent(board, collection, id) == nil {
+			delete(board.TextDocs, key)
+		}
+	}
+}
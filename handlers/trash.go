@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"test1/access"
+	"test1/audit"
+	"test1/models"
+	"test1/storage"
+)
+
+// DefaultTrashRetention is how long deleted boards stay in the trash before
+// they are purged.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// purgeInterval is how often the trash is checked for boards past retention.
+const purgeInterval = time.Hour
+
+// WithTrashRetention purges deleted boards once they have been in the trash
+// for d. Zero keeps them until they are purged by hand.
+func WithTrashRetention(d time.Duration) Option {
+	return func(h *Handler) { h.retention = d }
+}
+
+// errArchived refuses changes to an archived board.
+var errArchived = newRequestError(http.StatusConflict, "the board is archived; unarchive it to change it")
+
+// mutateBoard is MutateBoard for changes to a board's content: boards in the
+// trash are not found, archived boards refuse changes, and fn cannot move a
+// board in or out of either state.
+func (h *Handler) mutateBoard(id string, fn func(b *models.Board) error) (models.Board, error) {
+	return h.store.MutateBoard(id, func(b *models.Board) error {
+		state := b.Lifecycle
+		switch {
+		case state.Trashed():
+			return storage.ErrNotFound
+		case state.Archived():
+			return errArchived
+		}
+		err := fn(b)
+		b.Lifecycle = state
+		return err
+	})
+}
+
+// visible reports whether the board exists and is not in the trash.
+func (h *Handler) visible(boardID string) bool {
+	state, ok := h.store.Lifecycle(boardID)
+	return ok && !state.Trashed()
+}
+
+// trashBoard serves DELETE /boards/{id}: the board moves to the trash, where
+// its owners can restore it until it is purged. Its sockets are disconnected.
+func (h *Handler) trashBoard(w http.ResponseWriter, r *http.Request, id string) {
+	expected, present, err := ifMatchRevision(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !present {
+		http.Error(w, "If-Match header required", http.StatusPreconditionRequired)
+		return
+	}
+	actor := h.actorID(r)
+	board, err := h.store.MutateBoard(id, func(b *models.Board) error {
+		if b.Trashed() {
+			return storage.ErrNotFound
+		}
+		if err := expectRevision(b, expected); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		b.DeletedAt, b.DeletedBy = &now, actor
+		return nil
+	})
+	if err != nil {
+		if !conflictError(w, err, http.StatusPreconditionFailed) {
+			h.storeError(w, r, err)
+		}
+		return
+	}
+	h.committed(board, actor, "board.trashed", nil)
+	h.broadcastBoardEvent(id, "board.deleted", map[string]string{"id": id})
+	h.hubs.Revalidate(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setArchived serves POST /boards/{id}/archive and /unarchive. Archiving an
+// archived board, or unarchiving one that is not, changes nothing.
+func (h *Handler) setArchived(w http.ResponseWriter, r *http.Request, id string, archived bool) {
+	if state, _ := h.store.Lifecycle(id); state.Archived() == archived {
+		h.getBoard(w, r, id)
+		return
+	}
+	board, err := h.store.MutateBoard(id, func(b *models.Board) error {
+		if b.Trashed() {
+			return storage.ErrNotFound
+		}
+		b.ArchivedAt = nil
+		if archived {
+			now := time.Now().UTC()
+			b.ArchivedAt = &now
+		}
+		return nil
+	})
+	if err != nil {
+		h.storeError(w, r, err)
+		return
+	}
+	action := "board.archived"
+	if !archived {
+		action = "board.unarchived"
+	}
+	h.committed(board, h.actorID(r), action, nil)
+	h.broadcastBoardChange(board, action, board)
+	w.Header().Set("ETag", boardETag(board.Revision))
+	respondJSON(w, http.StatusOK, board)
+}
+
+// handleTrash serves the trash: GET /trash lists deleted boards the caller
+// owns, POST /trash/{id}/restore brings one back and DELETE /trash/{id} purges
+// it right away.
+func (h *Handler) handleTrash(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/trash"), "/")
+	if path == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.listTrash(w, r)
+		return
+	}
+	parts := strings.Split(path, "/")
+	id := parts[0]
+	if state, ok := h.store.Lifecycle(id); !ok || !state.Trashed() || len(parts) > 2 {
+		http.NotFound(w, r)
+		return
+	}
+	if !authorize(w, r, "board", h.boardRole(r, id), access.Owner) {
+		return
+	}
+	switch {
+	case len(parts) == 2 && parts[1] == "restore" && r.Method == http.MethodPost:
+		h.restoreBoard(w, r, id)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		if err := h.purge(id, h.actorID(r), "deleted from the trash"); err != nil {
+			h.storeError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 2 && parts[1] != "restore":
+		http.NotFound(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) restoreBoard(w http.ResponseWriter, r *http.Request, id string) {
+	board, err := h.store.MutateBoard(id, func(b *models.Board) error {
+		if !b.Trashed() {
+			return storage.ErrNotFound
+		}
+		b.DeletedAt, b.DeletedBy = nil, ""
+		return nil
+	})
+	if err != nil {
+		h.storeError(w, r, err)
+		return
+	}
+	h.committed(board, h.actorID(r), "board.untrashed", nil)
+	h.broadcastBoardChange(board, "board.untrashed", board)
+	w.Header().Set("ETag", boardETag(board.Revision))
+	respondJSON(w, http.StatusOK, board)
+}
+
+// purgeAt is when a board in the trash will be purged, if ever.
+func (h *Handler) purgeAt(state models.Lifecycle) *time.Time {
+	if !state.Trashed() || h.retention <= 0 {
+		return nil
+	}
+	at := state.DeletedAt.Add(h.retention)
+	return &at
+}
+
+// purge deletes a board in the trash for good, with its access list,
+// placement, undo stacks, event stream and history, and disconnects its sockets. A board restored in the meantime is kept.
+// The audit log keeps its entries, with one more naming the actor and reason.
+func (h *Handler) purge(id, actor, reason string) error {
+	board, ok := h.store.GetBoard(id)
+	if !ok || !board.Trashed() {
+		return storage.ErrNotFound
+	}
+	if err := h.store.DeleteBoard(id, board.Revision); err != nil {
+		return err
+	}
+	h.undo.Forget(id)
+	h.ops.Forget(id)
+	h.events.Forget(id)
+	h.hubs.Revalidate(id)
+	if err := h.access.Forget(id); err != nil && h.logger != nil {
+		h.logger.Printf("failed to drop access list of board %s: %v", id, err)
+	}
+	if err := h.workspaces.Forget(id); err != nil && h.logger != nil {
+		h.logger.Printf("failed to drop placement of board %s: %v", id, err)
+	}
+	if err := h.versions.Forget(id); err != nil && h.logger != nil {
+		h.logger.Printf("failed to drop history of board %s: %v", id, err)
+	}
+	h.record(audit.Entry{Actor: actor, Action: "board.purged", BoardID: id, Revision: board.Revision, Details: map[string]string{"reason": reason}})
+	return nil
+}
+
+// purgeExpired purges the boards that have been in the trash for longer than
+// the retention period.
+func (h *Handler) purgeExpired(now time.Time) {
+	for _, b := range h.store.ListBoards() {
+		if at := h.purgeAt(b.Lifecycle); at != nil && !now.Before(*at) {
+			if err := h.purge(b.ID, "", "retention expired"); err != nil && h.logger != nil {
+				h.logger.Printf("failed to purge board %s: %v", b.ID, err)
+			}
+		}
+	}
+}
+
+// purgeLoop purges expired boards now and then every purgeInterval, or more
+// often for a shorter retention, until the handler is closed.
+func (h *Handler) purgeLoop() {
+	h.purgeExpired(time.Now())
+	ticker := time.NewTicker(min(purgeInterval, h.retention))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stopPurge:
+			return
+		case now := <-ticker.C:
+			h.purgeExpired(now)
+		}
+	}
+}
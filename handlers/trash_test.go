@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"test1/access"
+	"test1/models"
+	"test1/patch"
+	"test1/realtime"
+)
+
+// trashIDs lists the IDs of the boards in the trash as the caller sees it.
+func (s *testServer) trashIDs(t *testing.T, as ...string) []string {
+	t.Helper()
+	resp := s.do(t, http.MethodGet, "/trash", nil, as...)
+	expectStatus(t, resp, http.StatusOK)
+	var ids []string
+	for _, b := range decode[[]map[string]interface{}](t, resp) {
+		ids = append(ids, b["id"].(string))
+	}
+	return ids
+}
+
+func TestDeletingABoardNeedsIfMatch(t *testing.T) {
+	s := newTestServer(t)
+	board := s.createBoard(t, models.Board{Name: "Plan"})
+	path := "/boards/" + board.ID
+
+	expectStatus(t, s.do(t, http.MethodDelete, path, nil), http.StatusPreconditionRequired)
+	expectStatus(t, s.do(t, http.MethodDelete, path, nil, "If-Match", boardETag(board.Revision+1)), http.StatusPreconditionFailed)
+	expectStatus(t, s.do(t, http.MethodGet, path, nil), http.StatusOK)
+	expectStatus(t, s.do(t, http.MethodDelete, path, nil, "If-Match", boardETag(board.Revision)), http.StatusNoContent)
+	expectStatus(t, s.do(t, http.MethodGet, path, nil), http.StatusNotFound)
+}
+
+func TestTrashedAndArchivedBoardsRefuseWrites(t *testing.T) {
+	s := newTestServer(t)
+	writes := func(path string, revision int64) []*http.Response {
+		return []*http.Response{
+			s.do(t, http.MethodPut, path, models.Board{Name: "Changed"}, "If-Match", "*"),
+			s.do(t, http.MethodPost, path+"/notes", models.StickyNote{Content: "b"}),
+			s.do(t, http.MethodPatch, path+"/notes/n1", map[string]string{"content": "b"}),
+			s.do(t, http.MethodPost, path+"/ops", opsRequest{BaseRevision: revision, Ops: []patch.Operation{addComment("hi")}}),
+		}
+	}
+
+	archived := s.createBoard(t, models.Board{Name: "Plan", Notes: []models.StickyNote{{ID: "n1", Content: "a"}}})
+	resp := s.do(t, http.MethodPost, "/boards/"+archived.ID+"/archive", nil)
+	expectStatus(t, resp, http.StatusOK)
+	archived = decode[models.Board](t, resp)
+	for _, resp := range writes("/boards/"+archived.ID, archived.Revision) {
+		expectStatus(t, resp, http.StatusConflict)
+	}
+	expectStatus(t, s.do(t, http.MethodGet, "/boards/"+archived.ID, nil), http.StatusOK)
+
+	trashed := s.createBoard(t, models.Board{Name: "Plan", Notes: []models.StickyNote{{ID: "n1", Content: "a"}}})
+	expectStatus(t, s.do(t, http.MethodDelete, "/boards/"+trashed.ID, nil, "If-Match", "*"), http.StatusNoContent)
+	for _, resp := range writes("/boards/"+trashed.ID, trashed.Revision+1) {
+		expectStatus(t, resp, http.StatusNotFound)
+	}
+
+	for _, board := range []models.Board{archived, trashed} {
+		current, _ := s.h.store.GetBoard(board.ID)
+		if current.Name != "Plan" || len(current.Notes) != 1 || current.Notes[0].Content != "a" || len(current.Comments) != 0 {
+			t.Fatalf("expected board %s to be left alone, got %+v", board.ID, current)
+		}
+	}
+}
+
+func TestOnlyOwnersSeeAndRestoreTheTrash(t *testing.T) {
+	s := newTestServer(t)
+	board := s.createOwnedBoard(t, "olive", map[string]access.Role{"eddie": access.Editor})
+	owner, editor := []string{"X-Participant", "olive"}, []string{"X-Participant", "eddie"}
+	expectStatus(t, s.do(t, http.MethodDelete, "/boards/"+board.ID, nil, append(owner, "If-Match", "*")...), http.StatusNoContent)
+
+	if ids := s.trashIDs(t, editor...); len(ids) != 0 {
+		t.Fatalf("expected editors not to see the trashed board, got %v", ids)
+	}
+	if ids := s.trashIDs(t, owner...); !slices.Equal(ids, []string{board.ID}) {
+		t.Fatalf("expected the owner to see the trashed board, got %v", ids)
+	}
+
+	restore := "/trash/" + board.ID + "/restore"
+	expectStatus(t, s.do(t, http.MethodPost, restore, nil, editor...), http.StatusForbidden)
+	expectStatus(t, s.do(t, http.MethodPost, restore, nil, "X-Participant", "stranger"), http.StatusNotFound)
+	expectStatus(t, s.do(t, http.MethodDelete, "/trash/"+board.ID, nil, editor...), http.StatusForbidden)
+	expectStatus(t, s.do(t, http.MethodPost, restore, nil, owner...), http.StatusOK)
+
+	expectStatus(t, s.do(t, http.MethodGet, "/boards/"+board.ID, nil, editor...), http.StatusOK)
+	if ids := s.trashIDs(t, owner...); len(ids) != 0 {
+		t.Fatalf("expected the restored board to leave the trash, got %v", ids)
+	}
+	expectStatus(t, s.do(t, http.MethodPost, restore, nil, owner...), http.StatusNotFound)
+}
+
+func TestPurgingDropsEverythingKeptForTheBoard(t *testing.T) {
+	s := newTestServer(t)
+	purged := func(board models.Board) {
+		t.Helper()
+		if _, ok := s.h.store.GetBoard(board.ID); ok {
+			t.Fatal("expected the board to be deleted")
+		}
+		if versions, _ := s.h.versions.List(board.ID); len(versions) != 0 {
+			t.Fatalf("expected no history left, got %+v", versions)
+		}
+		if _, ok := s.h.undo.PopUndo(board.ID, "olive"); ok {
+			t.Fatal("expected no undo steps left")
+		}
+		if members := s.h.access.Members(board.ID); len(members) != 0 {
+			t.Fatalf("expected no members left, got %+v", members)
+		}
+		s.events.mu.Lock()
+		forgotten := slices.Contains(s.events.forgotten, board.ID)
+		s.events.mu.Unlock()
+		if !forgotten {
+			t.Fatal("expected the event stream to be dropped")
+		}
+		expectStatus(t, s.do(t, http.MethodGet, "/boards/"+board.ID, nil, "X-Participant", "olive"), http.StatusNotFound)
+	}
+	trash := func() models.Board {
+		t.Helper()
+		board := s.createOwnedBoard(t, "olive", map[string]access.Role{"eddie": access.Editor})
+		expectStatus(t, s.do(t, http.MethodPatch, "/boards/"+board.ID+"/notes/n1", map[string]string{"content": "b"}, "X-Participant", "olive"), http.StatusOK)
+		expectStatus(t, s.do(t, http.MethodDelete, "/boards/"+board.ID, nil, "X-Participant", "olive", "If-Match", "*"), http.StatusNoContent)
+		return board
+	}
+
+	byHand := trash()
+	expectStatus(t, s.do(t, http.MethodDelete, "/trash/"+byHand.ID, nil, "X-Participant", "olive"), http.StatusNoContent)
+	purged(byHand)
+
+	expired := trash()
+	s.h.retention = time.Hour
+	s.h.purgeExpired(time.Now().Add(30 * time.Minute))
+	if _, ok := s.h.store.GetBoard(expired.ID); !ok {
+		t.Fatal("expected a board within retention to be kept")
+	}
+	s.h.purgeExpired(time.Now().Add(2 * time.Hour))
+	purged(expired)
+}
+
+// dialBoard opens a board socket as participant and waits until it is served.
+func (s *testServer) dialBoard(t *testing.T, boardID, participant string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/boards/"+boardID+"/ws?participant="+participant, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.WriteJSON(realtime.Message{Type: realtime.TypePing, ID: "1"}); err != nil {
+		t.Fatalf("write ping: %v", err)
+	}
+	for {
+		var reply realtime.Reply
+		if err := conn.ReadJSON(&reply); err != nil {
+			t.Fatalf("expected a pong, got %v", err)
+		}
+		if reply.Type == realtime.TypePong {
+			return conn
+		}
+	}
+}
+
+// expectDisconnected reads what is left on conn until the server closes it.
+func expectDisconnected(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+	for {
+		_, _, err := conn.ReadMessage()
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			t.Fatal("expected the socket to be disconnected")
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func TestTrashingAndPurgingDisconnectSockets(t *testing.T) {
+	s := newTestServer(t)
+	board := s.createOwnedBoard(t, "olive", nil)
+	conn := s.dialBoard(t, board.ID, "olive")
+	expectStatus(t, s.do(t, http.MethodDelete, "/boards/"+board.ID, nil, "X-Participant", "olive", "If-Match", "*"), http.StatusNoContent)
+	expectDisconnected(t, conn)
+
+	// A board trashed elsewhere, such as on another instance, still has sockets here when it is purged.
+	board = s.createOwnedBoard(t, "olive", nil)
+	conn = s.dialBoard(t, board.ID, "olive")
+	if _, err := s.h.store.MutateBoard(board.ID, func(b *models.Board) error {
+		now := time.Now().UTC()
+		b.DeletedAt = &now
+		return nil
+	}); err != nil {
+		t.Fatalf("trash: %v", err)
+	}
+	if err := s.h.purge(board.ID, "olive", "test"); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	expectDisconnected(t, conn)
+}
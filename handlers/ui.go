@@ -5,7 +5,10 @@ import (
 	"html/template"
 	"io/fs"
 	"net/http"
+	"net/url"
 
+	"test1/access"
+	"test1/auth"
 	"test1/models"
 )
 
@@ -26,23 +29,70 @@ func init() {
 }
 
 func (h *Handler) serveIndex(w http.ResponseWriter, r *http.Request) {
-	boards := h.store.ListBoards()
-	var board models.Board
-	if len(boards) == 0 {
-		board = h.store.CreateBoard(models.Board{Name: "Miro-style board"})
-		h.broadcastBoardEvent(board.ID, "board.created", board)
-	} else {
-		board = boards[0]
+	if _, ok := auth.FromContext(r.Context()); h.authRequired && !ok {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	boardID := r.URL.Query().Get("board")
+	if boardID == "" {
+		board, err := h.landingBoard(r)
+		if err != nil {
+			h.storeError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/?"+url.Values{"board": {board.ID}}.Encode(), http.StatusFound)
+		return
+	}
+	if !h.visible(boardID) || !h.boardRole(r, boardID).Allows(access.Viewer) {
+		http.NotFound(w, r)
+		return
 	}
 
 	data := struct {
 		BoardID string
-	}{BoardID: board.ID}
+	}{BoardID: boardID}
 
-	csp := "default-src 'self'; script-src 'self'; style-src 'self'; img-src 'self' data:; connect-src 'self'; font-src 'self'; object-src 'none'; base-uri 'self'; frame-ancestors 'self'"
-	w.Header().Set("Content-Security-Policy", csp)
+	setPageHeaders(w)
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if err := indexTmpl.Execute(w, data); err != nil {
 		http.Error(w, "failed to render page", http.StatusInternalServerError)
 	}
 }
+
+// landingBoard picks the board a visitor without ?board= is sent to: the most
+// recently updated board they are a member of, directly or through a
+// workspace, or the most recently updated open board for anonymous visitors.
+// Archived boards and boards in the trash are skipped. When there is none, a
+// new board is created, owned by the visitor if they are known.
+func (h *Handler) landingBoard(r *http.Request) (models.Board, error) {
+	actor := h.actorID(r)
+	var landing models.Board
+	for _, b := range h.store.ListBoards() {
+		if b.Trashed() || b.Archived() {
+			continue
+		}
+		open := h.openBoard(b.ID)
+		if (actor == "" && !open) || (actor != "" && (open || h.roleOf(b.ID, actor, "") == access.None)) {
+			continue
+		}
+		if landing.ID == "" || b.UpdatedAt.After(landing.UpdatedAt) {
+			landing = b
+		}
+	}
+	if landing.ID != "" {
+		return landing, nil
+	}
+	created, err := h.store.CreateBoard(models.Board{Name: "Miro-style board"})
+	if err != nil {
+		return models.Board{}, err
+	}
+	h.boardCreated(created, actor)
+	return created, nil
+}
+
+// setPageHeaders sets the content security policy shared by the HTML pages.
+func setPageHeaders(w http.ResponseWriter) {
+	csp := "default-src 'self'; script-src 'self'; style-src 'self'; img-src 'self' data:; connect-src 'self'; font-src 'self'; object-src 'none'; base-uri 'self'; frame-ancestors 'self'"
+	w.Header().Set("Content-Security-Policy", csp)
+}
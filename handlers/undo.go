@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"test1/models"
+	"test1/status"
+	"test1/undo"
+)
+
+// undoDepth is how many steps per participant and board can be undone.
+const undoDepth = 100
+
+// errNothingToRevert aborts an undo or redo step that no longer changes the board.
+var errNothingToRevert = errors.New("nothing to revert")
+
+// undoable reports whether a committed action is a participant's own edit that
+// undo should be able to reverse.
+func undoable(action string) bool {
+	switch action {
+	case "board.created", "board.undo", "board.redo", "board.archived", "board.unarchived", "board.trashed", "board.untrashed":
+		return false
+	}
+	return true
+}
+
+// handleUndo serves POST /boards/{id}/undo and /redo. Each step reverts one of the
+// caller's own revisions against the current board, leaving other participants'
+// later edits in place. Steps that no longer change anything are skipped.
+func (h *Handler) handleUndo(w http.ResponseWriter, r *http.Request, boardID string, redo bool) {
+	actor := h.actorID(r)
+	if actor == "" {
+		http.Error(w, "X-Participant header required", http.StatusBadRequest)
+		return
+	}
+	expected, _, err := ifMatchRevision(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.store.HasBoard(boardID) {
+		http.NotFound(w, r)
+		return
+	}
+
+	pop, keep, push, action := h.undo.PopUndo, h.undo.PushUndo, h.undo.PushRedo, "board.undo"
+	if redo {
+		pop, keep, push, action = h.undo.PopRedo, h.undo.PushRedo, h.undo.PushUndo, "board.redo"
+	}
+
+	for {
+		revision, ok := pop(boardID, actor)
+		if !ok {
+			http.Error(w, "nothing to "+action[len("board."):], http.StatusConflict)
+			return
+		}
+		before, after, ok, err := h.revisionStep(boardID, revision)
+		if err != nil {
+			keep(boardID, actor, revision)
+			h.historyError(w, err)
+			return
+		}
+		if !ok {
+			continue
+		}
+
+		var previous models.Board
+		board, err := h.mutateBoard(boardID, func(b *models.Board) error {
+			if err := expectRevision(b, expected); err != nil {
+				return err
+			}
+			previous = *b
+			reverted, changed, err := undo.Revert(before, after, *b)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				return errNothingToRevert
+			}
+			*b = status.Propagate(reverted)
+			return nil
+		})
+		if errors.Is(err, errNothingToRevert) {
+			continue
+		}
+		if err != nil {
+			// Keep the step so the client can retry, e.g. with a fresh If-Match.
+			keep(boardID, actor, revision)
+			h.itemError(w, r, err)
+			return
+		}
+
+		h.committed(board, actor, action, changedElements(previous, board))
+		push(boardID, actor, board.Revision)
+		h.broadcastBoardChange(board, "board.updated", board)
+		w.Header().Set("ETag", boardETag(board.Revision))
+		respondJSON(w, http.StatusOK, board)
+		return
+	}
+}
+
+// revisionStep loads the versions just before and at revision. ok is false when
+// history no longer holds both, for example after a restart without a history dir.
+func (h *Handler) revisionStep(boardID string, revision int64) (before, after models.Board, ok bool, err error) {
+	prev, ok, err := h.versions.Get(boardID, revision-1)
+	if err != nil || !ok {
+		return models.Board{}, models.Board{}, false, err
+	}
+	next, ok, err := h.versions.Get(boardID, revision)
+	if err != nil || !ok {
+		return models.Board{}, models.Board{}, false, err
+	}
+	return prev.Board, next.Board, true, nil
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"test1/history"
+	"test1/models"
+)
+
+// handleVersions serves /boards/{id}/versions, /versions/{rev} and /versions/{rev}/restore.
+func (h *Handler) handleVersions(w http.ResponseWriter, r *http.Request, boardID string, rest []string) {
+	if len(rest) == 0 || rest[0] == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if at := r.URL.Query().Get("at"); at != "" {
+			h.boardAt(w, r, boardID, at)
+			return
+		}
+		summaries, err := h.versions.List(boardID)
+		if err != nil {
+			h.historyError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, summaries)
+		return
+	}
+
+	revision, err := strconv.ParseInt(rest[0], 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case len(rest) == 1 && r.Method == http.MethodGet:
+		version, ok, err := h.versions.Get(boardID, revision)
+		if err != nil {
+			h.historyError(w, err)
+			return
+		}
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		respondJSON(w, http.StatusOK, version)
+	case len(rest) == 2 && rest[1] == "restore" && r.Method == http.MethodPost:
+		h.restoreVersion(w, r, boardID, revision)
+	case len(rest) > 2 || (len(rest) == 2 && rest[1] != "restore"):
+		http.NotFound(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// boardAt returns the board as it was at the given RFC 3339 timestamp.
+func (h *Handler) boardAt(w http.ResponseWriter, r *http.Request, boardID, at string) {
+	t, err := time.Parse(time.RFC3339, at)
+	if err != nil {
+		http.Error(w, "at must be an RFC 3339 timestamp", http.StatusBadRequest)
+		return
+	}
+	version, ok, err := h.versions.At(boardID, t)
+	if err != nil {
+		h.historyError(w, err)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	respondJSON(w, http.StatusOK, version)
+}
+
+// diffVersions compares ?from= with ?to= (default: the current board) item by item.
+func (h *Handler) diffVersions(w http.ResponseWriter, r *http.Request, boardID string) {
+	current, ok := h.store.GetBoard(boardID)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	from, ok := h.boardVersion(w, r, boardID, r.URL.Query().Get("from"), current)
+	if !ok {
+		return
+	}
+	to, ok := h.boardVersion(w, r, boardID, r.URL.Query().Get("to"), current)
+	if !ok {
+		return
+	}
+
+	diff, err := history.Diff(from, to)
+	if err != nil {
+		http.Error(w, "failed to compare versions", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, diff)
+}
+
+// boardVersion resolves a revision query parameter; an empty value means current.
+func (h *Handler) boardVersion(w http.ResponseWriter, r *http.Request, boardID, raw string, current models.Board) (models.Board, bool) {
+	if raw == "" {
+		return current, true
+	}
+	revision, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		http.Error(w, "revision must be a number", http.StatusBadRequest)
+		return models.Board{}, false
+	}
+	if revision == current.Revision {
+		return current, true
+	}
+	version, ok, err := h.versions.Get(boardID, revision)
+	if err != nil {
+		h.historyError(w, err)
+		return models.Board{}, false
+	}
+	if !ok {
+		http.Error(w, "unknown revision "+raw, http.StatusNotFound)
+		return models.Board{}, false
+	}
+	return version.Board, true
+}
+
+// restoreVersion writes the content of an old version as a new revision.
+func (h *Handler) restoreVersion(w http.ResponseWriter, r *http.Request, boardID string, revision int64) {
+	expected, _, err := ifMatchRevision(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	version, ok, err := h.versions.Get(boardID, revision)
+	if err != nil {
+		h.historyError(w, err)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	var previous models.Board
+	board, err := h.mutateBoard(boardID, func(b *models.Board) error {
+		if err := expectRevision(b, expected); err != nil {
+			return err
+		}
+		previous = *b
+		docs := b.TextDocs
+		*b = version.Board
+		b.TextDocs = docs
+		return nil
+	})
+	if err != nil {
+		h.itemError(w, r, err)
+		return
+	}
+
+	h.committed(board, h.actorID(r), "board.restored", changedElements(previous, board))
+	h.broadcastBoardChange(board, "board.updated", board)
+	w.Header().Set("ETag", boardETag(board.Revision))
+	respondJSON(w, http.StatusOK, board)
+}
+
+func (h *Handler) historyError(w http.ResponseWriter, err error) {
+	if h.logger != nil {
+		h.logger.Printf("history error: %v", err)
+	}
+	http.Error(w, "failed to read board history", http.StatusInternalServerError)
+}
@@ -27,6 +27,8 @@ import { createFlyingLogicController } from './controllers/flyingLogicController
         const paletteEl = document.getElementById('ribbon-palette-groups');
 
         const autoLayoutBtn = document.getElementById('auto-layout');
+        const showDriversBtn = document.getElementById('show-drivers');
+        const propagationSelect = document.getElementById('propagation-mode');
         const applyGroupBtn = document.getElementById('apply-group');
         const groupInput = document.getElementById('group-name');
         const groupSuggestions = document.getElementById('group-suggestions');
@@ -79,6 +81,7 @@ import { createFlyingLogicController } from './controllers/flyingLogicController
                         toolbar: causalToolbar,
                         deleteBtn,
                         autoLayoutBtn,
+                        showDriversBtn,
                         applyGroupBtn,
                         groupInput,
                         groupSuggestions,
@@ -91,11 +94,22 @@ import { createFlyingLogicController } from './controllers/flyingLogicController
         setupRibbonTabs();
         setupModeToggle();
         setupSettingsPanel();
+        setupPropagationMode();
         resizeCanvas();
         boardApi.loadBoard();
         activateController('miro');
 
         window.addEventListener('resize', resizeCanvas);
+        window.addEventListener('keydown', handleUndoKeys);
+
+        function handleUndoKeys(e) {
+                if (!(e.ctrlKey || e.metaKey) || e.key.toLowerCase() !== 'z') return;
+                const target = e.target;
+                if (target && (target.isContentEditable || ['INPUT', 'TEXTAREA', 'SELECT'].includes(target.tagName))) return;
+                e.preventDefault();
+                if (e.shiftKey) boardApi.redo();
+                else boardApi.undo();
+        }
 
         function setupModeToggle() {
                 modeButtons.forEach((btn) => {
@@ -151,7 +165,16 @@ import { createFlyingLogicController } from './controllers/flyingLogicController
                 });
         }
 
+        function setupPropagationMode() {
+                propagationSelect?.addEventListener('change', () => {
+                        if (!state.board) return;
+                        state.board.propagation = propagationSelect.value;
+                        boardApi.syncBoard();
+                });
+        }
+
         function handleBoardChange() {
+                if (propagationSelect && state.board) propagationSelect.value = state.board.propagation || '';
                 refreshGroupingMetadata(state);
                 recomputeStatusViews(state);
                 controllers.causal.updateGroupSuggestions?.();
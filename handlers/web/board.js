@@ -1,20 +1,47 @@
 import { recomputeStatusViews, refreshGroupingMetadata } from './state.js';
+import { applyPatch } from './patch.js';
+import { csrfToken } from './utils.js';
+
+// Board collections that the server exposes as item-level endpoints.
+const collections = [
+        { key: 'shapes', path: 'shapes', event: 'shape' },
+        { key: 'strokes', path: 'strokes', event: 'stroke' },
+        { key: 'texts', path: 'texts', event: 'text' },
+        { key: 'notes', path: 'notes', event: 'note' },
+        { key: 'connectors', path: 'connectors', event: 'connector' },
+        { key: 'causalNodes', path: 'causal-nodes', event: 'causalNode' },
+        { key: 'causalLinks', path: 'causal-links', event: 'causalLink' },
+        { key: 'comments', path: 'comments', event: 'comment' },
+];
+
+const collectionsByEvent = new Map(collections.map((c) => [c.event, c]));
 
 export function createBoardApi(state, renderer, setStatus, meta, onBoardChange) {
         async function loadBoard() {
                 try {
-                        const res = await fetch(`/boards/${state.boardId}`);
+                        await loadIdentity();
+                        const res = await fetch(`/boards/${state.boardId}`, { headers: readHeaders() });
+                        if (res.status === 401) {
+                                location.href = '/login';
+                                return;
+                        }
+                        if (res.status === 404) {
+                                setStatus('Board not found or not shared with you');
+                                return;
+                        }
                         if (!res.ok) {
                                 throw new Error('Failed to load board');
                         }
                         const board = normalizeBoard(await res.json());
                         state.board = board;
+                        state.syncedBoard = cloneBoard(board);
                         refreshGroupingMetadata(state);
                         recomputeStatusViews(state);
                         if (onBoardChange) onBoardChange(state.board);
                         renderer.render(meta);
                         renderer.renderMeta(meta);
                         connectEvents();
+                        loadParticipants();
                 } catch (err) {
                         console.error(err);
                         setStatus('Could not load board');
@@ -35,11 +62,107 @@ export function createBoardApi(state, renderer, setStatus, meta, onBoardChange)
                 };
         }
 
-        function connectEvents() {
-                if (state.eventSource) {
-                        state.eventSource.close();
+        // loadIdentity adopts the signed-in account as this participant, so the cursor and
+        // presence shown to others match what the server attributes writes to.
+        async function loadIdentity() {
+                try {
+                        const res = await fetch('/auth/me');
+                        if (!res.ok) return;
+                        state.user = await res.json();
+                        state.myCursor.id = state.user.id;
+                        state.myCursor.label = state.user.name;
+                        document.getElementById('account-name').textContent = state.user.name;
+                        const signOut = document.getElementById('sign-out');
+                        signOut.hidden = false;
+                        signOut.onclick = async () => {
+                                await fetch('/auth/logout', { method: 'POST', headers: writeHeaders() });
+                                location.href = '/login';
+                        };
+                } catch (err) {
+                        console.error(err);
                 }
-                const es = new EventSource(`/boards/${state.boardId}/events`);
+        }
+
+        // reloadBoard replaces local state with the server's board after events were lost.
+        async function reloadBoard() {
+                try {
+                        const res = await fetch(`/boards/${state.boardId}`, { headers: readHeaders() });
+                        if (!res.ok) throw new Error('Failed to reload board');
+                        state.board = normalizeBoard(await res.json());
+                        state.syncedBoard = cloneBoard(state.board);
+                        boardChanged();
+                        await loadParticipants();
+                        setStatus('Live');
+                } catch (err) {
+                        console.error(err);
+                        setStatus('Could not reload board');
+                }
+        }
+
+        async function loadParticipants() {
+                try {
+                        const res = await fetch(`/boards/${state.boardId}/participants`, { headers: readHeaders() });
+                        if (!res.ok) return;
+                        state.participants = new Map((await res.json()).map((p) => [p.id, p]));
+                        renderer.renderMeta(meta);
+                } catch (err) {
+                        console.error(err);
+                }
+        }
+
+        // presenceQuery identifies this participant on event connections, which cannot carry headers.
+        function presenceQuery() {
+                const query = new URLSearchParams({
+                        participant: state.myCursor.id,
+                        label: state.myCursor.label,
+                        color: state.myCursor.color,
+                });
+                const csrf = csrfToken();
+                if (csrf) query.set('csrf', csrf);
+                if (state.shareToken) query.set('share', state.shareToken);
+                return query.toString();
+        }
+
+        // connectEvents prefers the board socket, which also carries cursor moves back to
+        // the server, and falls back to server-sent events if it cannot be opened.
+        function connectEvents(reconnecting = false) {
+                closeEvents();
+                if (typeof WebSocket === 'undefined') {
+                        connectEventSource();
+                        return;
+                }
+                const proto = location.protocol === 'https:' ? 'wss' : 'ws';
+                const ws = new WebSocket(`${proto}://${location.host}/boards/${state.boardId}/ws?${presenceQuery()}`);
+                let opened = false;
+                ws.onopen = () => {
+                        opened = true;
+                        setStatus('Live');
+                        // Socket frames are not replayed, so catch up on anything missed while away.
+                        if (reconnecting) reloadBoard();
+                };
+                ws.onmessage = (evt) => {
+                        try {
+                                const message = JSON.parse(evt.data);
+                                if (message.boardId) handleEvent(message);
+                                else if (message.type === 'error') console.warn('socket error', message.data);
+                        } catch (err) {
+                                console.error('bad event', err);
+                        }
+                };
+                ws.onclose = () => {
+                        state.socket = null;
+                        if (!opened) {
+                                connectEventSource();
+                                return;
+                        }
+                        setStatus('Reconnecting events…');
+                        setTimeout(() => connectEvents(true), 1000);
+                };
+                state.socket = ws;
+        }
+
+        function connectEventSource() {
+                const es = new EventSource(`/boards/${state.boardId}/events?${presenceQuery()}`);
                 es.onmessage = (evt) => {
                         try {
                                 const message = JSON.parse(evt.data);
@@ -52,31 +175,163 @@ export function createBoardApi(state, renderer, setStatus, meta, onBoardChange)
                 state.eventSource = es;
         }
 
+        function closeEvents() {
+                if (state.eventSource) {
+                        state.eventSource.close();
+                        state.eventSource = null;
+                }
+                if (state.socket) {
+                        state.socket.onclose = null;
+                        state.socket.close();
+                        state.socket = null;
+                }
+        }
+
+        function sendSocket(type, data) {
+                if (!state.socket || state.socket.readyState !== WebSocket.OPEN) return false;
+                state.socket.send(JSON.stringify({ type, data }));
+                return true;
+        }
+
         function handleEvent(event) {
                 if (!event || event.boardId !== state.boardId) return;
+                if (event.revision && event.type !== 'board.ops') trackRevision(event.revision);
                 switch (event.type) {
                 case 'board.updated':
                 case 'board.created':
+                case 'board.archived':
+                case 'board.unarchived':
                         state.board = normalizeBoard(event.data);
-                        refreshGroupingMetadata(state);
-                        recomputeStatusViews(state);
-                        if (onBoardChange) onBoardChange(state.board);
+                        state.syncedBoard = cloneBoard(state.board);
+                        boardChanged();
+                        if (event.type === 'board.archived') setStatus('Archived – read-only');
+                        if (event.type === 'board.unarchived') setStatus('Live');
+                        break;
+                case 'board.deleted':
+                        setStatus('This board was moved to the trash');
+                        break;
+                case 'board.ops':
+                        applyRemoteOps(event.data);
+                        break;
+                case 'causalNodes.recomputed':
+                        applyRecomputedNodes(event.data?.nodes || [], event.data?.unsettledLoops || []);
+                        boardChanged();
+                        break;
+                case 'resync.required':
+                        setStatus('Resyncing…');
+                        reloadBoard();
+                        break;
+                case 'presence.joined':
+                case 'presence.updated':
+                case 'presence.idle':
+                        state.participants.set(event.data.id, event.data);
+                        renderer.renderMeta(meta);
+                        break;
+                case 'presence.left':
+                        state.participants.delete(event.data.id);
+                        state.cursors.delete(event.data.id);
                         renderer.renderMeta(meta);
                         renderer.render();
                         break;
-                case 'cursor.moved': {
-                        const c = event.data;
-                        if (c && c.id !== state.myCursor.id) {
-                                state.cursors.set(c.id, { ...c, lastSeen: Date.now() });
-                                renderer.render();
+                case 'cursor.expired':
+                        state.cursors.delete(event.data.id);
+                        renderer.render();
+                        break;
+                case 'cursors.moved': {
+                        const now = Date.now();
+                        let moved = false;
+                        for (const c of event.data || []) {
+                                if (c.id === state.myCursor.id) continue;
+                                state.cursors.set(c.id, { ...c, lastSeen: now });
+                                moved = true;
                         }
+                        if (moved) renderer.render();
                         break;
                 }
                 default:
+                        if (applyItemEvent(event)) boardChanged();
                         break;
                 }
         }
 
+        function boardChanged() {
+                refreshGroupingMetadata(state);
+                recomputeStatusViews(state);
+                if (onBoardChange) onBoardChange(state.board);
+                renderer.renderMeta(meta);
+                renderer.render();
+        }
+
+        // applyItemEvent applies a "<item>.created|updated|deleted" event to both the
+        // live board and the last synced copy so it is not mistaken for a local edit.
+        function applyItemEvent(event) {
+                const [prefix, action] = event.type.split('.');
+                const coll = collectionsByEvent.get(prefix);
+                if (!coll || !state.board) return false;
+                const item = normalizeItem(coll.key, event.data);
+                for (const board of [state.board, state.syncedBoard]) {
+                        if (!board) continue;
+                        const items = board[coll.key] || [];
+                        const idx = items.findIndex((it) => it.id === item.id);
+                        if (action === 'deleted') {
+                                if (idx >= 0) items.splice(idx, 1);
+                        } else if (idx >= 0) {
+                                items[idx] = { ...items[idx], ...structuredClone(item) };
+                        } else {
+                                items.push(structuredClone(item));
+                        }
+                        board[coll.key] = items;
+                }
+                return true;
+        }
+
+        // applyRemoteOps applies accepted patches to the synced board and replays any
+        // unsynced local edits on top; a revision gap falls back to a full reload.
+        async function applyRemoteOps(result) {
+                if (!result || !state.syncedBoard) return;
+                const base = state.syncedBoard;
+                let latest;
+                if ((base.revision || 0) === result.baseRevision) {
+                        try {
+                                latest = normalizeBoard(applyPatch(cloneBoard(base), result.ops));
+                                latest.revision = result.revision;
+                        } catch (err) {
+                                console.warn('could not apply ops, reloading', err);
+                        }
+                } else if ((base.revision || 0) >= result.revision) {
+                        return;
+                }
+                if (!latest) {
+                        const res = await fetch(`/boards/${state.boardId}`, { headers: readHeaders() });
+                        if (!res.ok) return;
+                        latest = normalizeBoard(await res.json());
+                }
+                state.board = rebaseBoard(base, state.board, latest);
+                state.syncedBoard = cloneBoard(latest);
+                boardChanged();
+        }
+
+        function applyRecomputedNodes(nodes, unsettledLoops) {
+                const byId = new Map(normalizeCausalNodes(nodes).map((n) => [n.id, n]));
+                for (const board of [state.board, state.syncedBoard]) {
+                        if (!board) continue;
+                        board.unsettledLoops = unsettledLoops;
+                        board.causalNodes = board.causalNodes.map((node) => {
+                                const fresh = byId.get(node.id);
+                                if (!fresh) return node;
+                                return {
+                                        ...node,
+                                        status: fresh.status,
+                                        confidence: fresh.confidence,
+                                        statusUpdatedAt: fresh.statusUpdatedAt,
+                                        evidence: fresh.evidence,
+                                };
+                        });
+                }
+        }
+
+        // syncBoard sends only the items that changed since the last sync, so concurrent
+        // edits to different items on the same board do not overwrite each other.
         async function syncBoard() {
                 if (!state.board) return;
                 const normalizedConnectors = normalizeConnectors(state.board.connectors);
@@ -84,13 +339,18 @@ export function createBoardApi(state, renderer, setStatus, meta, onBoardChange)
                 state.board.causalLinks = state.board.causalLinks || [];
                 state.board.causalNodes = state.board.causalNodes || [];
                 setStatus('Syncing…');
+                const base = state.syncedBoard;
+                const current = cloneBoard(state.board);
+                state.syncedBoard = current;
+                state.rebaseBase = base;
                 try {
-                        const payload = { ...state.board, connectors: normalizedConnectors };
-                        await fetch(`/boards/${state.boardId}`, {
-                                method: 'PUT',
-                                headers: { 'Content-Type': 'application/json' },
-                                body: JSON.stringify(payload),
-                        });
+                        if (!base || base.name !== current.name || (base.propagation || '') !== (current.propagation || '')) {
+                                await putBoard(current);
+                        } else {
+                                for (const coll of collections) {
+                                        await syncCollection(coll, base[coll.key] || [], current[coll.key] || []);
+                                }
+                        }
                         setStatus('Live');
                 } catch (err) {
                         console.error(err);
@@ -98,19 +358,205 @@ export function createBoardApi(state, renderer, setStatus, meta, onBoardChange)
                 }
         }
 
+        async function putBoard(board) {
+                // Text documents are maintained by the server.
+                const { textDocs, ...payload } = board;
+                const res = await fetch(`/boards/${state.boardId}`, {
+                        method: 'PUT',
+                        headers: writeHeaders({ 'If-Match': `"${board.revision || 0}"` }),
+                        body: JSON.stringify(payload),
+                });
+                if (res.status === 412 || res.status === 409) {
+                        await rebaseOnLatest(board);
+                        return;
+                }
+                if (!res.ok) throw new Error(`board sync failed: ${res.status}`);
+                const saved = normalizeBoard(await res.json());
+                trackRevision(saved.revision);
+        }
+
+        // rebaseOnLatest replays the local edits made since the last sync on top of the
+        // board another participant saved, then syncs the result item by item.
+        async function rebaseOnLatest(local) {
+                const res = await fetch(`/boards/${state.boardId}`, { headers: readHeaders() });
+                if (!res.ok) throw new Error('Failed to reload board');
+                const latest = normalizeBoard(await res.json());
+                const base = state.rebaseBase || latest;
+                state.board = rebaseBoard(base, local, latest);
+                state.syncedBoard = cloneBoard(latest);
+                state.rebaseBase = null;
+                boardChanged();
+                setStatus('Merged remote changes');
+                if (local.name !== base.name || (local.propagation || '') !== (base.propagation || '')) {
+                        await putBoard({ ...latest, name: local.name, propagation: local.propagation });
+                        state.syncedBoard.name = local.name;
+                        state.syncedBoard.propagation = local.propagation;
+                }
+                for (const coll of collections) {
+                        await syncCollection(coll, latest[coll.key] || [], state.board[coll.key] || []);
+                }
+                state.syncedBoard = cloneBoard(state.board);
+        }
+
+        // undo and redo step through this participant's own edits on the server, which
+        // reverts only what those edits touched.
+        function undo() {
+                return stepHistory('undo');
+        }
+
+        function redo() {
+                return stepHistory('redo');
+        }
+
+        async function stepHistory(direction) {
+                try {
+                        const res = await fetch(`/boards/${state.boardId}/${direction}`, {
+                                method: 'POST',
+                                headers: writeHeaders(),
+                        });
+                        if (res.status === 409) {
+                                setStatus(`Nothing to ${direction}`);
+                                return;
+                        }
+                        if (!res.ok) throw new Error(`${direction} failed: ${res.status}`);
+                        state.board = normalizeBoard(await res.json());
+                        state.syncedBoard = cloneBoard(state.board);
+                        boardChanged();
+                        setStatus('Live');
+                } catch (err) {
+                        console.error(err);
+                        setStatus(`Could not ${direction}`);
+                }
+        }
+
+        // readHeaders identifies this participant and presents the share link the board
+        // was opened with, which is what grants access to members of no board.
+        function readHeaders() {
+                const headers = { 'X-Participant': state.myCursor.id };
+                if (state.shareToken) headers['X-Share-Token'] = state.shareToken;
+                return headers;
+        }
+
+        // writeHeaders attributes a write to this participant in the board history and
+        // proves to the server that a signed-in write comes from this page.
+        function writeHeaders(extra = {}) {
+                const headers = {
+                        'Content-Type': 'application/json',
+                        ...readHeaders(),
+                        ...extra,
+                };
+                const csrf = csrfToken();
+                if (csrf) headers['X-CSRF-Token'] = csrf;
+                return headers;
+        }
+
+        function trackRevision(revision) {
+                if (typeof revision !== 'number' || !state.board) return;
+                if (revision > (state.board.revision || 0)) state.board.revision = revision;
+                if (state.syncedBoard && revision > (state.syncedBoard.revision || 0)) {
+                        state.syncedBoard.revision = revision;
+                }
+        }
+
+        async function syncCollection(coll, before, after) {
+                const url = `/boards/${state.boardId}/${coll.path}`;
+                const previous = new Map(before.map((item) => [item.id, item]));
+                const seen = new Set();
+                for (const item of after) {
+                        seen.add(item.id);
+                        const old = previous.get(item.id);
+                        if (!old) {
+                                await sendItem(url, 'POST', item);
+                        } else if (JSON.stringify(old) !== JSON.stringify(item)) {
+                                await sendItem(`${url}/${encodeURIComponent(item.id)}`, 'PATCH', item);
+                        }
+                }
+                for (const id of previous.keys()) {
+                        if (!seen.has(id)) {
+                                await sendItem(`${url}/${encodeURIComponent(id)}`, 'DELETE');
+                        }
+                }
+        }
+
+        async function sendItem(url, method, item) {
+                const init = { method, headers: writeHeaders() };
+                if (item) {
+                        init.body = JSON.stringify(item);
+                }
+                const res = await fetch(url, init);
+                if (!res.ok && res.status !== 404) {
+                        throw new Error(`${method} ${url} failed: ${res.status}`);
+                }
+                const etag = res.headers.get('ETag');
+                if (etag) trackRevision(Number(etag.replaceAll('"', '')));
+        }
+
         function maybeSendCursor(position) {
                 state.myCursor.position = position;
                 const now = performance.now();
                 if (now - state.lastCursorSent < 120) return;
                 state.lastCursorSent = now;
+                if (sendSocket('cursor', state.myCursor)) return;
                 fetch(`/boards/${state.boardId}/cursor`, {
                         method: 'POST',
-                        headers: { 'Content-Type': 'application/json' },
+                        headers: writeHeaders(),
                         body: JSON.stringify(state.myCursor),
                 }).catch(() => {});
         }
 
-        return { loadBoard, syncBoard, maybeSendCursor };
+        // loadDrivers fetches the driver analysis of a causal node: its upstream nodes
+        // ranked by influence and the strongest paths into it.
+        async function loadDrivers(nodeId) {
+                const res = await fetch(`/boards/${state.boardId}/causal-nodes/${encodeURIComponent(nodeId)}/drivers`, { headers: readHeaders() });
+                if (!res.ok) throw new Error(`driver analysis failed: ${res.status}`);
+                return res.json();
+        }
+
+        return { loadBoard, syncBoard, maybeSendCursor, undo, redo, loadDrivers };
+}
+
+function cloneBoard(board) {
+        return structuredClone(board);
+}
+
+// rebaseBoard applies the item changes made between base and local onto latest.
+function rebaseBoard(base, local, latest) {
+        const merged = cloneBoard(latest);
+        if (local.name !== base.name) merged.name = local.name;
+        if ((local.propagation || '') !== (base.propagation || '')) merged.propagation = local.propagation;
+        for (const { key } of collections) {
+                const before = new Map((base[key] || []).map((item) => [item.id, item]));
+                const mine = new Map((local[key] || []).map((item) => [item.id, item]));
+                let items = merged[key] || [];
+                for (const [id, item] of mine) {
+                        const old = before.get(id);
+                        if (old && JSON.stringify(old) === JSON.stringify(item)) continue;
+                        const idx = items.findIndex((it) => it.id === id);
+                        if (idx >= 0) {
+                                items[idx] = structuredClone(item);
+                        } else {
+                                items.push(structuredClone(item));
+                        }
+                }
+                for (const id of before.keys()) {
+                        if (!mine.has(id)) items = items.filter((it) => it.id !== id);
+                }
+                merged[key] = items;
+        }
+        return merged;
+}
+
+function normalizeItem(key, item) {
+        switch (key) {
+        case 'connectors':
+                return normalizeConnector(item);
+        case 'causalNodes':
+                return normalizeCausalNodes([item])[0];
+        case 'causalLinks':
+                return normalizeCausalLink(item);
+        default:
+                return item;
+        }
 }
 
 function normalizeConnector(connector) {
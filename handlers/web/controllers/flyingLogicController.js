@@ -23,7 +23,7 @@ export function createFlyingLogicController(context, elements) {
                 syncBoard,
         } = context;
 
-        const { toolbar, deleteBtn, autoLayoutBtn, applyGroupBtn, groupInput, groupSuggestions, paletteEl } = elements;
+        const { toolbar, deleteBtn, autoLayoutBtn, showDriversBtn, applyGroupBtn, groupInput, groupSuggestions, paletteEl } = elements;
 
         let cleanup = [];
 
@@ -39,6 +39,7 @@ export function createFlyingLogicController(context, elements) {
                 setupToolbar();
                 if (deleteBtn) addListener(deleteBtn, 'click', deleteSelection);
                 if (autoLayoutBtn) addListener(autoLayoutBtn, 'click', applyAutoLayout);
+                if (showDriversBtn) addListener(showDriversBtn, 'click', highlightDrivers);
                 if (applyGroupBtn) addListener(applyGroupBtn, 'click', () => assignGroupTag(groupInput?.value || ''));
                 if (groupInput) {
                         addListener(groupInput, 'keydown', (evt) => {
@@ -465,6 +466,34 @@ export function createFlyingLogicController(context, elements) {
                 syncBoard();
         }
 
+        // highlightDrivers marks the strongest causal paths into the selected node, or
+        // clears the highlight when no causal node is selected.
+        async function highlightDrivers() {
+                const target = (state.selection?.items || []).find((item) => item.hit.type === 'causal-node');
+                if (!target) {
+                        state.driverHighlight = null;
+                        render();
+                        setStatus('Select a causal node to see what drives it');
+                        return;
+                }
+                try {
+                        const analysis = await boardApi.loadDrivers(target.hit.item.id);
+                        state.driverHighlight = {
+                                target: analysis.target,
+                                links: new Set(analysis.paths.flatMap((path) => path.links)),
+                        };
+                        render();
+                        const labels = new Map(state.board.causalNodes.map((node) => [node.id, node.label || node.id]));
+                        const top = analysis.drivers
+                                .slice(0, 3)
+                                .map((d) => `${labels.get(d.nodeId) || d.nodeId} (${d.influence >= 0 ? '+' : ''}${d.influence.toFixed(2)})`);
+                        setStatus(top.length ? `Main drivers: ${top.join(', ')}` : 'This node has no upstream drivers');
+                } catch (err) {
+                        console.error(err);
+                        setStatus('Driver analysis failed');
+                }
+        }
+
         function assignGroupTag(tag) {
                 const trimmed = tag.trim();
                 const targets = (state.selection?.items || []).filter((item) => item.hit.type === 'causal-node');
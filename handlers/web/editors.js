@@ -270,6 +270,66 @@ export function createEditors(state, renderer, onCommit) {
                 select.style.marginBottom = '8px';
                 wrapper.appendChild(select);
 
+                const operatorLabel = document.createElement('label');
+                operatorLabel.textContent = 'Combine inputs with';
+                operatorLabel.style.display = 'block';
+                operatorLabel.style.fontSize = '12px';
+                operatorLabel.style.marginBottom = '4px';
+                wrapper.appendChild(operatorLabel);
+
+                const operator = document.createElement('select');
+                [
+                        ['average', 'Average'],
+                        ['and', 'AND (weakest input)'],
+                        ['or', 'OR (strongest input)'],
+                        ['sum', 'Sum'],
+                        ['product', 'Product'],
+                        ['not', 'NOT (inverted average)'],
+                        ['fuzzy-and', 'Fuzzy AND'],
+                        ['fuzzy-or', 'Fuzzy OR'],
+                ].forEach(([value, text]) => {
+                        const opt = document.createElement('option');
+                        opt.value = value;
+                        opt.textContent = text;
+                        operator.appendChild(opt);
+                });
+                operator.value = node.operator || 'average';
+                operator.style.width = '100%';
+                operator.style.marginBottom = '8px';
+                wrapper.appendChild(operator);
+
+                const valueLabel = document.createElement('label');
+                valueLabel.textContent = 'Starting value (simulation)';
+                valueLabel.style.display = 'block';
+                valueLabel.style.fontSize = '12px';
+                valueLabel.style.marginBottom = '4px';
+                wrapper.appendChild(valueLabel);
+
+                const value = document.createElement('input');
+                value.type = 'text';
+                value.inputMode = 'decimal';
+                value.value = `${ensureNumericWeight(node.value, 0)}`;
+                value.placeholder = '0';
+                value.style.width = '100%';
+                value.style.marginBottom = '8px';
+                wrapper.appendChild(value);
+
+                const oddsLabel = document.createElement('label');
+                oddsLabel.textContent = 'Status odds (positive, neutral, negative)';
+                oddsLabel.style.display = 'block';
+                oddsLabel.style.fontSize = '12px';
+                oddsLabel.style.marginBottom = '4px';
+                wrapper.appendChild(oddsLabel);
+
+                const odds = document.createElement('input');
+                odds.type = 'text';
+                const p = node.probabilities;
+                odds.value = p ? `${p.positive}, ${p.neutral}, ${p.negative}` : '';
+                odds.placeholder = 'e.g. 0.6, 0.3, 0.1 (blank if known)';
+                odds.style.width = '100%';
+                odds.style.marginBottom = '8px';
+                wrapper.appendChild(odds);
+
                 const actions = document.createElement('div');
                 actions.style.display = 'flex';
                 actions.style.gap = '8px';
@@ -289,6 +349,12 @@ export function createEditors(state, renderer, onCommit) {
                 const commit = () => {
                         node.label = input.value || 'Node';
                         node.kind = select.value || 'variable';
+                        node.operator = operator.value === 'average' ? '' : operator.value;
+                        node.value = ensureNumericWeight(parseFloat(value.value), 0);
+                        const chances = parseNumbers(odds.value);
+                        node.probabilities = chances.length === 3
+                                ? { positive: chances[0], neutral: chances[1], negative: chances[2] }
+                                : undefined;
                         node.color = node.color || colorForKind(node.kind);
                         hideEditor();
                         onCommit();
@@ -376,6 +442,57 @@ export function createEditors(state, renderer, onCommit) {
                 weightHint.style.marginBottom = '8px';
                 wrapper.appendChild(weightHint);
 
+                const dynamicsLabel = document.createElement('label');
+                dynamicsLabel.textContent = 'Delay (ticks) and rate (simulation)';
+                dynamicsLabel.style.display = 'block';
+                dynamicsLabel.style.fontSize = '12px';
+                dynamicsLabel.style.marginBottom = '4px';
+                wrapper.appendChild(dynamicsLabel);
+
+                const dynamics = document.createElement('div');
+                dynamics.style.display = 'flex';
+                dynamics.style.gap = '8px';
+                dynamics.style.marginBottom = '8px';
+
+                const delay = document.createElement('input');
+                delay.type = 'number';
+                delay.min = '0';
+                delay.step = '1';
+                delay.value = `${link.delay || 0}`;
+                delay.style.flex = '1';
+                delay.style.minWidth = '0';
+                dynamics.appendChild(delay);
+
+                const rate = document.createElement('input');
+                rate.type = 'text';
+                rate.inputMode = 'decimal';
+                rate.value = link.rate ? `${link.rate}` : '';
+                rate.placeholder = 'none (sets value)';
+                rate.style.flex = '1';
+                rate.style.minWidth = '0';
+                dynamics.appendChild(rate);
+                wrapper.appendChild(dynamics);
+
+                const spreadLabel = document.createElement('label');
+                spreadLabel.textContent = 'Weight range (min, mode, max)';
+                spreadLabel.style.display = 'block';
+                spreadLabel.style.fontSize = '12px';
+                spreadLabel.style.marginBottom = '4px';
+                wrapper.appendChild(spreadLabel);
+
+                const spread = document.createElement('input');
+                spread.type = 'text';
+                const d = link.distribution;
+                if (d && d.kind === 'normal') {
+                        spread.value = `${d.mean || 0} ± ${d.stdDev || 0}`;
+                } else if (d) {
+                        spread.value = `${d.min || 0}, ${d.mode || 0}, ${d.max || 0}`;
+                }
+                spread.placeholder = 'e.g. 0.5, 1, 2 or 1 ± 0.2 (blank if known)';
+                spread.style.width = '100%';
+                spread.style.marginBottom = '8px';
+                wrapper.appendChild(spread);
+
                 const actions = document.createElement('div');
                 actions.style.display = 'flex';
                 actions.style.gap = '8px';
@@ -408,6 +525,9 @@ export function createEditors(state, renderer, onCommit) {
                                 return;
                         }
                         link.weight = parsed;
+                        link.delay = Math.max(0, parseInt(delay.value, 10) || 0);
+                        link.rate = ensureNumericWeight(parseFloat(rate.value), 0);
+                        link.distribution = parseDistribution(spread.value);
                         hideEditor();
                         onCommit();
                         renderer.render();
@@ -468,6 +588,27 @@ export function createEditors(state, renderer, onCommit) {
                 };
         }
 
+        function parseNumbers(text) {
+                return text.split(/[,;\s]+/).filter(Boolean).map(parseFloat).filter(Number.isFinite);
+        }
+
+        // parseDistribution reads "min, mode, max" as a triangular weight
+        // distribution and "mean ± stdDev" as a normal one.
+        function parseDistribution(text) {
+                if (text.includes('±')) {
+                        const [mean, stdDev] = text.split('±').map(parseFloat);
+                        if (Number.isFinite(mean) && Number.isFinite(stdDev)) {
+                                return { kind: 'normal', mean, stdDev };
+                        }
+                        return undefined;
+                }
+                const values = parseNumbers(text);
+                if (values.length !== 3) {
+                        return undefined;
+                }
+                return { kind: 'triangular', min: values[0], mode: values[1], max: values[2] };
+        }
+
         function ensureNumericWeight(value, fallback = 1) {
                 const num = typeof value === 'number' ? value : parseFloat(value);
                 return Number.isFinite(num) ? num : fallback;
@@ -0,0 +1,45 @@
+const form = document.getElementById('login-form');
+const errorEl = document.getElementById('login-error');
+const submit = document.getElementById('submit');
+const toggle = document.getElementById('toggle-register');
+const nameField = document.getElementById('name-field');
+const sso = document.getElementById('sso');
+
+let registering = false;
+
+async function loadConfig() {
+        const res = await fetch('/auth/config');
+        if (!res.ok) return;
+        const config = await res.json();
+        toggle.hidden = !config.registration;
+        sso.hidden = !config.oidc;
+}
+
+toggle.addEventListener('click', () => {
+        registering = !registering;
+        nameField.hidden = !registering;
+        submit.textContent = registering ? 'Create account' : 'Sign in';
+        toggle.textContent = registering ? 'I already have an account' : 'Create an account instead';
+        errorEl.textContent = '';
+});
+
+sso.addEventListener('click', () => {
+        location.href = '/auth/oidc/login?return=/';
+});
+
+form.addEventListener('submit', async (evt) => {
+        evt.preventDefault();
+        const data = Object.fromEntries(new FormData(form));
+        const res = await fetch(registering ? '/auth/register' : '/auth/login', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(data),
+        });
+        if (!res.ok) {
+                errorEl.textContent = (await res.text()).trim() || 'Sign-in failed';
+                return;
+        }
+        location.href = '/';
+});
+
+loadConfig().catch((err) => console.error(err));
@@ -0,0 +1,78 @@
+// Minimal RFC 6902 JSON Patch support for applying "board.ops" events.
+
+function parsePointer(pointer) {
+        if (!pointer) return [];
+        return pointer
+                .slice(1)
+                .split('/')
+                .map((token) => token.replaceAll('~1', '/').replaceAll('~0', '~'));
+}
+
+function resolveParent(doc, tokens) {
+        let node = doc;
+        for (const token of tokens.slice(0, -1)) {
+                node = Array.isArray(node) ? node[Number(token)] : node?.[token];
+                if (node === undefined) throw new Error(`patch path not found: ${tokens.join('/')}`);
+        }
+        return node;
+}
+
+function getValue(doc, tokens) {
+        if (tokens.length === 0) return doc;
+        const parent = resolveParent(doc, tokens);
+        const last = tokens[tokens.length - 1];
+        return Array.isArray(parent) ? parent[Number(last)] : parent[last];
+}
+
+function addValue(doc, tokens, value) {
+        const parent = resolveParent(doc, tokens);
+        const last = tokens[tokens.length - 1];
+        if (Array.isArray(parent)) {
+                const idx = last === '-' ? parent.length : Number(last);
+                parent.splice(idx, 0, value);
+        } else {
+                parent[last] = value;
+        }
+}
+
+function removeValue(doc, tokens) {
+        const parent = resolveParent(doc, tokens);
+        const last = tokens[tokens.length - 1];
+        if (Array.isArray(parent)) {
+                return parent.splice(Number(last), 1)[0];
+        }
+        const value = parent[last];
+        delete parent[last];
+        return value;
+}
+
+// applyPatch mutates doc in place. Root-level operations are not supported
+// because the server never emits them.
+export function applyPatch(doc, ops) {
+        for (const op of ops || []) {
+                const path = parsePointer(op.path);
+                switch (op.op) {
+                case 'add':
+                        addValue(doc, path, structuredClone(op.value));
+                        break;
+                case 'remove':
+                        removeValue(doc, path);
+                        break;
+                case 'replace':
+                        removeValue(doc, path);
+                        addValue(doc, path, structuredClone(op.value));
+                        break;
+                case 'move':
+                        addValue(doc, path, removeValue(doc, parsePointer(op.from)));
+                        break;
+                case 'copy':
+                        addValue(doc, path, structuredClone(getValue(doc, parsePointer(op.from))));
+                        break;
+                case 'test':
+                        break;
+                default:
+                        throw new Error(`unknown patch op ${op.op}`);
+                }
+        }
+        return doc;
+}
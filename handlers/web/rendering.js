@@ -1,4 +1,4 @@
-import { blend, clamp, distance } from './utils.js';
+import { blend, clamp, distance, escapeHtml } from './utils.js';
 import { toScreenPoint } from './geometry.js';
 import { defaultSettings } from './state.js';
 
@@ -160,6 +160,14 @@ export function createRenderer(ctx, canvas, state) {
                 const width = Math.max(1.5, (link.weight || 1) * state.scale);
                 const color = polarityColor(link.polarity);
                 ctx.save();
+                if (link.id && state.driverHighlight?.links.has(link.id)) {
+                        ctx.strokeStyle = 'rgba(250, 204, 21, 0.55)';
+                        ctx.lineWidth = width + 8;
+                        ctx.beginPath();
+                        ctx.moveTo(start.x, start.y);
+                        ctx.lineTo(end.x, end.y);
+                        ctx.stroke();
+                }
                 ctx.strokeStyle = color;
                 ctx.lineWidth = width;
                 ctx.beginPath();
@@ -414,10 +422,23 @@ export function createRenderer(ctx, canvas, state) {
                                 const rollup = state.statusRollup?.get(node.id);
                                 const badge = node.status ? ` – ${node.status} (${Math.round((node.confidence || 0) * 100)}%)` : '';
                                 const evidence = rollup?.summary ? ` [+${rollup.summary.positive}/-${rollup.summary.negative}/~${rollup.summary.neutral}]` : '';
-                                return `${node.label || node.id}${badge}${evidence}`;
+                                const operator = node.operator ? ` ${node.operator.toUpperCase()}` : '';
+                                const drivers = (node.evidence || []).filter((ev) => ev.dominant).map((ev) => ev.sourceLabel || ev.sourceId);
+                                const driven = drivers.length ? ` ← ${drivers.join(', ')}` : '';
+                                return `${escapeHtml(node.label || node.id)}${operator}${badge}${evidence}${escapeHtml(driven)}`;
                         })
                         .join('<br/>');
-                metaEl.innerHTML = `ID: ${state.board.id}<br/>Name: ${state.board.name}<br/>Shapes: ${state.board.shapes.length}<br/>Notes: ${state.board.notes.length}<br/>Texts: ${state.board.texts.length}<br/>Connectors: ${state.board.connectors.length}<br/>Causal nodes: ${state.board.causalNodes.length}<br/>Causal links: ${state.board.causalLinks.length}<br/>Comments: ${state.board.comments.length}<br/>Updated: ${updated}<br/><br/><strong>Causal status</strong><br/>${statusLines}`;
+                const nodeLabel = (id) => {
+                        const node = state.board.causalNodes.find((n) => n.id === id);
+                        return escapeHtml(node?.label || id);
+                };
+                const loopLines = (state.board.unsettledLoops || [])
+                        .map((loop) => `Loop did not settle: ${loop.nodes.map(nodeLabel).join(' → ')}`)
+                        .join('<br/>');
+                const participantLines = [...(state.participants?.values() || [])]
+                        .map((p) => `${escapeHtml(p.label || p.id)}${p.id === state.myCursor.id ? ' (you)' : ''} – ${p.status}`)
+                        .join('<br/>');
+                metaEl.innerHTML = `ID: ${state.board.id}<br/>Name: ${state.board.name}<br/>Shapes: ${state.board.shapes.length}<br/>Notes: ${state.board.notes.length}<br/>Texts: ${state.board.texts.length}<br/>Connectors: ${state.board.connectors.length}<br/>Causal nodes: ${state.board.causalNodes.length}<br/>Causal links: ${state.board.causalLinks.length}<br/>Comments: ${state.board.comments.length}<br/>Updated: ${updated}${state.board.archivedAt ? '<br/>Archived – read-only' : ''}<br/><br/><strong>Participants</strong><br/>${participantLines || 'Only you'}<br/><br/><strong>Causal status</strong><br/>${statusLines}${loopLines ? `<br/>${loopLines}` : ''}`;
         }
 
         function pruneCursors() {
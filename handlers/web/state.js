@@ -40,14 +40,22 @@ export function createInitialState(boardId) {
         const state = {
                 boardId,
                 board: null,
+                syncedBoard: null,
+                rebaseBase: null,
                 tool: 'pan',
                 scale: 1,
                 offset: { x: 0, y: 0 },
                 pan: { active: false, origin: null, startOffset: null, button: null },
                 drawing: null,
                 selection: null,
+                // driverHighlight holds the strongest paths into a goal node, from its driver analysis.
+                driverHighlight: null,
                 marquee: null,
                 eventSource: null,
+                socket: null,
+                user: null,
+                // shareToken is the share link secret from ?share=, presented on every request.
+                shareToken: new URLSearchParams(location.search).get('share') || '',
                 myCursor: {
                         id: crypto.randomUUID ? crypto.randomUUID() : Math.random().toString(16).slice(2),
                         label: settings.cursorLabel,
@@ -55,6 +63,7 @@ export function createInitialState(boardId) {
                         position: { x: 0, y: 0 },
                 },
                 cursors: new Map(),
+                participants: new Map(),
                 lastCursorSent: 0,
                 strokeSettings: { width: settings.strokeWidth, smoothing: settings.strokeSmoothing },
                 connectorDefaults: {
@@ -21,3 +21,13 @@ export function blend(a, b, t) {
         const amount = clamp(isNaN(t) ? 0.5 : t, 0, 1);
         return { x: a.x + (b.x - a.x) * amount, y: a.y + (b.y - a.y) * amount };
 }
+
+export function escapeHtml(value) {
+        return String(value).replace(/[&<>"']/g, (ch) => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;' })[ch]);
+}
+
+// csrfToken returns the signed-in session's CSRF token, which writes must echo.
+export function csrfToken() {
+        const match = document.cookie.match(/(?:^|;\s*)board_csrf=([^;]*)/);
+        return match ? decodeURIComponent(match[1]) : '';
+}
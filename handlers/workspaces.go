@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"test1/access"
+	"test1/audit"
+	"test1/workspace"
+)
+
+// WithWorkspaces keeps workspaces, folders and board placements in store instead of in memory.
+func WithWorkspaces(store *workspace.Store) Option {
+	return func(h *Handler) { h.workspaces = store }
+}
+
+// boardMoved is broadcast when a board is filed in another workspace or folder.
+const boardMoved = "board.moved"
+
+// workspaceResponse is a workspace with its folders and the caller's role in it.
+type workspaceResponse struct {
+	workspace.Workspace
+	Role    access.Role        `json:"role"`
+	Folders []workspace.Folder `json:"folders"`
+}
+
+// workspaceRequiredRole is the least workspace role a request to
+// /workspaces/{id}/... needs; parts is the path below /workspaces/. Members can
+// read the workspace, editors manage its folders, and owners rename or delete
+// it and manage its members.
+func workspaceRequiredRole(method string, parts []string) access.Role {
+	switch {
+	case method == http.MethodGet || method == http.MethodHead:
+		return access.Viewer
+	case len(parts) > 1 && parts[1] == "folders":
+		return access.Editor
+	}
+	return access.Owner
+}
+
+func (h *Handler) handleWorkspaces(w http.ResponseWriter, r *http.Request) {
+	actor := h.actorID(r)
+	switch r.Method {
+	case http.MethodGet:
+		respondJSON(w, http.StatusOK, h.workspaces.List(actor))
+	case http.MethodPost:
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if actor == "" {
+			http.Error(w, "creating a workspace needs a signed-in user or an X-Participant id", http.StatusBadRequest)
+			return
+		}
+		ws, err := h.workspaces.Create(req.Name, actor)
+		if err != nil {
+			h.workspaceError(w, r, err)
+			return
+		}
+		h.recordWorkspace(r, "workspace.created", ws.ID, nil)
+		respondJSON(w, http.StatusCreated, ws)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) handleWorkspaceByID(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/workspaces/"), "/")
+	id := parts[0]
+	if _, ok := h.workspaces.Get(id); !ok {
+		http.NotFound(w, r)
+		return
+	}
+	role := h.workspaces.Role(id, h.actorID(r))
+	if !authorize(w, r, "workspace", role, workspaceRequiredRole(r.Method, parts)) {
+		return
+	}
+
+	if len(parts) > 1 {
+		switch parts[1] {
+		case "members":
+			h.handleWorkspaceMembers(w, r, id, parts[2:])
+		case "folders":
+			h.handleFolders(w, r, id, parts[2:])
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.respondWorkspace(w, r, id, http.StatusOK)
+	case http.MethodPatch:
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if _, err := h.workspaces.Rename(id, req.Name); err != nil {
+			h.workspaceError(w, r, err)
+			return
+		}
+		h.recordWorkspace(r, "workspace.renamed", id, map[string]string{"name": req.Name})
+		h.respondWorkspace(w, r, id, http.StatusOK)
+	case http.MethodDelete:
+		if err := h.workspaces.Delete(id); err != nil {
+			h.workspaceError(w, r, err)
+			return
+		}
+		h.recordWorkspace(r, "workspace.deleted", id, nil)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) respondWorkspace(w http.ResponseWriter, r *http.Request, id string, status int) {
+	ws, ok := h.workspaces.Get(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	respondJSON(w, status, workspaceResponse{Workspace: ws, Role: h.workspaces.Role(id, h.actorID(r)), Folders: h.workspaces.Folders(id)})
+}
+
+func (h *Handler) handleWorkspaceMembers(w http.ResponseWriter, r *http.Request, id string, rest []string) {
+	if len(rest) != 1 {
+		http.NotFound(w, r)
+		return
+	}
+	principal, err := url.PathUnescape(rest[0])
+	if err != nil || principal == "" {
+		http.Error(w, "invalid member id", http.StatusBadRequest)
+		return
+	}
+	action, details := "", map[string]string{"principal": principal}
+	switch r.Method {
+	case http.MethodPut:
+		var req struct {
+			Role string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		role, ok := access.ParseRole(req.Role)
+		if !ok {
+			http.Error(w, "role must be owner, editor, commenter or viewer", http.StatusBadRequest)
+			return
+		}
+		err = h.workspaces.SetMember(id, principal, role)
+		action, details["role"] = "workspace.member.set", string(role)
+	case http.MethodDelete:
+		err = h.workspaces.RemoveMember(id, principal)
+		action = "workspace.member.removed"
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		h.workspaceError(w, r, err)
+		return
+	}
+	h.recordWorkspace(r, action, id, details)
+	// Workspace roles apply to every board in it.
+	for _, boardID := range h.workspaces.Boards(id) {
+		h.hubs.Revalidate(boardID)
+	}
+	h.respondWorkspace(w, r, id, http.StatusOK)
+}
+
+func (h *Handler) handleFolders(w http.ResponseWriter, r *http.Request, id string, rest []string) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	switch {
+	case len(rest) == 0 && r.Method == http.MethodGet:
+		respondJSON(w, http.StatusOK, h.workspaces.Folders(id))
+	case len(rest) == 0 && r.Method == http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		folder, err := h.workspaces.CreateFolder(id, req.Name)
+		if err != nil {
+			h.workspaceError(w, r, err)
+			return
+		}
+		h.recordWorkspace(r, "folder.created", id, map[string]string{"folder": folder.ID, "name": folder.Name})
+		respondJSON(w, http.StatusCreated, folder)
+	case len(rest) == 1 && r.Method == http.MethodPatch:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		folder, err := h.workspaces.RenameFolder(id, rest[0], req.Name)
+		if err != nil {
+			h.workspaceError(w, r, err)
+			return
+		}
+		h.recordWorkspace(r, "folder.renamed", id, map[string]string{"folder": folder.ID, "name": folder.Name})
+		respondJSON(w, http.StatusOK, folder)
+	case len(rest) == 1 && r.Method == http.MethodDelete:
+		// Boards in the folder stay in the workspace, outside any folder.
+		if err := h.workspaces.DeleteFolder(id, rest[0]); err != nil {
+			h.workspaceError(w, r, err)
+			return
+		}
+		h.recordWorkspace(r, "folder.deleted", id, map[string]string{"folder": rest[0]})
+		w.WriteHeader(http.StatusNoContent)
+	case len(rest) > 1:
+		http.NotFound(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// canPlace reports whether the caller may file a board at p and otherwise
+// answers the request: they need to be an editor of the workspace, and the
+// folder has to be one of its folders.
+func (h *Handler) canPlace(w http.ResponseWriter, r *http.Request, p workspace.Placement) bool {
+	if p.WorkspaceID == "" {
+		if p.FolderID != "" {
+			http.Error(w, "a folder needs its workspace", http.StatusBadRequest)
+			return false
+		}
+		return true
+	}
+	if _, ok := h.workspaces.Get(p.WorkspaceID); !ok {
+		http.Error(w, "workspace not found", http.StatusNotFound)
+		return false
+	}
+	if !authorize(w, r, "workspace", h.workspaces.Role(p.WorkspaceID, h.actorID(r)), access.Editor) {
+		return false
+	}
+	if _, ok := h.workspaces.Folder(p.WorkspaceID, p.FolderID); p.FolderID != "" && !ok {
+		http.Error(w, "folder not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// moveBoard files a board in a workspace and folder, or makes it personal
+// again with an empty workspaceId. Only the board's owners can move it.
+func (h *Handler) moveBoard(w http.ResponseWriter, r *http.Request, boardID string) {
+	if !h.store.HasBoard(boardID) {
+		http.NotFound(w, r)
+		return
+	}
+	var target workspace.Placement
+	if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !h.canPlace(w, r, target) {
+		return
+	}
+	// A board leaving its workspace without members of its own would be open
+	// to everyone; whoever moves it keeps it.
+	if actor := h.actorID(r); target.WorkspaceID == "" && actor != "" && h.access.Open(boardID) && !h.openBoard(boardID) {
+		if err := h.access.SetMember(boardID, actor, access.Owner); err != nil {
+			h.accessError(w, r, err)
+			return
+		}
+	}
+	if err := h.workspaces.Place(boardID, target); err != nil {
+		h.workspaceError(w, r, err)
+		return
+	}
+	h.record(audit.Entry{Actor: h.actorID(r), Action: boardMoved, BoardID: boardID, Details: map[string]string{"workspace": target.WorkspaceID, "folder": target.FolderID}})
+	h.accessChanged(boardID)
+	h.broadcastBoardEvent(boardID, boardMoved, target)
+	respondJSON(w, http.StatusOK, target)
+}
+
+// recordWorkspace records a change to a workspace, its members or its folders.
+func (h *Handler) recordWorkspace(r *http.Request, action, workspaceID string, details map[string]string) {
+	if details == nil {
+		details = map[string]string{}
+	}
+	details["workspace"] = workspaceID
+	h.record(audit.Entry{Actor: h.actorID(r), Action: action, Details: details})
+}
+
+func (h *Handler) workspaceError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, workspace.ErrNotFound):
+		http.NotFound(w, r)
+	case errors.Is(err, workspace.ErrNotEmpty), errors.Is(err, access.ErrLastOwner):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, workspace.ErrNameRequired):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		if h.logger != nil {
+			h.logger.Printf("workspace error: %v", err)
+		}
+		http.Error(w, "failed to save workspaces", http.StatusInternalServerError)
+	}
+}
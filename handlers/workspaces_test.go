@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"test1/models"
+	"test1/workspace"
+)
+
+func TestBoardsThatCannotBePlacedAreNotKept(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "workspaces")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	store, err := workspace.NewStore(filepath.Join(dir, "workspaces.json"))
+	if err != nil {
+		t.Fatalf("open workspaces: %v", err)
+	}
+	team, err := store.Create("Team", "olive")
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	s := newTestServer(t, WithWorkspaces(store))
+
+	// Placing the board fails once the workspaces file can no longer be written.
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	resp := s.do(t, http.MethodPost, "/boards?workspace="+team.ID, models.Board{Name: "Plan"}, "X-Participant", "olive")
+	expectStatus(t, resp, http.StatusInternalServerError)
+	if boards := s.h.store.ListBoards(); len(boards) != 0 {
+		t.Fatalf("expected the unplaced board to be dropped, got %+v", boards)
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+
+	"test1/access"
+	"test1/auth"
+	"test1/models"
+	"test1/presence"
+	"test1/realtime"
+	"test1/storage"
+)
+
+// opsAccepted is the reply to an ops message that was applied.
+const opsAccepted = "ops.accepted"
+
+// presenceUpdate is a participant announcing how they want to be shown.
+type presenceUpdate struct {
+	Label string `json:"label,omitempty"`
+	Color string `json:"color,omitempty"`
+}
+
+// socketError reports a failed socket message with the status the HTTP API would use.
+type socketError struct {
+	Status   int    `json:"status"`
+	Error    string `json:"error"`
+	Revision int64  `json:"revision,omitempty"`
+}
+
+// serveBoardSocket upgrades GET /boards/{id}/ws. The socket receives every board
+// event and accepts cursor, ops, presence and ping messages. Browsers cannot set
+// headers on a websocket, so the participant may also be given as ?participant=.
+// Any site can open a websocket with the visitor's cookies, so a session-signed
+// socket must pass the session's CSRF token as ?csrf= to act as the user.
+func (h *Handler) serveBoardSocket(w http.ResponseWriter, r *http.Request, boardID string) {
+	if !h.visible(boardID) {
+		http.NotFound(w, r)
+		return
+	}
+	id, signedIn := auth.FromContext(r.Context())
+	if signedIn && !id.CheckCSRF(r.URL.Query().Get("csrf")) {
+		http.Error(w, "missing or invalid CSRF token", http.StatusForbidden)
+		return
+	}
+	participant, update := h.connectingParticipant(r)
+	if participant != "" && websocket.IsWebSocketUpgrade(r) {
+		leave := h.presence.Join(boardID, participant, update)
+		defer leave()
+	}
+	// The role is looked up per message so access changes apply to open sockets.
+	share := shareSecret(r)
+	role := func() access.Role { return h.roleOf(boardID, participant, share) }
+	allowed := func() bool { return h.visible(boardID) && role().Allows(access.Viewer) }
+	sender := cursorSender(r)
+	h.hubs.ServeWS(w, r, boardID, participant, func(c *realtime.Client, msg realtime.Message) {
+		h.handleSocketMessage(c, msg, socketCaller{id: id, signedIn: signedIn, sender: sender, role: role})
+	}, allowed)
+}
+
+// socketCaller is who opened a socket: the signed-in user, if any, who its
+// cursor moves count against and their current role on the board.
+type socketCaller struct {
+	id       auth.Identity
+	signedIn bool
+	sender   string
+	role     func() access.Role
+}
+
+func (h *Handler) handleSocketMessage(c *realtime.Client, msg realtime.Message, from socketCaller) {
+	id, signedIn := from.id, from.signedIn
+	switch msg.Type {
+	case realtime.TypeCursor:
+		var cursor models.Cursor
+		if err := json.Unmarshal(msg.Data, &cursor); err != nil {
+			c.Reply(msg.ID, realtime.TypeError, socketError{Status: http.StatusBadRequest, Error: "invalid cursor"})
+			return
+		}
+		stampCursor(&cursor, id, signedIn)
+		if cursor.ID = h.claimable(cursor.ID); cursor.ID == "" {
+			cursor.ID = c.Participant()
+		}
+		if cursor.ID == "" {
+			c.Reply(msg.ID, realtime.TypeError, socketError{Status: http.StatusBadRequest, Error: "cursor id required"})
+			return
+		}
+		// Moves over the rate limit are dropped; a later move supersedes them anyway.
+		h.moveCursor(c.BoardID(), from.sender, cursor)
+	case realtime.TypeOps:
+		var req opsRequest
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			c.Reply(msg.ID, realtime.TypeError, socketError{Status: http.StatusBadRequest, Error: "invalid ops"})
+			return
+		}
+		result, err := h.applyOps(c.BoardID(), opsCaller{actor: c.Participant(), author: id.Name, role: from.role()}, req)
+		if err != nil {
+			c.Reply(msg.ID, realtime.TypeError, h.socketError(err))
+			return
+		}
+		c.Reply(msg.ID, opsAccepted, result)
+	case realtime.TypePresence:
+		var update presenceUpdate
+		if len(msg.Data) > 0 {
+			if err := json.Unmarshal(msg.Data, &update); err != nil {
+				c.Reply(msg.ID, realtime.TypeError, socketError{Status: http.StatusBadRequest, Error: "invalid presence"})
+				return
+			}
+		}
+		if c.Participant() == "" {
+			c.Reply(msg.ID, realtime.TypeError, socketError{Status: http.StatusBadRequest, Error: "participant required"})
+			return
+		}
+		if signedIn {
+			update.Label = id.Name
+		}
+		h.presence.Touch(c.BoardID(), c.Participant(), presence.Update{Label: update.Label, Color: update.Color})
+	default:
+		c.Reply(msg.ID, realtime.TypeError, socketError{Status: http.StatusBadRequest, Error: "unknown message type " + msg.Type})
+	}
+}
+
+// socketError maps a write error to the status storeError would send over HTTP.
+func (h *Handler) socketError(err error) socketError {
+	var reqErr *requestError
+	var conflict *storage.ConflictError
+	switch {
+	case errors.As(err, &reqErr):
+		return socketError{Status: reqErr.status, Error: reqErr.message}
+	case errors.As(err, &conflict):
+		return socketError{Status: http.StatusConflict, Error: "board has changed", Revision: conflict.Current}
+	case errors.Is(err, storage.ErrNotFound):
+		return socketError{Status: http.StatusNotFound, Error: "board not found"}
+	}
+	if h.logger != nil {
+		h.logger.Printf("store error: %v", err)
+	}
+	return socketError{Status: http.StatusInternalServerError, Error: "failed to persist board"}
+}
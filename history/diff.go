@@ -0,0 +1,150 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"test1/models"
+)
+
+// Collections lists the JSON names of the board item lists compared by Diff.
+var Collections = []string{"shapes", "strokes", "texts", "notes", "connectors", "causalNodes", "causalLinks", "comments", "scenarios"}
+
+// ItemChange is an item present in both versions with different content.
+type ItemChange struct {
+	ID     string          `json:"id"`
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// CollectionDiff lists the item-level differences within one collection.
+type CollectionDiff struct {
+	Added   []json.RawMessage `json:"added,omitempty"`
+	Removed []json.RawMessage `json:"removed,omitempty"`
+	Changed []ItemChange      `json:"changed,omitempty"`
+}
+
+// BoardDiff describes how a board changed between two revisions. Collections
+// without differences are omitted.
+type BoardDiff struct {
+	From       int64  `json:"from"`
+	To         int64  `json:"to"`
+	NameBefore string `json:"nameBefore,omitempty"`
+	NameAfter  string `json:"nameAfter,omitempty"`
+	// PropagationBefore and PropagationAfter are set when the board's
+	// propagation mode changed; empty is the default status mode.
+	PropagationBefore string                    `json:"propagationBefore,omitempty"`
+	PropagationAfter  string                    `json:"propagationAfter,omitempty"`
+	Collections       map[string]CollectionDiff `json:"collections"`
+}
+
+// Empty reports whether the diff found no differences.
+func (d BoardDiff) Empty() bool {
+	return d.NameBefore == d.NameAfter && d.PropagationBefore == d.PropagationAfter && len(d.Collections) == 0
+}
+
+// ItemIDs lists the IDs of the items the diff found added, removed or changed.
+func (d BoardDiff) ItemIDs() []string {
+	var ids []string
+	for _, name := range Collections {
+		cd, ok := d.Collections[name]
+		if !ok {
+			continue
+		}
+		for _, raw := range append(append([]json.RawMessage(nil), cd.Added...), cd.Removed...) {
+			var ident struct {
+				ID string `json:"id"`
+			}
+			if json.Unmarshal(raw, &ident) == nil && ident.ID != "" {
+				ids = append(ids, ident.ID)
+			}
+		}
+		for _, c := range cd.Changed {
+			ids = append(ids, c.ID)
+		}
+	}
+	return ids
+}
+
+// Diff compares two versions of a board item by item, matching items on their ID.
+func Diff(from, to models.Board) (BoardDiff, error) {
+	diff := BoardDiff{From: from.Revision, To: to.Revision, Collections: make(map[string]CollectionDiff)}
+	if from.Name != to.Name {
+		diff.NameBefore, diff.NameAfter = from.Name, to.Name
+	}
+	if from.Propagation != to.Propagation {
+		diff.PropagationBefore, diff.PropagationAfter = from.Propagation, to.Propagation
+	}
+
+	before, err := itemsByCollection(from)
+	if err != nil {
+		return BoardDiff{}, err
+	}
+	after, err := itemsByCollection(to)
+	if err != nil {
+		return BoardDiff{}, err
+	}
+
+	for _, name := range Collections {
+		var cd CollectionDiff
+		old := before[name]
+		oldByID := make(map[string]json.RawMessage, len(old))
+		for _, item := range old {
+			oldByID[item.id] = item.raw
+		}
+		newIDs := make(map[string]bool, len(after[name]))
+		for _, item := range after[name] {
+			newIDs[item.id] = true
+			prev, ok := oldByID[item.id]
+			switch {
+			case !ok:
+				cd.Added = append(cd.Added, item.raw)
+			case !bytes.Equal(prev, item.raw):
+				cd.Changed = append(cd.Changed, ItemChange{ID: item.id, Before: prev, After: item.raw})
+			}
+		}
+		for _, item := range old {
+			if !newIDs[item.id] {
+				cd.Removed = append(cd.Removed, item.raw)
+			}
+		}
+		if len(cd.Added)+len(cd.Removed)+len(cd.Changed) > 0 {
+			diff.Collections[name] = cd
+		}
+	}
+	return diff, nil
+}
+
+type rawItem struct {
+	id  string
+	raw json.RawMessage
+}
+
+func itemsByCollection(board models.Board) (map[string][]rawItem, error) {
+	encoded, err := json.Marshal(board)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+
+	out := make(map[string][]rawItem, len(Collections))
+	for _, name := range Collections {
+		var items []json.RawMessage
+		if err := json.Unmarshal(fields[name], &items); err != nil {
+			return nil, err
+		}
+		for _, raw := range items {
+			var ident struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(raw, &ident); err != nil {
+				return nil, err
+			}
+			out[name] = append(out[name], rawItem{id: ident.ID, raw: raw})
+		}
+	}
+	return out, nil
+}
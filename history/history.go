@@ -0,0 +1,293 @@
+// Package history records every accepted board revision so boards can be
+// inspected, compared and restored as of an earlier point in time.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"test1/models"
+)
+
+// Version is a snapshot of a board taken right after an accepted change.
+type Version struct {
+	Revision int64        `json:"revision"`
+	At       time.Time    `json:"at"`
+	Actor    string       `json:"actor,omitempty"`
+	Action   string       `json:"action"`
+	Board    models.Board `json:"board"`
+}
+
+// Summary describes a version without its board snapshot.
+type Summary struct {
+	Revision int64     `json:"revision"`
+	At       time.Time `json:"at"`
+	Actor    string    `json:"actor,omitempty"`
+	Action   string    `json:"action"`
+}
+
+// DefaultLimit is how many of each board's latest versions a recorder keeps.
+const DefaultLimit = 1000
+
+// Recorder keeps board versions in memory and, when given a directory, appends
+// them to one JSON Lines file per board so history survives restarts. Only the
+// latest limit versions of a board are kept; a history file is rewritten with
+// just those once it has grown to twice as many lines.
+type Recorder struct {
+	mu       sync.Mutex
+	dir      string
+	limit    int
+	versions map[string][]Version
+	loaded   map[string]bool
+	// lines counts the lines in each board's history file.
+	lines map[string]int
+}
+
+// NewRecorder creates a recorder that keeps the latest limit versions of each
+// board, or all of them when limit is 0. An empty dir keeps history in memory
+// only.
+func NewRecorder(dir string, limit int) (*Recorder, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("create history dir: %w", err)
+		}
+	}
+	return &Recorder{
+		dir:      dir,
+		limit:    max(limit, 0),
+		versions: make(map[string][]Version),
+		loaded:   make(map[string]bool),
+		lines:    make(map[string]int),
+	}, nil
+}
+
+// Record stores board as the version for its current revision.
+func (r *Recorder) Record(board models.Board, actor, action string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.loadLocked(board.ID); err != nil {
+		return err
+	}
+	v := Version{Revision: board.Revision, At: board.UpdatedAt, Actor: actor, Action: action, Board: board.Clone()}
+	if v.At.IsZero() {
+		v.At = time.Now().UTC()
+	}
+
+	if r.dir != "" {
+		if err := r.appendLocked(v); err != nil {
+			return err
+		}
+	}
+
+	versions := r.versions[board.ID]
+	i := sort.Search(len(versions), func(i int) bool { return versions[i].Revision >= v.Revision })
+	if i < len(versions) && versions[i].Revision == v.Revision {
+		versions[i] = v
+	} else {
+		versions = append(versions, Version{})
+		copy(versions[i+1:], versions[i:])
+		versions[i] = v
+	}
+	r.versions[board.ID] = r.trim(versions)
+
+	if r.dir != "" && r.limit > 0 && r.lines[board.ID] >= 2*r.limit {
+		return r.rewriteLocked(board.ID)
+	}
+	return nil
+}
+
+// List returns summaries of all versions of a board, oldest first.
+func (r *Recorder) List(boardID string) ([]Summary, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.loadLocked(boardID); err != nil {
+		return nil, err
+	}
+	versions := r.versions[boardID]
+	summaries := make([]Summary, len(versions))
+	for i, v := range versions {
+		summaries[i] = Summary{Revision: v.Revision, At: v.At, Actor: v.Actor, Action: v.Action}
+	}
+	return summaries, nil
+}
+
+// Get returns the version recorded for revision.
+func (r *Recorder) Get(boardID string, revision int64) (Version, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.loadLocked(boardID); err != nil {
+		return Version{}, false, err
+	}
+	versions := r.versions[boardID]
+	i := sort.Search(len(versions), func(i int) bool { return versions[i].Revision >= revision })
+	if i == len(versions) || versions[i].Revision != revision {
+		return Version{}, false, nil
+	}
+	return cloneVersion(versions[i]), true, nil
+}
+
+// At returns the latest version recorded at or before t.
+func (r *Recorder) At(boardID string, t time.Time) (Version, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.loadLocked(boardID); err != nil {
+		return Version{}, false, err
+	}
+	var found *Version
+	for i, v := range r.versions[boardID] {
+		if v.At.After(t) {
+			continue
+		}
+		if found == nil || v.Revision > found.Revision {
+			found = &r.versions[boardID][i]
+		}
+	}
+	if found == nil {
+		return Version{}, false, nil
+	}
+	return cloneVersion(*found), true, nil
+}
+
+// Forget drops a purged board's history, including its file.
+func (r *Recorder) Forget(boardID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.versions, boardID)
+	delete(r.loaded, boardID)
+	delete(r.lines, boardID)
+	if r.dir == "" {
+		return nil
+	}
+	if err := os.Remove(r.path(boardID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove history: %w", err)
+	}
+	return nil
+}
+
+func cloneVersion(v Version) Version {
+	v.Board = v.Board.Clone()
+	return v
+}
+
+// trim drops all but the latest limit versions, copying the rest so the
+// dropped boards can be collected.
+func (r *Recorder) trim(versions []Version) []Version {
+	if r.limit == 0 || len(versions) <= r.limit {
+		return versions
+	}
+	return append([]Version(nil), versions[len(versions)-r.limit:]...)
+}
+
+// path is a board's history file. The ID is escaped so that IDs with slashes,
+// such as imported legacy ones, each get a file of their own inside dir.
+func (r *Recorder) path(boardID string) string {
+	return filepath.Join(r.dir, url.PathEscape(boardID)+".jsonl")
+}
+
+func (r *Recorder) appendLocked(v Version) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode version: %w", err)
+	}
+	file, err := os.OpenFile(r.path(v.Board.ID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open history: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write history: %w", err)
+	}
+	r.lines[v.Board.ID]++
+	return file.Sync()
+}
+
+// rewriteLocked replaces a board's history file with the versions kept in
+// memory, writing a temporary file first so a crash leaves the old one whole.
+func (r *Recorder) rewriteLocked(boardID string) error {
+	path := r.path(boardID)
+	file, err := os.CreateTemp(r.dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("rewrite history: %w", err)
+	}
+	defer os.Remove(file.Name())
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, v := range r.versions[boardID] {
+		if err := enc.Encode(v); err != nil {
+			file.Close()
+			return fmt.Errorf("encode version: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("rewrite history: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("rewrite history: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("rewrite history: %w", err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("rewrite history: %w", err)
+	}
+	r.lines[boardID] = len(r.versions[boardID])
+	return nil
+}
+
+// loadLocked reads a board's history file on first use, keeping the latest
+// versions within the limit. A torn final line from a crash is skipped.
+func (r *Recorder) loadLocked(boardID string) error {
+	if r.dir == "" || r.loaded[boardID] {
+		return nil
+	}
+	r.loaded[boardID] = true
+
+	file, err := os.Open(r.path(boardID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open history: %w", err)
+	}
+	defer file.Close()
+
+	byRevision := make(map[int64]Version)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	lines := 0
+	for scanner.Scan() {
+		lines++
+		var v Version
+		if err := json.Unmarshal(scanner.Bytes(), &v); err != nil {
+			continue
+		}
+		byRevision[v.Revision] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read history: %w", err)
+	}
+
+	versions := make([]Version, 0, len(byRevision))
+	for _, v := range byRevision {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Revision < versions[j].Revision })
+	r.versions[boardID] = r.trim(versions)
+	r.lines[boardID] = lines
+	return nil
+}
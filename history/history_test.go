@@ -0,0 +1,142 @@
+package history
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"test1/models"
+)
+
+func TestRecorderPersistsVersionsAndDiffs(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := NewRecorder(dir, 0)
+	if err != nil {
+		t.Fatalf("new recorder: %v", err)
+	}
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	v1 := models.Board{ID: "b", Name: "Plan", Revision: 1, UpdatedAt: start,
+		Notes: []models.StickyNote{{ID: "n1", Content: "a"}, {ID: "n2", Content: "b"}}}
+	v2 := v1.Clone()
+	v2.Revision = 2
+	v2.UpdatedAt = start.Add(time.Minute)
+	v2.Notes = []models.StickyNote{{ID: "n1", Content: "changed"}, {ID: "n3"}}
+	if err := rec.Record(v1, "alice", "board.created"); err != nil {
+		t.Fatalf("record v1: %v", err)
+	}
+	if err := rec.Record(v2, "bob", "note.updated"); err != nil {
+		t.Fatalf("record v2: %v", err)
+	}
+
+	reloaded, _ := NewRecorder(dir, 0)
+	summaries, err := reloaded.List("b")
+	if err != nil || len(summaries) != 2 || summaries[1].Actor != "bob" {
+		t.Fatalf("expected two persisted versions, got %+v (%v)", summaries, err)
+	}
+	at, ok, _ := reloaded.At("b", start.Add(30*time.Second))
+	if !ok || at.Revision != 1 {
+		t.Fatalf("expected revision 1 at timestamp, got %+v", at)
+	}
+
+	diff, err := Diff(v1, v2)
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	notes := diff.Collections["notes"]
+	if len(notes.Added) != 1 || len(notes.Removed) != 1 || len(notes.Changed) != 1 || notes.Changed[0].ID != "n1" {
+		t.Fatalf("unexpected note diff: %+v", notes)
+	}
+	if _, ok := diff.Collections["shapes"]; ok {
+		t.Fatalf("expected unchanged collections to be omitted")
+	}
+	modal := v2.Clone()
+	modal.Propagation = "noisy-or"
+	if diff, _ := Diff(v2, modal); diff.Empty() || diff.PropagationBefore != "" || diff.PropagationAfter != "noisy-or" {
+		t.Fatalf("expected the propagation mode change in the diff, got %+v", diff)
+	}
+
+	if err := reloaded.Forget("b"); err != nil {
+		t.Fatalf("forget: %v", err)
+	}
+	if summaries, _ := reloaded.List("b"); len(summaries) != 0 {
+		t.Fatalf("expected a forgotten board to have no history, got %+v", summaries)
+	}
+	again, _ := NewRecorder(dir, 0)
+	if summaries, _ := again.List("b"); len(summaries) != 0 {
+		t.Fatalf("expected the history file to be removed, got %+v", summaries)
+	}
+}
+
+func TestRecorderKeepsTheLatestVersionsWithinItsLimit(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := NewRecorder(dir, 3)
+	if err != nil {
+		t.Fatalf("new recorder: %v", err)
+	}
+	for rev := int64(1); rev <= 10; rev++ {
+		if err := rec.Record(models.Board{ID: "b", Revision: rev}, "", "note.updated"); err != nil {
+			t.Fatalf("record %d: %v", rev, err)
+		}
+	}
+
+	revisions := func(rec *Recorder) []int64 {
+		summaries, err := rec.List("b")
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		var revs []int64
+		for _, s := range summaries {
+			revs = append(revs, s.Revision)
+		}
+		return revs
+	}
+	if got := revisions(rec); !slices.Equal(got, []int64{8, 9, 10}) {
+		t.Fatalf("expected the latest three versions, got %v", got)
+	}
+	if _, ok, _ := rec.Get("b", 7); ok {
+		t.Fatal("expected a version past the limit to be dropped")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "b.jsonl"))
+	if err != nil {
+		t.Fatalf("read history: %v", err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines >= 6 {
+		t.Fatalf("expected the history file to be rewritten, it has %d lines", lines)
+	}
+	reloaded, _ := NewRecorder(dir, 3)
+	if got := revisions(reloaded); !slices.Equal(got, []int64{8, 9, 10}) {
+		t.Fatalf("expected the reloaded history to keep the latest three versions, got %v", got)
+	}
+}
+
+func TestRecorderKeepsIDsThatShareABaseNameApart(t *testing.T) {
+	dir := t.TempDir()
+	rec, _ := NewRecorder(dir, 0)
+	for _, id := range []string{"team/plan", "other/plan", "plan", "../plan"} {
+		if err := rec.Record(models.Board{ID: id, Name: id, Revision: 1}, "", "board.created"); err != nil {
+			t.Fatalf("record %s: %v", id, err)
+		}
+	}
+	if err := rec.Forget("other/plan"); err != nil {
+		t.Fatalf("forget: %v", err)
+	}
+
+	reloaded, _ := NewRecorder(dir, 0)
+	for _, id := range []string{"team/plan", "plan", "../plan"} {
+		v, ok, err := reloaded.Get(id, 1)
+		if err != nil || !ok || v.Board.Name != id {
+			t.Fatalf("expected %s to keep its own history, got %+v (%v)", id, v.Board, err)
+		}
+	}
+	if summaries, _ := reloaded.List("other/plan"); len(summaries) != 0 {
+		t.Fatalf("expected the forgotten board to have no history, got %+v", summaries)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(dir)); len(entries) != 1 {
+		t.Fatalf("expected nothing written outside the history dir, got %d entries", len(entries))
+	}
+}
@@ -1,17 +1,237 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
+	"test1/access"
+	"test1/audit"
+	"test1/auth"
+	"test1/auth/mockoidc"
+	"test1/handlers"
+	"test1/history"
 	"test1/server"
+	"test1/storage"
+	"test1/transport"
+	"test1/workspace"
 )
 
 func main() {
+	addr := flag.String("addr", ":8080", "HTTP listen address")
+	storeKind := flag.String("store", "memory", "board store: memory or file")
+	dataDir := flag.String("data", "data", "directory for the file store")
+	defaults := storage.DefaultFileStoreOptions()
+	snapshotEvery := flag.Int("snapshot-every", defaults.SnapshotEvery, "file store: snapshot after this many log records (0 disables)")
+	snapshotInterval := flag.Duration("snapshot-interval", defaults.SnapshotInterval, "file store: periodic snapshot interval (0 disables)")
+	historyDir := flag.String("history", "", "directory for board version history (default: <data>/history with the file store, memory otherwise)")
+	historyLimit := flag.Int("history-limit", history.DefaultLimit, "how many of each board's latest versions history keeps (0 keeps them all)")
+	importLegacy := flag.String("import-legacy", "", "import boards from a legacy storage JSON file before serving")
+	transportKind := flag.String("transport", "local", "event fan-out between instances: local, tcp or nats")
+	transportAddr := flag.String("transport-addr", "", "tcp: relay address; nats: server address (default 127.0.0.1:4222)")
+	natsSubject := flag.String("nats-subject", transport.DefaultSubject, "nats: subject board events are published on")
+	relayListen := flag.String("relay-listen", "", "also run a TCP event relay on this address for other instances")
+	accessFile := flag.String("access-file", "", "file for board members and share links (default: <data>/access.json with the file store, memory otherwise)")
+	workspacesFile := flag.String("workspaces-file", "", "file for workspaces, folders and board placement (default: <data>/workspaces.json with the file store, memory otherwise)")
+	trashRetention := flag.Duration("trash-retention", handlers.DefaultTrashRetention, "how long deleted boards stay in the trash before they are purged (0 keeps them until purged by hand)")
+	auditFile := flag.String("audit-file", "", "append-only audit log in JSON Lines (default: <data>/audit.jsonl with the file store, memory otherwise)")
+	admins := flag.String("admins", "", "comma-separated user IDs or emails of the signed-in users who may read the audit log")
+	authMode := flag.String("auth", "off", "authentication: off, optional (anonymous access still allowed) or required")
+	authFile := flag.String("auth-file", "", "file for accounts, tokens and sessions (default: <data>/auth.json with the file store, memory otherwise)")
+	authRegistration := flag.Bool("auth-registration", true, "let anyone create a password account (the first account can always be created)")
+	secureCookies := flag.Bool("secure-cookies", false, "mark session cookies Secure; enable when served over HTTPS")
+	publicURL := flag.String("public-url", "", "URL browsers reach this server at, for the OIDC redirect (default http://localhost<addr>)")
+	oidcIssuer := flag.String("oidc-issuer", "", "OpenID Connect issuer URL; enables SSO sign-in")
+	oidcClientID := flag.String("oidc-client-id", "", "OpenID Connect client ID")
+	oidcClientSecret := flag.String("oidc-client-secret", "", "OpenID Connect client secret")
+	oidcMock := flag.String("oidc-mock", "", "run a mock OpenID Connect provider on this address for local development and use it for SSO")
+	flag.Parse()
+
 	logger := log.Default()
-	srv := server.NewServer(":8080", logger)
 
-	logger.Printf("starting server on %s", ":8080")
+	var store interface {
+		handlers.BoardStore
+		storage.BoardPutter
+	}
+	closeStore := func() error { return nil }
+	switch *storeKind {
+	case "memory":
+		store = storage.NewInMemoryStore()
+	case "file":
+		fileStore, err := storage.OpenFileStore(*dataDir, storage.FileStoreOptions{
+			SnapshotEvery:    *snapshotEvery,
+			SnapshotInterval: *snapshotInterval,
+			Logger:           logger,
+		})
+		if err != nil {
+			logger.Fatalf("open file store: %v", err)
+		}
+		store = fileStore
+		closeStore = fileStore.Close
+		logger.Printf("using file store in %s", *dataDir)
+	default:
+		logger.Fatalf("unknown store %q", *storeKind)
+	}
+
+	if *importLegacy != "" {
+		n, err := storage.ImportLegacyFile(*importLegacy, store)
+		if err != nil {
+			logger.Fatalf("import legacy boards: %v", err)
+		}
+		logger.Printf("imported %d legacy boards from %s", n, *importLegacy)
+	}
+
+	if *historyDir == "" && *storeKind == "file" {
+		*historyDir = filepath.Join(*dataDir, "history")
+	}
+	versions, err := history.NewRecorder(*historyDir, *historyLimit)
+	if err != nil {
+		logger.Fatalf("open history: %v", err)
+	}
+
+	if *relayListen != "" {
+		relay, err := transport.ListenRelay(*relayListen, logger)
+		if err != nil {
+			logger.Fatalf("start relay: %v", err)
+		}
+		defer relay.Close()
+		logger.Printf("event relay listening on %s", relay.Addr())
+	}
+
+	var events transport.Transport
+	switch *transportKind {
+	case "local":
+	case "tcp":
+		if *transportAddr == "" {
+			logger.Fatalf("-transport-addr is required for the tcp transport")
+		}
+		events, err = transport.DialTCP(*transportAddr, logger)
+	case "nats":
+		if *transportAddr == "" {
+			*transportAddr = "127.0.0.1:4222"
+		}
+		events, err = transport.DialNATS(*transportAddr, *natsSubject, logger)
+	default:
+		logger.Fatalf("unknown transport %q", *transportKind)
+	}
+	if err != nil {
+		logger.Fatalf("connect %s transport: %v", *transportKind, err)
+	}
+	broker := server.NewBroker(logger, events)
+
+	if *accessFile == "" && *storeKind == "file" {
+		*accessFile = filepath.Join(*dataDir, "access.json")
+	}
+	acl, err := access.NewStore(*accessFile)
+	if err != nil {
+		logger.Fatalf("open access lists: %v", err)
+	}
+
+	if *workspacesFile == "" && *storeKind == "file" {
+		*workspacesFile = filepath.Join(*dataDir, "workspaces.json")
+	}
+	workspaces, err := workspace.NewStore(*workspacesFile)
+	if err != nil {
+		logger.Fatalf("open workspaces: %v", err)
+	}
+
+	if *auditFile == "" && *storeKind == "file" {
+		*auditFile = filepath.Join(*dataDir, "audit.jsonl")
+	}
+	auditLog, err := audit.Open(*auditFile)
+	if err != nil {
+		logger.Fatalf("open audit log: %v", err)
+	}
+
+	opts := []handlers.Option{
+		handlers.WithHistory(versions),
+		handlers.WithAccess(acl),
+		handlers.WithWorkspaces(workspaces),
+		handlers.WithTrashRetention(*trashRetention),
+		handlers.WithAudit(auditLog, strings.Split(*admins, ",")...),
+	}
+	if *authMode != "off" {
+		if *authMode != "optional" && *authMode != "required" {
+			logger.Fatalf("unknown auth mode %q", *authMode)
+		}
+		if *authFile == "" && *storeKind == "file" {
+			*authFile = filepath.Join(*dataDir, "auth.json")
+		}
+		if *publicURL == "" {
+			host, port, _ := net.SplitHostPort(*addr)
+			if host == "" {
+				host = "localhost"
+			}
+			*publicURL = "http://" + net.JoinHostPort(host, port)
+		}
+		if *oidcMock != "" {
+			mock, err := mockoidc.New("http://"+*oidcMock, "boards", "boards-secret")
+			if err != nil {
+				logger.Fatalf("create mock OIDC provider: %v", err)
+			}
+			go func() {
+				if err := http.ListenAndServe(*oidcMock, mock); err != nil {
+					logger.Printf("mock OIDC provider stopped: %v", err)
+				}
+			}()
+			*oidcIssuer, *oidcClientID, *oidcClientSecret = mock.Issuer, mock.ClientID, mock.ClientSecret
+			logger.Printf("mock OIDC provider listening on %s", *oidcMock)
+		}
+
+		authOpts := auth.DefaultOptions()
+		authOpts.Path = *authFile
+		authOpts.Registration = *authRegistration
+		authOpts.SecureCookies = *secureCookies
+		if *oidcIssuer != "" {
+			authOpts.OIDC = auth.NewOIDCProvider(auth.OIDCConfig{
+				Issuer:       *oidcIssuer,
+				ClientID:     *oidcClientID,
+				ClientSecret: *oidcClientSecret,
+				RedirectURL:  *publicURL + "/auth/oidc/callback",
+			})
+		}
+		accounts, err := auth.NewService(authOpts)
+		if err != nil {
+			logger.Fatalf("open accounts: %v", err)
+		}
+		opts = append(opts, handlers.WithAuth(accounts, *authMode == "required"))
+	}
+
+	srv := server.NewServer(*addr, store, broker, logger, opts...)
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.Printf("shutdown: %v", err)
+		}
+	}()
+
+	logger.Printf("starting server on %s", *addr)
 	if err := srv.Start(); err != nil {
 		logger.Fatalf("server stopped: %v", err)
 	}
+	<-stopped
+	if err := broker.Close(); err != nil {
+		logger.Printf("close transport: %v", err)
+	}
+	if err := auditLog.Close(); err != nil {
+		logger.Printf("close audit log: %v", err)
+	}
+	if err := closeStore(); err != nil {
+		logger.Fatalf("close store: %v", err)
+	}
 }
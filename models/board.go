@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"test1/crdt"
+)
 
 // Point represents a coordinate on a board.
 type Point struct {
@@ -47,15 +51,30 @@ type Connector struct {
 
 // CausalNode represents a factor or effect in a causal diagram.
 type CausalNode struct {
-	ID              string         `json:"id"`
-	Kind            string         `json:"kind"`
-	Label           string         `json:"label"`
-	Position        Point          `json:"position"`
-	Color           string         `json:"color"`
-	Status          string         `json:"status,omitempty"`
-	Confidence      float64        `json:"confidence,omitempty"`
-	StatusUpdatedAt time.Time      `json:"statusUpdatedAt,omitempty"`
-	Evidence        []NodeEvidence `json:"evidence,omitempty"`
+	ID              string    `json:"id"`
+	Kind            string    `json:"kind"`
+	Label           string    `json:"label"`
+	Position        Point     `json:"position"`
+	Color           string    `json:"color"`
+	Status          string    `json:"status,omitempty"`
+	Confidence      float64   `json:"confidence,omitempty"`
+	StatusUpdatedAt time.Time `json:"statusUpdatedAt,omitempty"`
+	// Operator is how the node's incoming links combine: average (the
+	// default), and, or, sum, product, not, fuzzy-and or fuzzy-or.
+	Operator string `json:"operator,omitempty"`
+	// Value is the node's quantity at the start of a simulation.
+	Value float64 `json:"value,omitempty"`
+	// Probabilities are how likely each status is, when the status is a guess.
+	Probabilities *StatusProbabilities `json:"probabilities,omitempty"`
+	Evidence      []NodeEvidence       `json:"evidence,omitempty"`
+}
+
+// StatusProbabilities are the relative chances of a causal node's statuses.
+// They need not add up to 1.
+type StatusProbabilities struct {
+	Positive float64 `json:"positive"`
+	Neutral  float64 `json:"neutral"`
+	Negative float64 `json:"negative"`
 }
 
 // NodeEvidence captures how an upstream node contributes to the current node's state.
@@ -67,6 +86,9 @@ type NodeEvidence struct {
 	Polarity     string  `json:"polarity,omitempty"`
 	Weight       float64 `json:"weight,omitempty"`
 	Contribution float64 `json:"contribution,omitempty"`
+	// Dominant marks the inputs that decided the node's status under its
+	// operator, such as the weakest input of an AND.
+	Dominant bool `json:"dominant,omitempty"`
 }
 
 // CausalLink connects two causal nodes with a signed, weighted relationship.
@@ -77,6 +99,69 @@ type CausalLink struct {
 	Polarity string  `json:"polarity"`
 	Weight   float64 `json:"weight"`
 	Label    string  `json:"label"`
+	// Delay is how many simulation ticks a change in the source takes to
+	// reach the target.
+	Delay int `json:"delay,omitempty"`
+	// Rate makes the link a flow in simulations: each tick the target changes
+	// by Rate times the weighted source value, draining it when negative.
+	// Links without a rate set the target's value instead.
+	Rate float64 `json:"rate,omitempty"`
+	// Distribution is the spread of the weight, when the weight is a guess.
+	Distribution *WeightDistribution `json:"distribution,omitempty"`
+}
+
+// Weight distribution kinds.
+const (
+	DistributionTriangular = "triangular"
+	DistributionNormal     = "normal"
+)
+
+// WeightDistribution describes an uncertain link weight: triangular between
+// Min and Max, most likely at Mode, or normal around Mean with StdDev.
+type WeightDistribution struct {
+	Kind   string  `json:"kind"`
+	Min    float64 `json:"min,omitempty"`
+	Mode   float64 `json:"mode,omitempty"`
+	Max    float64 `json:"max,omitempty"`
+	Mean   float64 `json:"mean,omitempty"`
+	StdDev float64 `json:"stdDev,omitempty"`
+}
+
+// Scenario is a named what-if on a board's causal model: it pins the status
+// of some nodes and changes the weight or polarity of some links, and is
+// propagated on a copy of the board so the board itself stays as it is.
+type Scenario struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Nodes       []NodeOverride `json:"nodes,omitempty"`
+	Links       []LinkOverride `json:"links,omitempty"`
+}
+
+// NodeOverride pins a causal node in a scenario: its incoming links are
+// ignored and it holds the given status, or its own when Status is empty.
+type NodeOverride struct {
+	NodeID     string   `json:"nodeId"`
+	Status     string   `json:"status,omitempty"`
+	Confidence *float64 `json:"confidence,omitempty"`
+}
+
+// LinkOverride changes a causal link in a scenario. Unset fields keep the link's own values.
+type LinkOverride struct {
+	LinkID   string   `json:"linkId"`
+	Weight   *float64 `json:"weight,omitempty"`
+	Polarity string   `json:"polarity,omitempty"`
+}
+
+// FeedbackLoop is a cycle of causal nodes whose statuses did not settle when
+// they were propagated, so the statuses shown for them are not final.
+type FeedbackLoop struct {
+	// Nodes are the IDs of the nodes in the loop, in board order.
+	Nodes []string `json:"nodes"`
+	// Iterations is how often the loop was evaluated before giving up.
+	Iterations int `json:"iterations"`
+	// Residual is the largest change in a node's score in the last iteration.
+	Residual float64 `json:"residual"`
 }
 
 // TextItem represents a text element on the board.
@@ -126,13 +211,136 @@ type Board struct {
 	Connectors  []Connector  `json:"connectors"`
 	CausalNodes []CausalNode `json:"causalNodes"`
 	CausalLinks []CausalLink `json:"causalLinks"`
-	Comments    []Comment    `json:"comments"`
-	UpdatedAt   time.Time    `json:"updatedAt"`
+	// Propagation is how causal statuses carry downstream: status (the
+	// default), confidence or noisy-or; see the status package.
+	Propagation string `json:"propagation,omitempty"`
+	// UnsettledLoops lists the feedback loops that did not converge the last
+	// time causal statuses were propagated.
+	UnsettledLoops []FeedbackLoop `json:"unsettledLoops,omitempty"`
+	Comments       []Comment      `json:"comments"`
+	Scenarios      []Scenario     `json:"scenarios"`
+	// TextDocs holds the replicated editing state of note and text content, keyed by
+	// "<collection>/<item id>". Whole-content writes are folded in before the next merge.
+	TextDocs  map[string]*crdt.Text `json:"textDocs,omitempty"`
+	UpdatedAt time.Time             `json:"updatedAt"`
+	// Revision increases by one with every accepted write and is served as the board's ETag.
+	Revision int64 `json:"revision"`
+	Lifecycle
+}
+
+// Lifecycle records whether a board is archived, which keeps it readable but
+// refuses changes, or in the trash, where it is hidden until it is restored or
+// purged.
+type Lifecycle struct {
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+	DeletedAt  *time.Time `json:"deletedAt,omitempty"`
+	DeletedBy  string     `json:"deletedBy,omitempty"`
 }
 
+// Archived reports whether the board is read-only.
+func (l Lifecycle) Archived() bool { return l.ArchivedAt != nil }
+
+// Trashed reports whether the board has been deleted but not yet purged.
+func (l Lifecycle) Trashed() bool { return l.DeletedAt != nil }
+
 // BoardEvent represents a message sent to subscribers about a board.
 type BoardEvent struct {
 	Type    string      `json:"type"`
 	BoardID string      `json:"boardId"`
 	Data    interface{} `json:"data"`
+	// Revision is the board revision produced by the change, when the event reports one.
+	Revision int64 `json:"revision,omitempty"`
+}
+
+// Clone returns a deep copy of the board so callers can mutate it without
+// affecting the original.
+func (b Board) Clone() Board {
+	dst := b
+	dst.Shapes = make([]Shape, len(b.Shapes))
+	for i, shape := range b.Shapes {
+		shape.Points = append([]Point(nil), shape.Points...)
+		dst.Shapes[i] = shape
+	}
+	dst.Strokes = make([]Stroke, len(b.Strokes))
+	for i, stroke := range b.Strokes {
+		stroke.Points = append([]Point(nil), stroke.Points...)
+		dst.Strokes[i] = stroke
+	}
+	dst.Texts = append([]TextItem(nil), b.Texts...)
+	dst.Notes = append([]StickyNote(nil), b.Notes...)
+	dst.Connectors = make([]Connector, len(b.Connectors))
+	for i, conn := range b.Connectors {
+		copyConn := conn
+		copyConn.From = conn.From.clone()
+		copyConn.To = conn.To.clone()
+		dst.Connectors[i] = copyConn
+	}
+	dst.CausalNodes = make([]CausalNode, len(b.CausalNodes))
+	for i, node := range b.CausalNodes {
+		copyNode := node
+		copyNode.Evidence = append([]NodeEvidence(nil), node.Evidence...)
+		if node.Probabilities != nil {
+			odds := *node.Probabilities
+			copyNode.Probabilities = &odds
+		}
+		dst.CausalNodes[i] = copyNode
+	}
+	dst.CausalLinks = append([]CausalLink(nil), b.CausalLinks...)
+	for i, link := range dst.CausalLinks {
+		if link.Distribution != nil {
+			spread := *link.Distribution
+			dst.CausalLinks[i].Distribution = &spread
+		}
+	}
+	if b.UnsettledLoops != nil {
+		dst.UnsettledLoops = make([]FeedbackLoop, len(b.UnsettledLoops))
+		for i, loop := range b.UnsettledLoops {
+			loop.Nodes = append([]string(nil), loop.Nodes...)
+			dst.UnsettledLoops[i] = loop
+		}
+	}
+	dst.Comments = append([]Comment(nil), b.Comments...)
+	if b.Scenarios != nil {
+		dst.Scenarios = make([]Scenario, len(b.Scenarios))
+		for i, scenario := range b.Scenarios {
+			dst.Scenarios[i] = scenario.clone()
+		}
+	}
+	if b.TextDocs != nil {
+		dst.TextDocs = make(map[string]*crdt.Text, len(b.TextDocs))
+		for key, doc := range b.TextDocs {
+			dst.TextDocs[key] = doc.Clone()
+		}
+	}
+	return dst
+}
+
+func (s Scenario) clone() Scenario {
+	dst := s
+	dst.Nodes = make([]NodeOverride, len(s.Nodes))
+	for i, o := range s.Nodes {
+		if o.Confidence != nil {
+			conf := *o.Confidence
+			o.Confidence = &conf
+		}
+		dst.Nodes[i] = o
+	}
+	dst.Links = make([]LinkOverride, len(s.Links))
+	for i, o := range s.Links {
+		if o.Weight != nil {
+			weight := *o.Weight
+			o.Weight = &weight
+		}
+		dst.Links[i] = o
+	}
+	return dst
+}
+
+func (a Anchor) clone() Anchor {
+	dst := a
+	if a.Point != nil {
+		copyPoint := *a.Point
+		dst.Point = &copyPoint
+	}
+	return dst
 }
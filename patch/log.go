@@ -0,0 +1,73 @@
+package patch
+
+import (
+	"slices"
+	"sort"
+	"sync"
+)
+
+// Log keeps the most recent accepted patches per board so that patches based on
+// an older revision can be transformed instead of rejected.
+type Log struct {
+	mu      sync.Mutex
+	limit   int
+	entries map[string][]entry
+}
+
+type entry struct {
+	revision int64
+	ops      []Operation
+}
+
+// NewLog creates a log that remembers up to limit revisions per board.
+func NewLog(limit int) *Log {
+	return &Log{limit: limit, entries: make(map[string][]entry)}
+}
+
+// Record stores the operations that produced revision. Patches are recorded
+// once their revision is committed, which concurrent writers may do out of
+// order, so entries are kept sorted; recording a revision again replaces it.
+func (l *Log) Record(boardID string, revision int64, ops []Operation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := l.entries[boardID]
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].revision >= revision })
+	if i < len(entries) && entries[i].revision == revision {
+		entries[i].ops = ops
+	} else {
+		entries = slices.Insert(entries, i, entry{revision: revision, ops: ops})
+	}
+	if len(entries) > l.limit {
+		entries = append([]entry(nil), entries[len(entries)-l.limit:]...)
+	}
+	l.entries[boardID] = entries
+}
+
+// Since returns the operations that moved the board from base to current. ok is
+// false when any revision in between was not produced by a recorded patch, for
+// example a whole-board write or an entry that has aged out.
+func (l *Log) Since(boardID string, base, current int64) (ops []Operation, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	next := base + 1
+	for _, e := range l.entries[boardID] {
+		if e.revision < next {
+			continue
+		}
+		if e.revision != next || e.revision > current {
+			break
+		}
+		ops = append(ops, e.ops...)
+		next++
+	}
+	return ops, next == current+1
+}
+
+// Forget drops everything recorded for a board.
+func (l *Log) Forget(boardID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, boardID)
+}
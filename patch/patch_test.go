@@ -0,0 +1,93 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func ops(t *testing.T, raw string) []Operation {
+	t.Helper()
+	var out []Operation
+	if err := json.Unmarshal([]byte(raw), &out); err != nil {
+		t.Fatalf("bad ops: %v", err)
+	}
+	return out
+}
+
+func TestApplySupportsAllOperations(t *testing.T) {
+	doc := []byte(`{"notes":[{"id":"a","content":"x"},{"id":"b"}],"name":"n"}`)
+	patched, err := Apply(doc, ops(t, `[
+		{"op":"test","path":"/name","value":"n"},
+		{"op":"replace","path":"/notes/0/content","value":"y"},
+		{"op":"add","path":"/notes/1","value":{"id":"c"}},
+		{"op":"remove","path":"/notes/2"},
+		{"op":"copy","from":"/name","path":"/title"},
+		{"op":"move","from":"/title","path":"/label"}
+	]`))
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	want := `{"label":"n","name":"n","notes":[{"content":"y","id":"a"},{"id":"c"}]}`
+	if string(patched) != want {
+		t.Fatalf("unexpected result\n got %s\nwant %s", patched, want)
+	}
+
+	if _, err := Apply(doc, ops(t, `[{"op":"test","path":"/name","value":"other"}]`)); !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("expected failed test, got %v", err)
+	}
+	if _, err := Apply(doc, ops(t, `[{"op":"remove","path":"/notes/5"}]`)); !errors.Is(err, ErrPath) {
+		t.Fatalf("expected missing path, got %v", err)
+	}
+}
+
+func TestTransformShiftsIndicesAndDetectsConflicts(t *testing.T) {
+	concurrent := ops(t, `[{"op":"remove","path":"/notes/0"},{"op":"add","path":"/notes/-","value":{}}]`)
+
+	got, err := Transform(Operation{Op: "replace", Path: "/notes/2/content"}, concurrent)
+	if err != nil || got.Path != "/notes/1/content" {
+		t.Fatalf("expected shifted path, got %q (%v)", got.Path, err)
+	}
+
+	if _, err := Transform(Operation{Op: "replace", Path: "/notes/0/content"}, concurrent); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected conflict on removed note, got %v", err)
+	}
+
+	inserted := ops(t, `[{"op":"add","path":"/notes/1","value":{}}]`)
+	got, err = Transform(Operation{Op: "remove", Path: "/notes/3"}, inserted)
+	if err != nil || got.Path != "/notes/4" {
+		t.Fatalf("expected index past insert, got %q (%v)", got.Path, err)
+	}
+
+	replaced := ops(t, `[{"op":"replace","path":"/notes/1","value":{}}]`)
+	if _, err := Transform(Operation{Op: "replace", Path: "/notes/1/content"}, replaced); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected conflict inside replaced note, got %v", err)
+	}
+}
+
+func TestLogSinceRequiresContiguousRevisions(t *testing.T) {
+	log := NewLog(4)
+	log.Record("b", 2, ops(t, `[{"op":"remove","path":"/notes/0"}]`))
+	log.Record("b", 3, ops(t, `[{"op":"add","path":"/notes/-","value":{}}]`))
+
+	if got, ok := log.Since("b", 1, 3); !ok || len(got) != 2 {
+		t.Fatalf("expected two ops since revision 1, got %d (%v)", len(got), ok)
+	}
+	if _, ok := log.Since("b", 1, 4); ok {
+		t.Fatalf("expected gap at revision 4 to be reported")
+	}
+	if _, ok := log.Since("b", 0, 3); ok {
+		t.Fatalf("expected unknown revision 1 to be reported")
+	}
+}
+
+func TestLogKeepsRevisionsRecordedOutOfOrder(t *testing.T) {
+	log := NewLog(10)
+	log.Record("b", 3, ops(t, `[{"op":"add","path":"/notes/-","value":{}}]`))
+	log.Record("b", 2, ops(t, `[{"op":"remove","path":"/notes/0"}]`))
+
+	got, ok := log.Since("b", 1, 3)
+	if !ok || len(got) != 2 || got[0].Op != "remove" || got[1].Op != "add" {
+		t.Fatalf("expected revisions 2 and 3 in order, got %+v (ok=%v)", got, ok)
+	}
+}
@@ -0,0 +1,122 @@
+package patch
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ErrConflict reports an operation that touches a value changed by a concurrent operation.
+var ErrConflict = errors.New("patch conflicts with a concurrent change")
+
+// Transform rewrites op, written against an older document, so it can be applied
+// after the concurrent operations that were accepted in the meantime. Array indices
+// are shifted past concurrent inserts and removals; an operation on a value that a
+// concurrent operation replaced, removed or modified returns ErrConflict.
+func Transform(op Operation, concurrent []Operation) (Operation, error) {
+	for _, c := range concurrent {
+		var err error
+		op, err = transformOne(op, c)
+		if err != nil {
+			return Operation{}, err
+		}
+	}
+	return op, nil
+}
+
+func transformOne(op, c Operation) (Operation, error) {
+	path, err := ParsePointer(op.Path)
+	if err != nil {
+		return Operation{}, err
+	}
+	var from []string
+	if op.Op == "move" || op.Op == "copy" {
+		if from, err = ParsePointer(op.From); err != nil {
+			return Operation{}, err
+		}
+	}
+
+	// A move or copy behaves like a removal from From (move only) followed by an add at Path.
+	var effects []Operation
+	switch c.Op {
+	case "move":
+		effects = []Operation{{Op: "remove", Path: c.From}, {Op: "add", Path: c.Path}}
+	case "copy":
+		effects = []Operation{{Op: "add", Path: c.Path}}
+	case "test":
+		return op, nil
+	default:
+		effects = []Operation{c}
+	}
+
+	for _, eff := range effects {
+		cPath, err := ParsePointer(eff.Path)
+		if err != nil {
+			return Operation{}, err
+		}
+		if path, err = shift(path, eff.Op, cPath); err != nil {
+			return Operation{}, err
+		}
+		if from != nil {
+			if from, err = shift(from, eff.Op, cPath); err != nil {
+				return Operation{}, err
+			}
+		}
+	}
+
+	op.Path = FormatPointer(path)
+	if from != nil {
+		op.From = FormatPointer(from)
+	}
+	return op, nil
+}
+
+// shift adjusts path for a concurrent operation of kind cOp at cPath.
+func shift(path []string, cOp string, cPath []string) ([]string, error) {
+	if len(cPath) == 0 {
+		return nil, ErrConflict
+	}
+	parent := cPath[:len(cPath)-1]
+	last := cPath[len(cPath)-1]
+	cIndex, isIndex := indexToken(last)
+
+	// Concurrent insert or removal inside an array this path descends into.
+	if isIndex && (cOp == "add" || cOp == "remove") && len(path) > len(parent) && hasPrefix(path, parent) {
+		token := path[len(parent)]
+		if token == "-" {
+			return path, nil
+		}
+		i, ok := indexToken(token)
+		if !ok {
+			return path, nil
+		}
+		switch {
+		case cOp == "add" && cIndex <= i:
+			i++
+		case cOp == "remove" && cIndex < i:
+			i--
+		case cOp == "remove" && cIndex == i:
+			return nil, ErrConflict
+		}
+		shifted := append([]string(nil), path...)
+		shifted[len(parent)] = strconv.Itoa(i)
+		return shifted, nil
+	}
+	if last == "-" && cOp == "add" && hasPrefix(path, parent) && len(path) > len(parent) {
+		// Appends never shift existing elements.
+		return path, nil
+	}
+
+	// Any other overlap means both sides changed the same value.
+	if hasPrefix(path, cPath) || hasPrefix(cPath, path) {
+		return nil, ErrConflict
+	}
+	return path, nil
+}
+
+func indexToken(token string) (int, bool) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, false
+	}
+	return i, true
+}
@@ -0,0 +1,175 @@
+package presence
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"test1/models"
+)
+
+// CursorsMoved is the batched event carrying every cursor that moved during a tick.
+const CursorsMoved = "cursors.moved"
+
+// CursorOptions tunes cursor batching. Each sender may move cursors Rate
+// times per second on average, with bursts of up to Burst moves. A board's
+// frame carries at most MaxPending cursors; 0 leaves it unbounded.
+type CursorOptions struct {
+	FlushInterval time.Duration
+	Rate          float64
+	Burst         float64
+	MaxPending    int
+}
+
+// DefaultCursorOptions flushes 20 times a second and allows each sender 20
+// moves a second, which is faster than the board UI sends them, with up to
+// 100 cursors a frame.
+func DefaultCursorOptions() CursorOptions {
+	return CursorOptions{FlushInterval: 50 * time.Millisecond, Rate: 20, Burst: 10, MaxPending: 100}
+}
+
+// FlushFunc publishes the cursors of a board that moved since the last flush.
+type FlushFunc func(boardID string, cursors []models.Cursor)
+
+// CursorBatcher keeps the latest cursor per participant and board and flushes
+// them together once per interval, so a board gets at most one cursor frame per
+// tick however many participants are moving.
+type CursorBatcher struct {
+	mu      sync.Mutex
+	opts    CursorOptions
+	flush   FlushFunc
+	now     func() time.Time
+	pending map[string]map[string]models.Cursor
+	buckets map[cursorKey]*bucket
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+type cursorKey struct {
+	board  string
+	sender string
+}
+
+// bucketIdle is how long a sender's rate limit state is kept after their last move.
+const bucketIdle = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewCursorBatcher starts a batcher that hands each tick's cursors to flush.
+func NewCursorBatcher(opts CursorOptions, flush FlushFunc) *CursorBatcher {
+	b := &CursorBatcher{
+		opts:    opts,
+		flush:   flush,
+		now:     time.Now,
+		pending: make(map[string]map[string]models.Cursor),
+		buckets: make(map[cursorKey]*bucket),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go b.flushLoop()
+	return b
+}
+
+// Move queues the cursor for the next flush, replacing any queued position of
+// the same participant. sender is who the rate limit is charged to, which
+// must be something the client cannot pick freely, unlike the cursor ID. It
+// reports false, dropping the move, when sender is over their rate limit or
+// the board's next frame is full.
+func (b *CursorBatcher) Move(boardID, sender string, cursor models.Cursor) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.allowLocked(cursorKey{boardID, sender}) {
+		return false
+	}
+	cursors := b.pending[boardID]
+	if _, queued := cursors[cursor.ID]; !queued && b.opts.MaxPending > 0 && len(cursors) >= b.opts.MaxPending {
+		return false
+	}
+	if cursors == nil {
+		cursors = make(map[string]models.Cursor)
+		b.pending[boardID] = cursors
+	}
+	cursors[cursor.ID] = cursor
+	return true
+}
+
+// Flush publishes all queued cursors now. The batcher calls it every FlushInterval.
+func (b *CursorBatcher) Flush() {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = make(map[string]map[string]models.Cursor)
+	now := b.now()
+	for key, bk := range b.buckets {
+		// An idle bucket has refilled completely and can be recreated on demand.
+		if now.Sub(bk.last) > bucketIdle {
+			delete(b.buckets, key)
+		}
+	}
+	b.mu.Unlock()
+
+	for boardID, byID := range pending {
+		cursors := make([]models.Cursor, 0, len(byID))
+		for _, c := range byID {
+			cursors = append(cursors, c)
+		}
+		sort.Slice(cursors, func(i, j int) bool { return cursors[i].ID < cursors[j].ID })
+		b.flush(boardID, cursors)
+	}
+}
+
+// Close flushes what is queued and stops the batcher.
+func (b *CursorBatcher) Close() {
+	b.once.Do(func() {
+		close(b.stop)
+		<-b.done
+		b.Flush()
+	})
+}
+
+func (b *CursorBatcher) flushLoop() {
+	defer close(b.done)
+	if b.opts.FlushInterval <= 0 {
+		<-b.stop
+		return
+	}
+
+	ticker := time.NewTicker(b.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			b.Flush()
+		}
+	}
+}
+
+// allowLocked takes a token from the sender's bucket, refilling it at Rate per second.
+func (b *CursorBatcher) allowLocked(key cursorKey) bool {
+	if b.opts.Rate <= 0 {
+		return true
+	}
+	now := b.now()
+	bk, ok := b.buckets[key]
+	if !ok {
+		bk = &bucket{tokens: b.opts.Burst, last: now}
+		b.buckets[key] = bk
+	}
+	bk.tokens += now.Sub(bk.last).Seconds() * b.opts.Rate
+	if bk.tokens > b.opts.Burst {
+		bk.tokens = b.opts.Burst
+	}
+	bk.last = now
+	if bk.tokens < 1 {
+		return false
+	}
+	bk.tokens--
+	return true
+}
@@ -0,0 +1,84 @@
+package presence
+
+import (
+	"testing"
+	"time"
+
+	"test1/models"
+)
+
+func TestCursorBatcherCoalescesAndRateLimits(t *testing.T) {
+	flushed := make(map[string][]models.Cursor)
+	b := NewCursorBatcher(CursorOptions{Rate: 2, Burst: 2}, func(boardID string, cursors []models.Cursor) {
+		flushed[boardID] = cursors
+	})
+	defer b.Close()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+
+	move := func(id string, x float64) bool {
+		return b.Move("board", id, models.Cursor{ID: id, Position: models.Point{X: x}})
+	}
+	if !move("bob", 1) || !move("bob", 2) {
+		t.Fatal("expected the burst to be accepted")
+	}
+	if move("bob", 3) {
+		t.Fatal("expected the third move in the same instant to be limited")
+	}
+	if !move("alice", 1) {
+		t.Fatal("expected limits to be per participant")
+	}
+
+	b.Flush()
+	cursors := flushed["board"]
+	if len(cursors) != 2 || cursors[0].ID != "alice" || cursors[1].ID != "bob" || cursors[1].Position.X != 2 {
+		t.Fatalf("expected one latest cursor per participant, got %+v", cursors)
+	}
+
+	delete(flushed, "board")
+	b.Flush()
+	if _, ok := flushed["board"]; ok {
+		t.Fatal("expected nothing to flush without new moves")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if !move("bob", 4) {
+		t.Fatal("expected the bucket to refill over time")
+	}
+}
+
+func TestCursorBatcherLimitsSendersRotatingIDsAndCapsFrames(t *testing.T) {
+	flushed := make(map[string][]models.Cursor)
+	b := NewCursorBatcher(CursorOptions{Rate: 2, Burst: 2, MaxPending: 3}, func(boardID string, cursors []models.Cursor) {
+		flushed[boardID] = cursors
+	})
+	defer b.Close()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+
+	if !b.Move("board", "10.0.0.1", models.Cursor{ID: "a"}) || !b.Move("board", "10.0.0.1", models.Cursor{ID: "b"}) {
+		t.Fatal("expected the burst to be accepted")
+	}
+	if b.Move("board", "10.0.0.1", models.Cursor{ID: "c"}) {
+		t.Fatal("expected a new cursor ID not to escape the sender's limit")
+	}
+
+	if !b.Move("board", "10.0.0.2", models.Cursor{ID: "c"}) {
+		t.Fatal("expected another sender to have its own limit")
+	}
+	if b.Move("board", "10.0.0.3", models.Cursor{ID: "d"}) {
+		t.Fatal("expected a full frame to refuse another cursor")
+	}
+	if !b.Move("board", "10.0.0.3", models.Cursor{ID: "a", Position: models.Point{X: 1}}) {
+		t.Fatal("expected a full frame to still take moves of its cursors")
+	}
+	if !b.Move("other", "10.0.0.3", models.Cursor{ID: "d"}) {
+		t.Fatal("expected the cap to be per board")
+	}
+
+	b.Flush()
+	if cursors := flushed["board"]; len(cursors) != 3 || cursors[0].ID != "a" || cursors[0].Position.X != 1 {
+		t.Fatalf("expected a frame of three cursors with a's latest move, got %+v", cursors)
+	}
+}
@@ -0,0 +1,266 @@
+// Package presence tracks who is connected to each board, whether they are
+// active or idle, and where their cursor was last seen.
+package presence
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"test1/models"
+)
+
+// Event types emitted by a Tracker.
+const (
+	Joined        = "presence.joined"
+	Left          = "presence.left"
+	Idle          = "presence.idle"
+	Updated       = "presence.updated"
+	CursorExpired = "cursor.expired"
+)
+
+// Participant is a connected user as shown in a board's participant list.
+type Participant struct {
+	ID          string        `json:"id"`
+	Label       string        `json:"label,omitempty"`
+	Color       string        `json:"color,omitempty"`
+	Status      string        `json:"status"`
+	Cursor      *models.Point `json:"cursor,omitempty"`
+	JoinedAt    time.Time     `json:"joinedAt"`
+	LastSeen    time.Time     `json:"lastSeen"`
+	Connections int           `json:"connections"`
+}
+
+// Participant statuses.
+const (
+	StatusActive = "active"
+	StatusIdle   = "idle"
+)
+
+// Update carries the optional details a participant reports with activity.
+type Update struct {
+	Label  string
+	Color  string
+	Cursor *models.Point
+}
+
+// EmitFunc publishes a presence event for a board.
+type EmitFunc func(boardID, eventType string, p Participant)
+
+// Options tunes when participants turn idle and cursors expire.
+type Options struct {
+	IdleAfter     time.Duration
+	CursorTTL     time.Duration
+	SweepInterval time.Duration
+}
+
+// DefaultOptions marks participants idle after a minute without activity and
+// hides cursors that have not moved for 30 seconds.
+func DefaultOptions() Options {
+	return Options{IdleAfter: time.Minute, CursorTTL: 30 * time.Second, SweepInterval: 5 * time.Second}
+}
+
+type entry struct {
+	Participant
+	cursorAt time.Time
+}
+
+// Tracker keeps the participants of every board. A participant stays present
+// while at least one of their connections is open.
+type Tracker struct {
+	mu     sync.Mutex
+	opts   Options
+	emit   EmitFunc
+	now    func() time.Time
+	boards map[string]map[string]*entry
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewTracker starts a tracker that reports changes through emit.
+func NewTracker(opts Options, emit EmitFunc) *Tracker {
+	t := &Tracker{
+		opts:   opts,
+		emit:   emit,
+		now:    func() time.Time { return time.Now().UTC() },
+		boards: make(map[string]map[string]*entry),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go t.sweepLoop()
+	return t
+}
+
+// Join registers a connection for participant id and returns the function that
+// ends it. The first connection emits presence.joined, the last one presence.left.
+func (t *Tracker) Join(boardID, id string, update Update) (leave func()) {
+	t.mu.Lock()
+	now := t.now()
+	participants := t.boards[boardID]
+	if participants == nil {
+		participants = make(map[string]*entry)
+		t.boards[boardID] = participants
+	}
+	e, ok := participants[id]
+	if !ok {
+		e = &entry{Participant: Participant{ID: id, Status: StatusActive, JoinedAt: now}}
+		participants[id] = e
+	}
+	wasIdle := e.Status == StatusIdle
+	e.Connections++
+	e.apply(update, now)
+	snapshot := e.Participant
+	t.mu.Unlock()
+
+	switch {
+	case !ok:
+		t.publish(boardID, Joined, snapshot)
+	case wasIdle:
+		t.publish(boardID, Updated, snapshot)
+	}
+
+	var once sync.Once
+	return func() { once.Do(func() { t.leave(boardID, id) }) }
+}
+
+func (t *Tracker) leave(boardID, id string) {
+	t.mu.Lock()
+	participants := t.boards[boardID]
+	e, ok := participants[id]
+	if !ok {
+		t.mu.Unlock()
+		return
+	}
+	e.Connections--
+	if e.Connections > 0 {
+		t.mu.Unlock()
+		return
+	}
+	delete(participants, id)
+	if len(participants) == 0 {
+		delete(t.boards, boardID)
+	}
+	snapshot := e.Participant
+	t.mu.Unlock()
+
+	t.publish(boardID, Left, snapshot)
+}
+
+// Touch records activity by a connected participant. A participant coming back
+// from idle, or changing label or color, emits presence.updated. It reports
+// false when the participant has no open connection on the board.
+func (t *Tracker) Touch(boardID, id string, update Update) bool {
+	t.mu.Lock()
+	e, ok := t.boards[boardID][id]
+	if !ok {
+		t.mu.Unlock()
+		return false
+	}
+	before := e.Participant
+	e.apply(update, t.now())
+	snapshot := e.Participant
+	t.mu.Unlock()
+
+	if before.Status != snapshot.Status || before.Label != snapshot.Label || before.Color != snapshot.Color {
+		t.publish(boardID, Updated, snapshot)
+	}
+	return true
+}
+
+// List returns the participants of a board in the order they joined.
+func (t *Tracker) List(boardID string) []Participant {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list := make([]Participant, 0, len(t.boards[boardID]))
+	for _, e := range t.boards[boardID] {
+		list = append(list, e.Participant)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].JoinedAt.Equal(list[j].JoinedAt) {
+			return list[i].JoinedAt.Before(list[j].JoinedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Sweep marks participants idle and expires cursors that have gone quiet. The
+// tracker runs it every SweepInterval.
+func (t *Tracker) Sweep() {
+	type change struct {
+		boardID, event string
+		p              Participant
+	}
+	var changes []change
+
+	t.mu.Lock()
+	now := t.now()
+	for boardID, participants := range t.boards {
+		for _, e := range participants {
+			if e.Cursor != nil && t.opts.CursorTTL > 0 && now.Sub(e.cursorAt) >= t.opts.CursorTTL {
+				e.Cursor = nil
+				changes = append(changes, change{boardID, CursorExpired, e.Participant})
+			}
+			if e.Status == StatusActive && t.opts.IdleAfter > 0 && now.Sub(e.LastSeen) >= t.opts.IdleAfter {
+				e.Status = StatusIdle
+				changes = append(changes, change{boardID, Idle, e.Participant})
+			}
+		}
+	}
+	t.mu.Unlock()
+
+	for _, c := range changes {
+		t.publish(c.boardID, c.event, c.p)
+	}
+}
+
+// Close stops the background sweeper.
+func (t *Tracker) Close() {
+	t.once.Do(func() {
+		close(t.stop)
+		<-t.done
+	})
+}
+
+func (t *Tracker) sweepLoop() {
+	defer close(t.done)
+	if t.opts.SweepInterval <= 0 {
+		<-t.stop
+		return
+	}
+
+	ticker := time.NewTicker(t.opts.SweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			t.Sweep()
+		}
+	}
+}
+
+func (t *Tracker) publish(boardID, eventType string, p Participant) {
+	if t.emit != nil {
+		t.emit(boardID, eventType, p)
+	}
+}
+
+func (e *entry) apply(update Update, now time.Time) {
+	e.LastSeen = now
+	e.Status = StatusActive
+	if update.Label != "" {
+		e.Label = update.Label
+	}
+	if update.Color != "" {
+		e.Color = update.Color
+	}
+	if update.Cursor != nil {
+		position := *update.Cursor
+		e.Cursor = &position
+		e.cursorAt = now
+	}
+}
@@ -0,0 +1,60 @@
+package presence
+
+import (
+	"testing"
+	"time"
+
+	"test1/models"
+)
+
+func TestTrackerLifecycle(t *testing.T) {
+	var events []string
+	tr := NewTracker(Options{IdleAfter: time.Minute, CursorTTL: 10 * time.Second}, func(boardID, eventType string, p Participant) {
+		events = append(events, eventType+":"+p.ID)
+	})
+	defer tr.Close()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tr.now = func() time.Time { return now }
+
+	leaveSSE := tr.Join("b", "alice", Update{Label: "Alice"})
+	leaveWS := tr.Join("b", "alice", Update{})
+	tr.Touch("b", "alice", Update{Cursor: &models.Point{X: 1, Y: 2}})
+	if list := tr.List("b"); len(list) != 1 || list[0].Connections != 2 || list[0].Label != "Alice" || list[0].Cursor == nil {
+		t.Fatalf("unexpected participants %+v", list)
+	}
+
+	now = now.Add(15 * time.Second)
+	tr.Sweep()
+	if list := tr.List("b"); list[0].Cursor != nil || list[0].Status != StatusActive {
+		t.Fatalf("expected cursor expired but still active, got %+v", list[0])
+	}
+
+	now = now.Add(time.Minute)
+	tr.Sweep()
+	tr.Sweep()
+	if tr.List("b")[0].Status != StatusIdle {
+		t.Fatal("expected alice to be idle")
+	}
+	tr.Touch("b", "alice", Update{})
+
+	leaveSSE()
+	leaveSSE()
+	if len(tr.List("b")) != 1 {
+		t.Fatal("expected alice to stay while a connection is open")
+	}
+	leaveWS()
+	if len(tr.List("b")) != 0 {
+		t.Fatal("expected alice to have left")
+	}
+
+	want := []string{"presence.joined:alice", "cursor.expired:alice", "presence.idle:alice", "presence.updated:alice", "presence.left:alice"}
+	if len(events) != len(want) {
+		t.Fatalf("expected events %v, got %v", want, events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("expected events %v, got %v", want, events)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package realtime
 
 import (
+	"encoding/json"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -11,47 +13,123 @@ const (
 	writeWait  = 10 * time.Second
 	pongWait   = 60 * time.Second
 	pingPeriod = (pongWait * 9) / 10
+
+	// maxMessageSize bounds inbound frames; ops batches can be large.
+	maxMessageSize = 1 << 20
 )
 
 // Client wraps a websocket connection registered with a hub.
 type Client struct {
-	hub  *Hub
-	conn *websocket.Conn
-	send chan []byte
+	hub         *Hub
+	conn        *websocket.Conn
+	participant string
+	handle      MessageHandler
+	// allowed reports whether the client may still receive the board's events; nil always may.
+	allowed func() bool
+
+	mu     sync.Mutex
+	send   chan []byte
+	closed bool
+}
+
+// NewClient registers a websocket connection with the hub. Inbound messages
+// other than ping are passed to handle.
+func NewClient(hub *Hub, conn *websocket.Conn, participant string, handle MessageHandler) *Client {
+	return newClient(hub, conn, participant, handle, nil)
 }
 
-// NewClient registers a websocket connection with the hub.
-func NewClient(hub *Hub, conn *websocket.Conn) *Client {
+func newClient(hub *Hub, conn *websocket.Conn, participant string, handle MessageHandler, allowed func() bool) *Client {
 	client := &Client{
-		hub:  hub,
-		conn: conn,
-		send: make(chan []byte, 256),
+		hub:         hub,
+		conn:        conn,
+		participant: participant,
+		handle:      handle,
+		allowed:     allowed,
+		send:        make(chan []byte, 256),
 	}
 	hub.register <- client
 	return client
 }
 
-// ReadPump listens for incoming messages. It currently discards client messages
-// but keeps the connection alive by responding to pings.
+// BoardID returns the board the client is connected to.
+func (c *Client) BoardID() string { return c.hub.boardID }
+
+// Participant returns the participant identity the client connected with.
+func (c *Client) Participant() string { return c.participant }
+
+// Send queues a message for this client only. It reports false if the client is
+// gone or too slow to keep up.
+func (c *Client) Send(message []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// Reply sends a typed reply to this client.
+func (c *Client) Reply(id, typ string, data interface{}) {
+	message, err := json.Marshal(Reply{Type: typ, ID: id, Data: data})
+	if err != nil {
+		log.Printf("failed to marshal websocket reply: %v", err)
+		return
+	}
+	c.Send(message)
+}
+
+// close stops the write pump; it is safe to call more than once.
+func (c *Client) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
+
+// ReadPump decodes inbound messages until the connection closes, answering
+// pings itself and passing everything else to the message handler.
 func (c *Client) ReadPump() {
 	defer func() {
 		c.hub.unregister <- c
 		c.conn.Close()
 	}()
 
-	c.conn.SetReadLimit(512)
+	c.conn.SetReadLimit(maxMessageSize)
 	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.conn.SetPongHandler(func(string) error {
 		_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
 		return nil
 	})
 	for {
-		if _, _, err := c.conn.ReadMessage(); err != nil {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("websocket read error: %v", err)
 			}
 			break
 		}
+		// Any message proves the client is alive, not just control pongs.
+		_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Type == "" {
+			c.Reply("", TypeError, map[string]interface{}{"status": 400, "error": "invalid message"})
+			continue
+		}
+		if msg.Type == TypePing {
+			c.Reply(msg.ID, TypePong, map[string]interface{}{"time": time.Now().UTC()})
+			continue
+		}
+		if c.handle != nil {
+			c.handle(c, msg)
+		}
 	}
 }
 
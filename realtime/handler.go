@@ -2,6 +2,7 @@ package realtime
 
 import (
 	"net/http"
+	"sync"
 
 	"github.com/gorilla/websocket"
 )
@@ -14,15 +15,81 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-// ServeWS upgrades the HTTP connection and registers the websocket client.
-func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
+// SubscribeFunc subscribes to a board's event stream, as EventBroadcaster.Subscribe does.
+type SubscribeFunc func(boardID string) (<-chan []byte, func())
+
+// Registry runs one hub per board with connected clients. Each hub relays the
+// board's event stream to its clients and is stopped when the last one leaves.
+type Registry struct {
+	mu        sync.Mutex
+	subscribe SubscribeFunc
+	hubs      map[string]*Hub
+	refs      map[*Hub]int
+}
+
+// NewRegistry creates a registry whose hubs relay events from subscribe.
+func NewRegistry(subscribe SubscribeFunc) *Registry {
+	return &Registry{subscribe: subscribe, hubs: make(map[string]*Hub), refs: make(map[*Hub]int)}
+}
+
+// join returns the running hub for a board, starting it on first use.
+func (reg *Registry) join(boardID string) *Hub {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	hub, ok := reg.hubs[boardID]
+	if !ok {
+		hub = NewHub(boardID)
+		reg.hubs[boardID] = hub
+		go hub.Run()
+		if reg.subscribe != nil {
+			messages, cancel := reg.subscribe(boardID)
+			go func() {
+				hub.forward(messages)
+				cancel()
+			}()
+		}
+	}
+	reg.refs[hub]++
+	return hub
+}
+
+// leave releases a hub reference and stops the hub when it was the last one.
+func (reg *Registry) leave(hub *Hub) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.refs[hub]--
+	if reg.refs[hub] > 0 {
+		return
+	}
+	delete(reg.refs, hub)
+	delete(reg.hubs, hub.boardID)
+	hub.Stop()
+}
+
+// ServeWS upgrades the HTTP connection and serves it on the board's hub until it
+// closes. allowed, when not nil, is consulted by Revalidate.
+func (reg *Registry) ServeWS(w http.ResponseWriter, r *http.Request, boardID, participant string, handle MessageHandler, allowed func() bool) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		// The upgrader has already replied with an HTTP error.
 		return
 	}
 
-	client := NewClient(hub, conn)
+	hub := reg.join(boardID)
+	defer reg.leave(hub)
+
+	client := newClient(hub, conn, participant, handle, allowed)
 	go client.WritePump()
 	client.ReadPump()
 }
+
+// Revalidate disconnects the board's clients that are no longer allowed to
+// follow it, for example after their access was revoked.
+func (reg *Registry) Revalidate(boardID string) {
+	reg.mu.Lock()
+	hub, ok := reg.hubs[boardID]
+	reg.mu.Unlock()
+	if ok {
+		hub.Revalidate()
+	}
+}
@@ -4,25 +4,31 @@ import (
 	"log"
 )
 
-// Hub maintains active websocket clients and broadcasts mutations.
+// Hub maintains the websocket clients of one board and broadcasts mutations.
 type Hub struct {
+	boardID    string
 	clients    map[*Client]bool
 	register   chan *Client
 	unregister chan *Client
 	broadcast  chan []byte
+	revalidate chan struct{}
+	done       chan struct{}
 }
 
-// NewHub creates a hub with initialized channels.
-func NewHub() *Hub {
+// NewHub creates a hub for a board with initialized channels.
+func NewHub(boardID string) *Hub {
 	return &Hub{
+		boardID:    boardID,
 		clients:    make(map[*Client]bool),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		broadcast:  make(chan []byte, 32),
+		revalidate: make(chan struct{}, 1),
+		done:       make(chan struct{}),
 	}
 }
 
-// Run processes hub events; it should be executed as a goroutine.
+// Run processes hub events until Stop is called; it should be executed as a goroutine.
 func (h *Hub) Run() {
 	for {
 		select {
@@ -31,26 +37,69 @@ func (h *Hub) Run() {
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
-				close(client.send)
+				client.close()
 			}
 		case message := <-h.broadcast:
 			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
+				if !client.Send(message) {
+					client.close()
 					delete(h.clients, client)
 				}
 			}
+		case <-h.revalidate:
+			for client := range h.clients {
+				if client.allowed != nil && !client.allowed() {
+					client.close()
+					delete(h.clients, client)
+				}
+			}
+		case <-h.done:
+			for client := range h.clients {
+				client.close()
+			}
+			return
 		}
 	}
 }
 
+// Stop ends Run and disconnects remaining clients.
+func (h *Hub) Stop() {
+	close(h.done)
+}
+
+// Revalidate asks Run to disconnect clients that are no longer allowed on the board.
+func (h *Hub) Revalidate() {
+	select {
+	case h.revalidate <- struct{}{}:
+	default: // a check is already pending and will see the latest access
+	}
+}
+
 // Broadcast enqueues a message for all connected clients.
 func (h *Hub) Broadcast(message []byte) {
 	select {
 	case h.broadcast <- message:
 	default:
-		log.Printf("dropping broadcast message due to full channel")
+		log.Printf("dropping broadcast message for board %s due to full channel", h.boardID)
+	}
+}
+
+// forward relays a subscription into the hub until the hub stops or the
+// subscription ends.
+func (h *Hub) forward(messages <-chan []byte) {
+	for {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			select {
+			case h.broadcast <- message:
+			case <-h.done:
+				return
+			}
+		case <-h.done:
+			return
+		}
 	}
 }
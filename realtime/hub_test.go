@@ -0,0 +1,82 @@
+package realtime
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRegistryRelaysEventsAndDispatchesMessages(t *testing.T) {
+	events := make(chan []byte, 1)
+	cancelled := make(chan struct{})
+	reg := NewRegistry(func(boardID string) (<-chan []byte, func()) {
+		if boardID != "b1" {
+			t.Errorf("unexpected board %q", boardID)
+		}
+		return events, func() { close(cancelled) }
+	})
+
+	handled := make(chan Message, 1)
+	var allowed atomic.Bool
+	allowed.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reg.ServeWS(w, r, "b1", "alice", func(c *Client, msg Message) {
+			if c.Participant() != "alice" || c.BoardID() != "b1" {
+				t.Errorf("unexpected client %s/%s", c.BoardID(), c.Participant())
+			}
+			handled <- msg
+		}, allowed.Load)
+	}))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	if err := conn.WriteJSON(Message{Type: TypePing, ID: "1"}); err != nil {
+		t.Fatalf("write ping: %v", err)
+	}
+	var reply Reply
+	if err := conn.ReadJSON(&reply); err != nil || reply.Type != TypePong || reply.ID != "1" {
+		t.Fatalf("expected pong for 1, got %+v (%v)", reply, err)
+	}
+
+	events <- []byte(`{"type":"note.created"}`)
+	_, data, err := conn.ReadMessage()
+	if err != nil || string(data) != `{"type":"note.created"}` {
+		t.Fatalf("expected relayed event, got %s (%v)", data, err)
+	}
+
+	if err := conn.WriteJSON(Message{Type: TypeCursor, Data: json.RawMessage(`{"position":{"x":1,"y":2}}`)}); err != nil {
+		t.Fatalf("write cursor: %v", err)
+	}
+	select {
+	case msg := <-handled:
+		if msg.Type != TypeCursor {
+			t.Fatalf("expected cursor message, got %+v", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cursor message was not dispatched")
+	}
+
+	// Once the client is no longer allowed on the board, revalidating disconnects it.
+	allowed.Store(false)
+	reg.Revalidate("b1")
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Fatal("expected a revoked client to be disconnected")
+	}
+	conn.Close()
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the hub to unsubscribe once its last client left")
+	}
+}
@@ -0,0 +1,35 @@
+package realtime
+
+import "encoding/json"
+
+// Inbound message types accepted on a board socket.
+const (
+	TypeCursor   = "cursor"
+	TypeOps      = "ops"
+	TypePresence = "presence"
+	TypePing     = "ping"
+)
+
+// Reply types sent back to the client that sent a message.
+const (
+	TypePong  = "pong"
+	TypeError = "error"
+)
+
+// Message is a typed frame sent by a client. ID is optional and echoed on the
+// reply so clients can match replies to requests.
+type Message struct {
+	Type string          `json:"type"`
+	ID   string          `json:"id,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// Reply is a frame sent to a single client in response to one of its messages.
+type Reply struct {
+	Type string      `json:"type"`
+	ID   string      `json:"id,omitempty"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// MessageHandler handles an inbound message other than ping.
+type MessageHandler func(c *Client, msg Message)
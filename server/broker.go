@@ -2,62 +2,185 @@ package server
 
 import (
 	"log"
+	"strconv"
+	"strings"
 	"sync"
+
+	"test1/handlers"
+	"test1/storage"
+	"test1/transport"
+)
+
+const (
+	// replayDepth is how many recent events per board are kept for reconnecting subscribers.
+	replayDepth = 256
+	// subscriberBuffer is how many live events a subscriber may fall behind before it is cut off.
+	subscriberBuffer = 64
 )
 
-// Broker manages subscriptions to board events.
+// Broker manages subscriptions to board events. Every event gets a per-board
+// sequence number and the most recent ones are kept so a subscriber that
+// reconnects can resume where it left off.
+//
+// With a transport, events are also exchanged with the brokers of other server
+// instances. Sequence numbers stay local to each broker, so event IDs carry the
+// broker's node ID and a subscriber resuming on another node is told to resync.
 type Broker struct {
-	mu          sync.RWMutex
-	subscribers map[string]map[chan []byte]struct{}
-	logger      *log.Logger
+	mu        sync.Mutex
+	node      string
+	streams   map[string]*stream
+	transport transport.Transport
+	logger    *log.Logger
+}
+
+type stream struct {
+	seq         uint64
+	recent      []handlers.Event
+	subscribers map[chan handlers.Event]struct{}
 }
 
-func NewBroker(logger *log.Logger) *Broker {
-	return &Broker{
-		subscribers: make(map[string]map[chan []byte]struct{}),
-		logger:      logger,
+// NewBroker creates a broker. A nil transport keeps events within this process.
+func NewBroker(logger *log.Logger, t transport.Transport) *Broker {
+	b := &Broker{
+		node:      storage.NewID()[:12],
+		streams:   make(map[string]*stream),
+		transport: t,
+		logger:    logger,
 	}
+	if t != nil {
+		t.Subscribe(b.deliver)
+	}
+	return b
 }
 
-// Subscribe registers a listener for a board and returns the channel and a cleanup function.
-func (b *Broker) Subscribe(boardID string) (<-chan []byte, func()) {
-	ch := make(chan []byte, 10)
+func (b *Broker) streamLocked(boardID string) *stream {
+	s, ok := b.streams[boardID]
+	if !ok {
+		s = &stream{subscribers: make(map[chan handlers.Event]struct{})}
+		b.streams[boardID] = s
+	}
+	return s
+}
 
+// Subscribe registers a listener for a board and returns the channel and a cleanup
+// function. With a lastEventID, buffered events after it are delivered first;
+// resumed is false when some of them are no longer available. The channel is
+// closed if the subscriber falls too far behind, so it can reconnect and catch up.
+func (b *Broker) Subscribe(boardID, lastEventID string) (<-chan handlers.Event, func(), bool) {
 	b.mu.Lock()
-	if _, ok := b.subscribers[boardID]; !ok {
-		b.subscribers[boardID] = make(map[chan []byte]struct{})
+	s := b.streamLocked(boardID)
+
+	resumed := true
+	var missed []handlers.Event
+	if lastEventID != "" {
+		lastSeq, ok := b.parseID(lastEventID)
+		switch {
+		case !ok || lastSeq > s.seq:
+			// Issued by another node or before a restart.
+			resumed = false
+		case lastSeq < s.seq:
+			if len(s.recent) == 0 || s.recent[0].Seq > lastSeq+1 {
+				resumed = false
+			}
+			for _, evt := range s.recent {
+				if evt.Seq > lastSeq {
+					missed = append(missed, evt)
+				}
+			}
+		}
+	}
+
+	ch := make(chan handlers.Event, len(missed)+subscriberBuffer)
+	for _, evt := range missed {
+		ch <- evt
 	}
-	b.subscribers[boardID][ch] = struct{}{}
+	s.subscribers[ch] = struct{}{}
 	b.mu.Unlock()
 
+	var once sync.Once
 	cancel := func() {
-		b.mu.Lock()
-		if subs, ok := b.subscribers[boardID]; ok {
-			delete(subs, ch)
-			if len(subs) == 0 {
-				delete(b.subscribers, boardID)
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if _, ok := s.subscribers[ch]; ok {
+				delete(s.subscribers, ch)
+				close(ch)
 			}
-		}
-		b.mu.Unlock()
-		close(ch)
+		})
 	}
 
-	return ch, cancel
+	return ch, cancel, resumed
 }
 
-// Broadcast sends a message to all subscribers of a board.
+// Broadcast sends a message to all subscribers of a board, on this node and,
+// through the transport, on every other node.
 func (b *Broker) Broadcast(boardID string, message []byte) {
-	b.mu.RLock()
-	subs := b.subscribers[boardID]
-	b.mu.RUnlock()
+	b.deliver(boardID, message)
+	if b.transport == nil {
+		return
+	}
+	if err := b.transport.Publish(boardID, message); err != nil && b.logger != nil {
+		b.logger.Printf("failed to publish event for board %s to other nodes: %v", boardID, err)
+	}
+}
+
+// deliver sequences a message and fans it out to local subscribers.
+func (b *Broker) deliver(boardID string, message []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := b.streamLocked(boardID)
+	s.seq++
+	evt := handlers.Event{ID: b.node + "-" + strconv.FormatUint(s.seq, 10), Seq: s.seq, Data: message}
+	s.recent = append(s.recent, evt)
+	if len(s.recent) > replayDepth {
+		s.recent = append([]handlers.Event(nil), s.recent[len(s.recent)-replayDepth:]...)
+	}
 
-	for ch := range subs {
+	for ch := range s.subscribers {
 		select {
-		case ch <- message:
+		case ch <- evt:
 		default:
 			if b.logger != nil {
-				b.logger.Printf("dropping event for board %s: subscriber too slow", boardID)
+				b.logger.Printf("disconnecting slow subscriber of board %s at event %d", boardID, evt.Seq)
 			}
+			delete(s.subscribers, ch)
+			close(ch)
 		}
 	}
 }
+
+// Forget drops a board's stream with its replay buffer and closes the
+// channels of its subscribers, for a board that is gone for good.
+func (b *Broker) Forget(boardID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.streams[boardID]
+	if !ok {
+		return
+	}
+	for ch := range s.subscribers {
+		delete(s.subscribers, ch)
+		close(ch)
+	}
+	delete(b.streams, boardID)
+}
+
+// parseID returns the sequence number of an event ID issued by this broker.
+func (b *Broker) parseID(id string) (uint64, bool) {
+	node, seq, ok := strings.Cut(id, "-")
+	if !ok || node != b.node {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	return n, err == nil
+}
+
+// Close detaches the broker from its transport.
+func (b *Broker) Close() error {
+	if b.transport == nil {
+		return nil
+	}
+	return b.transport.Close()
+}
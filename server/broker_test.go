@@ -0,0 +1,145 @@
+package server
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"test1/transport"
+)
+
+func TestBrokerReplaysAfterLastEventID(t *testing.T) {
+	b := NewBroker(nil, nil)
+	first, cancelFirst, _ := b.Subscribe("b", "")
+	for i := 1; i <= 3; i++ {
+		b.Broadcast("b", []byte(strconv.Itoa(i)))
+	}
+	seen := <-first
+	cancelFirst()
+
+	events, cancel, resumed := b.Subscribe("b", seen.ID)
+	defer cancel()
+	if !resumed {
+		t.Fatal("expected to resume from a buffered event")
+	}
+	for want := uint64(2); want <= 3; want++ {
+		evt := <-events
+		if evt.Seq != want || string(evt.Data) != strconv.FormatUint(want, 10) {
+			t.Fatalf("expected event %d, got %d %q", want, evt.Seq, evt.Data)
+		}
+	}
+
+	for _, id := range []string{b.node + "-99", "othernode-1", "garbage"} {
+		if _, cancel, resumed := b.Subscribe("b", id); resumed {
+			t.Fatalf("expected %q to require a resync", id)
+		} else {
+			cancel()
+		}
+	}
+}
+
+func TestBrokerReportsGapsAndCutsOffSlowSubscribers(t *testing.T) {
+	b := NewBroker(nil, nil)
+	slow, cancelSlow, _ := b.Subscribe("b", "")
+	defer cancelSlow()
+
+	for i := 0; i < replayDepth+subscriberBuffer; i++ {
+		b.Broadcast("b", []byte("x"))
+	}
+
+	drained := 0
+	for range slow {
+		drained++
+	}
+	if drained != subscriberBuffer {
+		t.Fatalf("expected the slow subscriber to be closed after %d events, got %d", subscriberBuffer, drained)
+	}
+
+	// Events 1..subscriberBuffer have been evicted from the replay buffer.
+	id := func(seq int) string { return b.node + "-" + strconv.Itoa(seq) }
+	if _, cancel, resumed := b.Subscribe("b", id(subscriberBuffer-1)); resumed {
+		t.Fatal("expected evicted events to require a resync")
+	} else {
+		cancel()
+	}
+	if _, cancel, resumed := b.Subscribe("b", id(subscriberBuffer)); !resumed {
+		t.Fatal("expected the oldest buffered event to be resumable")
+	} else {
+		cancel()
+	}
+}
+
+func TestBrokersShareEventsOverTransports(t *testing.T) {
+	relay, err := transport.ListenRelay("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatalf("listen relay: %v", err)
+	}
+	defer relay.Close()
+
+	dial := func() transport.Transport {
+		tr, err := transport.DialTCP(relay.Addr(), nil)
+		if err != nil {
+			t.Fatalf("dial relay: %v", err)
+		}
+		return tr
+	}
+	bus := transport.NewBus()
+
+	cases := map[string][2]transport.Transport{
+		"bus": {bus.Node(), bus.Node()},
+		"tcp": {dial(), dial()},
+	}
+	for name, pair := range cases {
+		t.Run(name, func(t *testing.T) {
+			a, b := NewBroker(nil, pair[0]), NewBroker(nil, pair[1])
+			defer a.Close()
+			defer b.Close()
+
+			onA, cancelA, _ := a.Subscribe("board", "")
+			defer cancelA()
+			onB, cancelB, _ := b.Subscribe("board", "")
+			defer cancelB()
+
+			// The relay may still be accepting b's connection, so publish until b hears it.
+			sent := 0
+			deadline := time.After(5 * time.Second)
+		wait:
+			for {
+				a.Broadcast("board", []byte(`{"from":"a"}`))
+				sent++
+				select {
+				case evt := <-onB:
+					if string(evt.Data) != `{"from":"a"}` {
+						t.Fatalf("node b got %q", evt.Data)
+					}
+					break wait
+				case <-time.After(50 * time.Millisecond):
+				case <-deadline:
+					t.Fatal("node b did not receive the event")
+				}
+			}
+
+			time.Sleep(100 * time.Millisecond)
+			if got := len(onA); got != sent {
+				t.Fatalf("expected node a to see its %d events once each, got %d", sent, got)
+			}
+		})
+	}
+}
+
+func TestBrokerForgetsPurgedBoards(t *testing.T) {
+	b := NewBroker(nil, nil)
+	events, cancel, _ := b.Subscribe("b", "")
+	defer cancel()
+	b.Broadcast("b", []byte("x"))
+	<-events
+
+	b.Forget("b")
+	if _, ok := <-events; ok {
+		t.Fatal("expected the subscriber to be closed")
+	}
+	if len(b.streams) != 0 {
+		t.Fatalf("expected the stream to be dropped, got %d", len(b.streams))
+	}
+	b.Forget("unknown")
+}
@@ -1,6 +1,8 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -11,17 +13,22 @@ import (
 // Server wires together HTTP handlers, storage, and event broadcasting.
 type Server struct {
 	addr    string
-	store   *Store
+	store   handlers.BoardStore
 	broker  *Broker
 	handler *handlers.Handler
 	logger  *log.Logger
+	http    *http.Server
 }
 
-// NewServer constructs a server with default dependencies.
-func NewServer(addr string, logger *log.Logger) *Server {
-	store := NewStore()
-	broker := NewBroker(logger)
-	handler := handlers.New(store, broker, logger)
+// NewServer constructs a server around the given board store. Events are
+// published through broker, or an in-process broker when it is nil.
+func NewServer(addr string, store handlers.BoardStore, broker *Broker, logger *log.Logger, opts ...handlers.Option) *Server {
+	if broker == nil {
+		broker = NewBroker(logger, nil)
+	}
+	handler := handlers.New(store, broker, logger, opts...)
+	mux := http.NewServeMux()
+	handler.RegisterRoutes(mux)
 
 	return &Server{
 		addr:    addr,
@@ -29,24 +36,31 @@ func NewServer(addr string, logger *log.Logger) *Server {
 		broker:  broker,
 		handler: handler,
 		logger:  logger,
+		// Created up front so Shutdown never races Start over it.
+		http: &http.Server{
+			Addr:         addr,
+			Handler:      mux,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 0,
+			IdleTimeout:  60 * time.Second,
+		},
 	}
 }
 
-// Start launches the HTTP server.
+// Start launches the HTTP server. It returns nil once Shutdown has been
+// called, straight away when that happened before Start.
 func (s *Server) Start() error {
-	mux := http.NewServeMux()
-	s.handler.RegisterRoutes(mux)
-
-	srv := &http.Server{
-		Addr:         s.addr,
-		Handler:      mux,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 0,
-		IdleTimeout:  60 * time.Second,
-	}
-
 	if s.logger != nil {
 		s.logger.Printf("listening on %s", s.addr)
 	}
-	return srv.ListenAndServe()
+	if err := s.http.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting requests and waits for in-flight ones to finish.
+func (s *Server) Shutdown(ctx context.Context) error {
+	defer s.handler.Close()
+	return s.http.Shutdown(ctx)
 }
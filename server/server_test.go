@@ -0,0 +1,26 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"test1/storage"
+)
+
+func TestShutdownStopsAServerStartedAfterIt(t *testing.T) {
+	s := NewServer("127.0.0.1:0", storage.NewInMemoryStore(), nil, nil)
+	started := make(chan error, 1)
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	go func() { started <- s.Start() }()
+	select {
+	case err := <-started:
+		if err != nil {
+			t.Fatalf("expected Start to return nil after Shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Start to return once the server was shut down")
+	}
+}
@@ -0,0 +1,72 @@
+package status
+
+import (
+	"math"
+	"strings"
+
+	"test1/models"
+)
+
+// Propagation modes decide how far a node's confidence counts when its
+// status is passed downstream. A board picks one in its Propagation field.
+const (
+	// ModeStatus passes statuses on at full strength whatever their
+	// confidence, which is only reported. It is the default.
+	ModeStatus = "status"
+	// ModeConfidence scales what a node passes on by its confidence, so a
+	// doubtful cause pushes less than a certain one and doubt carries down
+	// a chain. Nodes without a confidence count as certain.
+	ModeConfidence = "confidence"
+	// ModeNoisyOr scales by confidence too, and nodes that would average
+	// their inputs combine them as certainty factors instead: each link is an
+	// independent chance, its source's confidence times its weight capped at
+	// 1, of pushing the node its way. Chances the same way add up by
+	// noisy-OR, so two weak causes make a stronger case than either; the
+	// cases for and against then offset each other, the weaker in proportion
+	// to what the stronger leaves open.
+	ModeNoisyOr = "noisy-or"
+)
+
+// opNoisyOr is the combination ModeNoisyOr uses in place of the average.
+const opNoisyOr = "noisy-or"
+
+// Mode normalizes a board's propagation mode; unknown or empty names are ModeStatus.
+func Mode(name string) string {
+	switch mode := strings.ToLower(strings.TrimSpace(name)); mode {
+	case ModeConfidence, ModeNoisyOr:
+		return mode
+	default:
+		return ModeStatus
+	}
+}
+
+// signal is what a node passes downstream before anything upstream of it has
+// been evaluated: the value of its status, scaled by its confidence unless
+// the mode ignores confidence.
+func signal(node *models.CausalNode, mode string) float64 {
+	value := statusValue(node.Status)
+	if mode == ModeStatus || node.Confidence == 0 {
+		return value
+	}
+	return value * clamp(node.Confidence, 0, 1)
+}
+
+// noisyOr combines the evidence as certainty factors; see ModeNoisyOr.
+func noisyOr(evidence []models.NodeEvidence) float64 {
+	notFor, notAgainst := 1.0, 1.0
+	for _, ev := range evidence {
+		chance := math.Min(math.Abs(ev.Contribution), 1)
+		if ev.Contribution > 0 {
+			notFor *= 1 - chance
+		} else {
+			notAgainst *= 1 - chance
+		}
+	}
+	caseFor, caseAgainst := 1-notFor, 1-notAgainst
+	open := 1 - math.Min(caseFor, caseAgainst)
+	if open == 0 {
+		// Certain both ways: the evidence cancels out.
+		return 0
+	}
+	return (caseFor - caseAgainst) / open
+}
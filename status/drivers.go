@@ -0,0 +1,173 @@
+package status
+
+import (
+	"math"
+	"sort"
+
+	"test1/models"
+)
+
+// pathBudget caps how many paths Drivers follows, since a densely linked
+// model has exponentially many.
+const pathBudget = 10000
+
+// DriverAnalysis ranks the upstream factors of a target node.
+type DriverAnalysis struct {
+	Target string `json:"target"`
+	Status string `json:"status,omitempty"`
+	// Score is the target's signed score, from -1 to 1, as the board stands.
+	Score   float64      `json:"score"`
+	Drivers []Driver     `json:"drivers"`
+	Paths   []CausalPath `json:"paths"`
+	// Truncated is set when there were too many paths to follow them all.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Driver is a node upstream of the target with its influence on it.
+type Driver struct {
+	NodeID string `json:"nodeId"`
+	Label  string `json:"label,omitempty"`
+	Status string `json:"status,omitempty"`
+	// Influence is half the difference in the target's score between this
+	// node being certainly positive and certainly negative, with everything
+	// else as it is: 1 when the target follows it fully, -1 when the target
+	// moves against it and 0 when it makes no difference.
+	Influence float64 `json:"influence"`
+	// Distance is the fewest links between the node and the target.
+	Distance int `json:"distance"`
+}
+
+// CausalPath is a chain of links leading to the target.
+type CausalPath struct {
+	// Nodes run from the upstream end to the target; Links join them in order.
+	Nodes []string `json:"nodes"`
+	Links []string `json:"links"`
+	// Strength is the product of the signed link weights along the path.
+	Strength float64 `json:"strength"`
+}
+
+// Drivers ranks every node upstream of target by its influence on it,
+// measured by propagating the board with each one pinned positive and then
+// negative, and lists the maxPaths strongest paths into target. ok is false
+// when target is not a node on the board.
+func Drivers(board models.Board, target string, maxPaths int) (analysis DriverAnalysis, ok bool) {
+	g := newGraph(&board, nil)
+	node := g.nodes[target]
+	if node == nil {
+		return DriverAnalysis{}, false
+	}
+	_, baseline := propagate(causalCopy(board), nil)
+	analysis = DriverAnalysis{Target: target, Status: node.Status, Score: baseline[target], Drivers: []Driver{}}
+
+	for id, distance := range g.ancestors(target) {
+		up := probe(board, id, "positive", target)
+		down := probe(board, id, "negative", target)
+		ancestor := g.nodes[id]
+		analysis.Drivers = append(analysis.Drivers, Driver{
+			NodeID:    id,
+			Label:     ancestor.Label,
+			Status:    ancestor.Status,
+			Influence: (up - down) / 2,
+			Distance:  distance,
+		})
+	}
+	sort.Slice(analysis.Drivers, func(i, j int) bool {
+		a, b := analysis.Drivers[i], analysis.Drivers[j]
+		if ia, ib := math.Abs(a.Influence), math.Abs(b.Influence); almostDiff(ia, ib) {
+			return ia > ib
+		}
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+		return g.order[a.NodeID] < g.order[b.NodeID]
+	})
+
+	analysis.Paths, analysis.Truncated = g.paths(target)
+	sort.SliceStable(analysis.Paths, func(i, j int) bool {
+		a, b := analysis.Paths[i], analysis.Paths[j]
+		if sa, sb := math.Abs(a.Strength), math.Abs(b.Strength); almostDiff(sa, sb) {
+			return sa > sb
+		}
+		return len(a.Links) < len(b.Links)
+	})
+	if len(analysis.Paths) > maxPaths {
+		analysis.Paths = analysis.Paths[:maxPaths]
+	}
+	return analysis, true
+}
+
+// causalCopy copies what propagation changes, the causal nodes, and shares
+// everything it only reads.
+func causalCopy(board models.Board) models.Board {
+	return models.Board{
+		CausalNodes: append([]models.CausalNode(nil), board.CausalNodes...),
+		CausalLinks: board.CausalLinks,
+		Propagation: board.Propagation,
+	}
+}
+
+// probe is the target's score with one node pinned at status with full confidence.
+func probe(board models.Board, pin, status, target string) float64 {
+	trial := causalCopy(board)
+	for i := range trial.CausalNodes {
+		if trial.CausalNodes[i].ID == pin {
+			trial.CausalNodes[i].Status = status
+			trial.CausalNodes[i].Confidence = 1
+		}
+	}
+	_, scores := propagate(trial, map[string]bool{pin: true})
+	return scores[target]
+}
+
+// ancestors maps the nodes with a path to target to the fewest links on it.
+func (g *graph) ancestors(target string) map[string]int {
+	distance := map[string]int{target: 0}
+	queue := []string{target}
+	for len(queue) > 0 {
+		at := queue[0]
+		queue = queue[1:]
+		for _, link := range g.incoming[at] {
+			if _, seen := distance[link.From]; seen || g.nodes[link.From] == nil {
+				continue
+			}
+			distance[link.From] = distance[at] + 1
+			queue = append(queue, link.From)
+		}
+	}
+	delete(distance, target)
+	return distance
+}
+
+// paths lists the paths into target that visit no node twice, following at
+// most pathBudget of them.
+func (g *graph) paths(target string) (found []CausalPath, truncated bool) {
+	budget := pathBudget
+	onPath := map[string]bool{target: true}
+	var walk func(at string, nodes, links []string, strength float64)
+	walk = func(at string, nodes, links []string, strength float64) {
+		for _, link := range g.incoming[at] {
+			if g.nodes[link.From] == nil || onPath[link.From] {
+				continue
+			}
+			if budget == 0 {
+				truncated = true
+				return
+			}
+			budget--
+			path := CausalPath{
+				Nodes:    append([]string{link.From}, nodes...),
+				Links:    append([]string{link.ID}, links...),
+				Strength: strength * linkWeight(link),
+			}
+			found = append(found, path)
+			onPath[link.From] = true
+			walk(link.From, path.Nodes, path.Links, path.Strength)
+			onPath[link.From] = false
+		}
+	}
+	walk(target, []string{target}, nil, 1)
+	if found == nil {
+		found = []CausalPath{}
+	}
+	return found, truncated
+}
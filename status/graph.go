@@ -0,0 +1,119 @@
+package status
+
+import (
+	"sort"
+
+	"test1/models"
+)
+
+// graph indexes a board's causal nodes and the links between them.
+type graph struct {
+	nodes    map[string]*models.CausalNode
+	order    map[string]int
+	incoming map[string][]models.CausalLink
+	outgoing map[string][]string
+	ids      []string
+	mode     string
+}
+
+// newGraph indexes board. Links into pinned nodes are left out, so those
+// nodes keep the status they have.
+func newGraph(board *models.Board, pinned map[string]bool) *graph {
+	g := &graph{
+		nodes:    make(map[string]*models.CausalNode, len(board.CausalNodes)),
+		order:    make(map[string]int, len(board.CausalNodes)),
+		incoming: make(map[string][]models.CausalLink),
+		outgoing: make(map[string][]string),
+		mode:     Mode(board.Propagation),
+	}
+	for i := range board.CausalNodes {
+		node := &board.CausalNodes[i]
+		if _, dup := g.nodes[node.ID]; dup {
+			continue
+		}
+		g.nodes[node.ID] = node
+		g.order[node.ID] = len(g.ids)
+		g.ids = append(g.ids, node.ID)
+	}
+	for _, link := range board.CausalLinks {
+		if pinned[link.To] {
+			continue
+		}
+		g.incoming[link.To] = append(g.incoming[link.To], link)
+		if g.nodes[link.From] != nil && g.nodes[link.To] != nil {
+			g.outgoing[link.From] = append(g.outgoing[link.From], link.To)
+		}
+	}
+	return g
+}
+
+// components returns the strongly connected components of the graph with
+// every component after all components that link into it. Nodes that are
+// not part of a cycle form components of their own.
+func (g *graph) components() [][]string {
+	// Tarjan's algorithm finds components downstream-first.
+	var (
+		index    = make(map[string]int, len(g.ids))
+		low      = make(map[string]int, len(g.ids))
+		onStack  = make(map[string]bool, len(g.ids))
+		stack    []string
+		found    [][]string
+		strongly func(id string)
+	)
+	strongly = func(id string) {
+		index[id] = len(index)
+		low[id] = index[id]
+		stack = append(stack, id)
+		onStack[id] = true
+		for _, next := range g.outgoing[id] {
+			if _, seen := index[next]; !seen {
+				strongly(next)
+				low[id] = min(low[id], low[next])
+			} else if onStack[next] {
+				low[id] = min(low[id], index[next])
+			}
+		}
+		if low[id] != index[id] {
+			return
+		}
+		var component []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == id {
+				break
+			}
+		}
+		found = append(found, g.inBoardOrder(component))
+	}
+	for _, id := range g.ids {
+		if _, seen := index[id]; !seen {
+			strongly(id)
+		}
+	}
+	for i, j := 0, len(found)-1; i < j; i, j = i+1, j-1 {
+		found[i], found[j] = found[j], found[i]
+	}
+	return found
+}
+
+// cyclic reports whether a component is a feedback loop: more than one node,
+// or a node linked to itself.
+func (g *graph) cyclic(component []string) bool {
+	if len(component) > 1 {
+		return true
+	}
+	for _, next := range g.outgoing[component[0]] {
+		if next == component[0] {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *graph) inBoardOrder(ids []string) []string {
+	sort.Slice(ids, func(i, j int) bool { return g.order[ids[i]] < g.order[ids[j]] })
+	return ids
+}
@@ -0,0 +1,167 @@
+package status
+
+import (
+	"math"
+	"strings"
+
+	"test1/models"
+)
+
+// Junction operators decide how the links arriving at a causal node combine
+// into its score. Scores run from -1 (negative) to 1 (positive), and an input
+// is its upstream score times the link weight; AND, OR, product and the fuzzy
+// operators cap each input to that range first.
+const (
+	// OpAverage is the weighted mean of the inputs, and the default.
+	OpAverage = "average"
+	// OpAnd takes the weakest input: the node is only as positive as its least positive cause.
+	OpAnd = "and"
+	// OpOr takes the strongest input: any one positive cause suffices.
+	OpOr = "or"
+	// OpSum adds the inputs up.
+	OpSum = "sum"
+	// OpProduct multiplies the inputs.
+	OpProduct = "product"
+	// OpNot is the weighted mean of the inputs, inverted.
+	OpNot = "not"
+	// OpFuzzyAnd reads each input as the likelihood of its cause holding,
+	// from 0 at -1 to 1 at 1, and multiplies them: all causes have to hold.
+	OpFuzzyAnd = "fuzzy-and"
+	// OpFuzzyOr is the likelihood that at least one cause holds.
+	OpFuzzyOr = "fuzzy-or"
+)
+
+// Operator normalizes the operator name of a node. Unknown or empty names
+// are averaged, as all nodes were before operators existed.
+func Operator(name string) string {
+	switch op := strings.ToLower(strings.TrimSpace(name)); op {
+	case "min":
+		return OpAnd
+	case "max":
+		return OpOr
+	case OpAnd, OpOr, OpSum, OpProduct, OpNot, OpFuzzyAnd, OpFuzzyOr:
+		return op
+	default:
+		return OpAverage
+	}
+}
+
+// combine works out a node's score from the evidence of its incoming links
+// with a normalized operator and marks the evidence that decided it as
+// dominant. ok is false when nothing upstream contributes.
+func combine(operator string, evidence []models.NodeEvidence) (float64, bool) {
+	if len(evidence) == 0 {
+		return 0, false
+	}
+	inputs := make([]float64, len(evidence))
+	for i, ev := range evidence {
+		inputs[i] = clamp(ev.Contribution, -1, 1)
+	}
+
+	var score float64
+	switch operator {
+	case OpAnd:
+		score = minOf(inputs)
+		markEqual(evidence, inputs, score)
+	case OpOr:
+		score = maxOf(inputs)
+		markEqual(evidence, inputs, score)
+	case OpSum:
+		for _, ev := range evidence {
+			score += ev.Contribution
+		}
+		score = clamp(score, -1, 1)
+		markAligned(evidence, score)
+	case OpProduct:
+		score = 1
+		weakest := math.Inf(1)
+		for _, v := range inputs {
+			score *= v
+			weakest = math.Min(weakest, math.Abs(v))
+		}
+		for i := range evidence {
+			evidence[i].Dominant = math.Abs(inputs[i]) == weakest
+		}
+	case OpFuzzyAnd:
+		holds := 1.0
+		for _, v := range inputs {
+			holds *= likelihood(v)
+		}
+		score = 2*holds - 1
+		markEqual(evidence, inputs, minOf(inputs))
+	case OpFuzzyOr:
+		fails := 1.0
+		for _, v := range inputs {
+			fails *= 1 - likelihood(v)
+		}
+		score = 2*(1-fails) - 1
+		markEqual(evidence, inputs, maxOf(inputs))
+	case opNoisyOr:
+		score = noisyOr(evidence)
+		markAligned(evidence, score)
+	case OpNot:
+		avg, ok := weightedMean(evidence)
+		if !ok {
+			return 0, false
+		}
+		// The inputs that pushed the mean are the ones the inversion turns round.
+		markAligned(evidence, avg)
+		score = -avg
+	default:
+		avg, ok := weightedMean(evidence)
+		if !ok {
+			return 0, false
+		}
+		markAligned(evidence, avg)
+		score = avg
+	}
+	return score, true
+}
+
+func weightedMean(evidence []models.NodeEvidence) (float64, bool) {
+	scoreSum := 0.0
+	weightSum := 0.0
+	for _, ev := range evidence {
+		scoreSum += ev.Contribution
+		weightSum += math.Abs(ev.Weight)
+	}
+	if weightSum == 0 {
+		return 0, false
+	}
+	return scoreSum / weightSum, true
+}
+
+// likelihood maps a score onto the chance that its cause holds.
+func likelihood(score float64) float64 {
+	return (score + 1) / 2
+}
+
+// markEqual marks the inputs equal to the one an extreme was taken from.
+func markEqual(evidence []models.NodeEvidence, inputs []float64, v float64) {
+	for i := range evidence {
+		evidence[i].Dominant = inputs[i] == v
+	}
+}
+
+// markAligned marks the inputs pulling the same way as the score.
+func markAligned(evidence []models.NodeEvidence, score float64) {
+	for i, ev := range evidence {
+		evidence[i].Dominant = score != 0 && ev.Contribution*score > 0
+	}
+}
+
+func minOf(values []float64) float64 {
+	m := values[0]
+	for _, v := range values {
+		m = math.Min(m, v)
+	}
+	return m
+}
+
+func maxOf(values []float64) float64 {
+	m := values[0]
+	for _, v := range values {
+		m = math.Max(m, v)
+	}
+	return m
+}
@@ -8,37 +8,108 @@ import (
 	"test1/models"
 )
 
+const (
+	// Damping is the share of a new estimate a node in a feedback loop takes
+	// on each iteration; the rest is kept from the iteration before, which
+	// stops loops with negative feedback from flipping back and forth.
+	Damping = 0.5
+	// MaxIterations caps how often a feedback loop is evaluated while it settles.
+	MaxIterations = 100
+	// tolerance is the largest change in any score that still counts as settled.
+	tolerance = 0.0001
+)
+
 // Propagate recalculates downstream causal node statuses based on incoming links and upstream states.
+// Nodes are evaluated upstream-first, so a change travels along a whole chain
+// in one pass whatever order the nodes are stored in. The nodes of a feedback
+// loop are evaluated together until their scores settle; loops that have not
+// settled after MaxIterations are listed in the board's UnsettledLoops.
 func Propagate(board models.Board) models.Board {
-	nodes := make(map[string]*models.CausalNode, len(board.CausalNodes))
-	for i := range board.CausalNodes {
-		nodes[board.CausalNodes[i].ID] = &board.CausalNodes[i]
-	}
+	board, _ = propagate(board, nil)
+	return board
+}
+
+// propagate is Propagate with the statuses of pinned nodes held as they are.
+// It also returns the signed score each node settled on.
+func propagate(board models.Board, pinned map[string]bool) (models.Board, map[string]float64) {
+	g := newGraph(&board, pinned)
 
-	incoming := make(map[string][]models.CausalLink)
-	for _, link := range board.CausalLinks {
-		incoming[link.To] = append(incoming[link.To], link)
+	// A node's signal is the score it was derived from, or its own status
+	// while it has no inputs. What it passes downstream is its output.
+	signals := make(map[string]float64, len(g.ids))
+	for _, id := range g.ids {
+		signals[id] = signal(g.nodes[id], g.mode)
 	}
 
+	board.UnsettledLoops = nil
 	now := time.Now().UTC()
-	for i := range board.CausalNodes {
-		node := &board.CausalNodes[i]
-		evidence := gatherEvidence(incoming[node.ID], nodes)
-		if len(evidence) == 0 {
-			continue
+	for _, component := range g.components() {
+		if g.cyclic(component) {
+			iterations, residual := g.settle(component, signals)
+			if residual >= tolerance {
+				board.UnsettledLoops = append(board.UnsettledLoops, models.FeedbackLoop{
+					Nodes:      component,
+					Iterations: iterations,
+					Residual:   residual,
+				})
+			}
+		} else if score, _, ok := g.evaluate(component[0], signals); ok {
+			signals[component[0]] = score
 		}
+		g.apply(component, signals, now)
+	}
+
+	return board, signals
+}
+
+// evaluate combines the signals arriving at a node with its operator, or by
+// noisy-OR in place of the average when the board propagates that way. ok is
+// false when nothing upstream contributes, so the node keeps its own status.
+func (g *graph) evaluate(id string, signals map[string]float64) (score float64, evidence []models.NodeEvidence, ok bool) {
+	operator := Operator(g.nodes[id].Operator)
+	if operator == OpAverage && g.mode == ModeNoisyOr {
+		operator = opNoisyOr
+	}
+	evidence = g.gatherEvidence(g.incoming[id], signals)
+	score, ok = combine(operator, evidence)
+	return score, evidence, ok
+}
 
-		scoreSum := 0.0
-		weightSum := 0.0
-		for _, ev := range evidence {
-			scoreSum += ev.Contribution
-			weightSum += math.Abs(ev.Weight)
+// settle evaluates the nodes of a feedback loop together, moving each score
+// part of the way towards its new estimate, until no score changes by more
+// than the tolerance or MaxIterations is reached.
+func (g *graph) settle(loop []string, signals map[string]float64) (iterations int, residual float64) {
+	next := make(map[string]float64, len(loop))
+	for iterations = 1; iterations <= MaxIterations; iterations++ {
+		for _, id := range loop {
+			if score, _, ok := g.evaluate(id, signals); ok {
+				next[id] = signals[id] + Damping*(score-signals[id])
+			}
 		}
-		if weightSum == 0 {
-			continue
+		residual = 0
+		for id, score := range next {
+			residual = max(residual, math.Abs(score-signals[id]))
+			signals[id] = score
+		}
+		if residual < tolerance {
+			return iterations, residual
 		}
+	}
+	return MaxIterations, residual
+}
 
-		avg := scoreSum / weightSum
+// apply sets the status and confidence of a component's nodes from their
+// settled scores, then their evidence, so the evidence within a loop shows
+// the statuses its members end up with.
+func (g *graph) apply(component []string, signals map[string]float64, now time.Time) {
+	derived := make([]*models.CausalNode, 0, len(component))
+	for _, id := range component {
+		node := g.nodes[id]
+		if _, _, ok := g.evaluate(id, signals); !ok {
+			continue
+		}
+		derived = append(derived, node)
+		avg := signals[id]
 		status := deriveStatus(avg)
 		conf := clamp(math.Abs(avg), 0, 1)
 		if status != "" && (status != node.Status || almostDiff(conf, node.Confidence)) {
@@ -46,20 +117,20 @@ func Propagate(board models.Board) models.Board {
 			node.Confidence = conf
 			node.StatusUpdatedAt = now
 		}
-		node.Evidence = evidence
 	}
-
-	return board
+	for _, node := range derived {
+		_, node.Evidence, _ = g.evaluate(node.ID, signals)
+	}
 }
 
-func gatherEvidence(links []models.CausalLink, nodes map[string]*models.CausalNode) []models.NodeEvidence {
+func (g *graph) gatherEvidence(links []models.CausalLink, signals map[string]float64) []models.NodeEvidence {
 	evidence := make([]models.NodeEvidence, 0, len(links))
 	for _, link := range links {
-		src := nodes[link.From]
+		src := g.nodes[link.From]
 		if src == nil {
 			continue
 		}
-		contribution := statusValue(src.Status) * linkWeight(link)
+		contribution := g.output(src.ID, signals) * linkWeight(link)
 		evidence = append(evidence, models.NodeEvidence{
 			SourceID:     src.ID,
 			SourceLabel:  src.Label,
@@ -73,6 +144,16 @@ func gatherEvidence(links []models.CausalLink, nodes map[string]*models.CausalNo
 	return evidence
 }
 
+// output is what a node passes downstream. In ModeStatus that is the value
+// of the status its signal amounts to, so statuses pass on at full strength;
+// the other modes pass the signal itself.
+func (g *graph) output(id string, signals map[string]float64) float64 {
+	if g.mode == ModeStatus {
+		return statusValue(deriveStatus(signals[id]))
+	}
+	return signals[id]
+}
+
 func deriveStatus(score float64) string {
 	switch {
 	case score > 0.2:
@@ -1,6 +1,8 @@
 package status
 
 import (
+	"fmt"
+	"math"
 	"testing"
 
 	"test1/models"
@@ -50,6 +52,428 @@ func TestPropagateHandlesNegativePolarity(t *testing.T) {
 	}
 }
 
+func TestPropagateSettlesChainsStoredDownstreamFirst(t *testing.T) {
+	board := models.Board{
+		CausalNodes: []models.CausalNode{{ID: "c"}, {ID: "b"}, {ID: "a", Status: "positive"}},
+		CausalLinks: []models.CausalLink{
+			{ID: "l2", From: "b", To: "c", Polarity: "negative", Weight: 1},
+			{ID: "l1", From: "a", To: "b", Polarity: "positive", Weight: 1},
+		},
+	}
+
+	result := Propagate(board)
+	if got := findNode(result.CausalNodes, "b").Status; got != "positive" {
+		t.Fatalf("expected b to be positive after one pass, got %q", got)
+	}
+	if got := findNode(result.CausalNodes, "c").Status; got != "negative" {
+		t.Fatalf("expected c to be negative after one pass, got %q", got)
+	}
+}
+
+func TestPropagatePassesStatusesOnAtFullStrength(t *testing.T) {
+	// b comes out negative at -1/3 from mixed inputs; c sees a fully negative
+	// b, as it did before propagation followed the graph.
+	board := models.Board{
+		CausalNodes: []models.CausalNode{
+			{ID: "a", Status: "positive"}, {ID: "e", Status: "negative"}, {ID: "f", Status: "positive"},
+			{ID: "g", Status: "positive"}, {ID: "b"}, {ID: "c"},
+		},
+		CausalLinks: []models.CausalLink{
+			{ID: "l1", From: "a", To: "b", Weight: 1},
+			{ID: "l2", From: "e", To: "b", Weight: 3},
+			{ID: "l3", From: "f", To: "b", Weight: 0.5},
+			{ID: "l4", From: "b", To: "c", Weight: 1},
+			{ID: "l5", From: "g", To: "c", Weight: 0.5},
+		},
+	}
+
+	result := Propagate(board)
+	b, c := findNode(result.CausalNodes, "b"), findNode(result.CausalNodes, "c")
+	if b.Status != "negative" || almostDiff(b.Confidence, 1.0/3) {
+		t.Fatalf("expected b negative at 0.33, got %s at %.4f", b.Status, b.Confidence)
+	}
+	// c = (-1 + 0.5) / 1.5
+	if c.Status != "negative" || almostDiff(c.Confidence, 1.0/3) || c.Evidence[0].Contribution != -1 {
+		t.Fatalf("expected c negative at 0.33 from b's full status, got %s at %.4f with %+v", c.Status, c.Confidence, c.Evidence)
+	}
+}
+
+func TestPropagateSettlesFeedbackLoops(t *testing.T) {
+	// a drives b, and b holds a back: with a's own positive input the loop
+	// settles on a positive a and b.
+	board := models.Board{
+		CausalNodes: []models.CausalNode{{ID: "in", Status: "positive"}, {ID: "a"}, {ID: "b"}},
+		CausalLinks: []models.CausalLink{
+			{ID: "l1", From: "in", To: "a", Polarity: "positive", Weight: 2},
+			{ID: "l2", From: "a", To: "b", Polarity: "positive", Weight: 1},
+			{ID: "l3", From: "b", To: "a", Polarity: "negative", Weight: 1},
+		},
+	}
+
+	result := Propagate(board)
+	if len(result.UnsettledLoops) != 0 {
+		t.Fatalf("expected the loop to settle, got %+v", result.UnsettledLoops)
+	}
+	a, b := findNode(result.CausalNodes, "a"), findNode(result.CausalNodes, "b")
+	// b passes its positive status on at full strength, so a = (2 - 1) / 3
+	// and b follows a's positive status.
+	if a.Status != "positive" || b.Status != "positive" || almostDiff(a.Confidence, 1.0/3) || almostDiff(b.Confidence, 1) {
+		t.Fatalf("expected a positive at 0.33 and b at 1, got %s %.4f and %s %.4f", a.Status, a.Confidence, b.Status, b.Confidence)
+	}
+	if len(a.Evidence) != 2 || a.Evidence[1].Status != "positive" {
+		t.Fatalf("expected a's evidence to show b's settled status, got %+v", a.Evidence)
+	}
+}
+
+func TestPropagateReportsLoopsThatDoNotSettle(t *testing.T) {
+	// A long ring passes a pulse around far slower than MaxIterations allows.
+	board := models.Board{CausalNodes: []models.CausalNode{{ID: "n0", Status: "positive"}}}
+	for i := 1; i < 60; i++ {
+		board.CausalNodes = append(board.CausalNodes, models.CausalNode{ID: fmt.Sprintf("n%d", i)})
+	}
+	for i := range board.CausalNodes {
+		board.CausalLinks = append(board.CausalLinks, models.CausalLink{
+			ID:     fmt.Sprintf("l%d", i),
+			From:   board.CausalNodes[i].ID,
+			To:     board.CausalNodes[(i+1)%len(board.CausalNodes)].ID,
+			Weight: 1,
+		})
+	}
+
+	result := Propagate(board)
+	if len(result.UnsettledLoops) != 1 {
+		t.Fatalf("expected one unsettled loop, got %+v", result.UnsettledLoops)
+	}
+	loop := result.UnsettledLoops[0]
+	if len(loop.Nodes) != 60 || loop.Nodes[0] != "n0" || loop.Iterations != MaxIterations || loop.Residual < tolerance {
+		t.Fatalf("unexpected loop report: %d nodes starting %s, %d iterations, residual %g", len(loop.Nodes), loop.Nodes[0], loop.Iterations, loop.Residual)
+	}
+	if again := Propagate(models.Board{CausalNodes: result.CausalNodes[:1]}); again.UnsettledLoops != nil {
+		t.Fatalf("expected the report to be cleared once the loop is gone")
+	}
+}
+
+func TestPropagateHonoursJunctionOperators(t *testing.T) {
+	cases := []struct {
+		operator string
+		status   string
+		conf     float64
+		dominant []string
+	}{
+		{OpAverage, "neutral", 0.2, []string{"up", "half"}},
+		{OpAnd, "negative", 1, []string{"down"}},
+		{"MAX", "positive", 1, []string{"up"}},
+		{OpSum, "positive", 0.5, []string{"up", "half"}},
+		{OpProduct, "negative", 0.5, []string{"half"}},
+		{OpNot, "neutral", 0.2, []string{"up", "half"}},
+		{OpFuzzyAnd, "negative", 1, []string{"down"}},
+		{OpFuzzyOr, "positive", 1, []string{"up"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.operator, func(t *testing.T) {
+			board := models.Board{
+				CausalNodes: []models.CausalNode{
+					{ID: "up", Status: "positive"},
+					{ID: "down", Status: "negative"},
+					{ID: "half", Status: "positive"},
+					{ID: "out", Operator: tc.operator},
+				},
+				CausalLinks: []models.CausalLink{
+					{ID: "l1", From: "up", To: "out", Weight: 1},
+					{ID: "l2", From: "down", To: "out", Weight: 1},
+					{ID: "l3", From: "half", To: "out", Weight: 0.5},
+				},
+			}
+			out := findNode(Propagate(board).CausalNodes, "out")
+			if out.Status != tc.status || almostDiff(out.Confidence, tc.conf) {
+				t.Fatalf("expected %s at %.2f, got %s at %.4f", tc.status, tc.conf, out.Status, out.Confidence)
+			}
+			var dominant []string
+			for _, ev := range out.Evidence {
+				if ev.Dominant {
+					dominant = append(dominant, ev.SourceID)
+				}
+			}
+			if fmt.Sprint(dominant) != fmt.Sprint(tc.dominant) {
+				t.Fatalf("expected %v to dominate, got %v", tc.dominant, dominant)
+			}
+		})
+	}
+}
+
+func TestPropagateWeighsConfidencePerBoard(t *testing.T) {
+	// A doubtful cause down a chain with weaker links, two weak causes that
+	// agree, and a strong cause against a doubtful objection.
+	board := models.Board{
+		CausalNodes: []models.CausalNode{
+			{ID: "a", Status: "positive", Confidence: 0.6}, {ID: "b"}, {ID: "c"},
+			{ID: "weak1", Status: "positive", Confidence: 0.5}, {ID: "weak2", Status: "positive", Confidence: 0.5}, {ID: "agreed"},
+			{ID: "strong", Status: "positive", Confidence: 0.9}, {ID: "doubt", Status: "negative", Confidence: 0.3}, {ID: "disputed"},
+		},
+		CausalLinks: []models.CausalLink{
+			{ID: "l1", From: "a", To: "b", Weight: 0.5},
+			{ID: "l2", From: "b", To: "c", Weight: 0.5},
+			{ID: "l3", From: "weak1", To: "agreed", Weight: 1},
+			{ID: "l4", From: "weak2", To: "agreed", Weight: 1},
+			{ID: "l5", From: "strong", To: "disputed", Weight: 1},
+			{ID: "l6", From: "doubt", To: "disputed", Weight: 1},
+		},
+	}
+	type outcome struct {
+		status string
+		conf   float64
+	}
+	cases := []struct {
+		mode string
+		want map[string]outcome
+	}{
+		{"", map[string]outcome{
+			"c":        {"positive", 1},
+			"agreed":   {"positive", 1},
+			"disputed": {"neutral", 0},
+		}},
+		{ModeConfidence, map[string]outcome{
+			"b":        {"positive", 0.6},
+			"c":        {"positive", 0.6},
+			"agreed":   {"positive", 0.5},
+			"disputed": {"positive", 0.3},
+		}},
+		{ModeNoisyOr, map[string]outcome{
+			"b":        {"positive", 0.3},
+			"c":        {"neutral", 0.15},
+			"agreed":   {"positive", 0.75},
+			"disputed": {"positive", 0.6 / 0.7},
+		}},
+	}
+	for _, tc := range cases {
+		t.Run("mode="+tc.mode, func(t *testing.T) {
+			board := board.Clone()
+			board.Propagation = tc.mode
+			result := Propagate(board)
+			for id, want := range tc.want {
+				got := findNode(result.CausalNodes, id)
+				if got.Status != want.status || almostDiff(got.Confidence, want.conf) {
+					t.Errorf("%s: expected %s at %.4f, got %s at %.4f", id, want.status, want.conf, got.Status, got.Confidence)
+				}
+			}
+		})
+	}
+}
+
+func TestWhatIfPinsOverriddenNodesAndListsDownstreamChanges(t *testing.T) {
+	board := Propagate(models.Board{
+		CausalNodes: []models.CausalNode{
+			{ID: "supplier", Status: "positive"},
+			{ID: "risk", Label: "Delivery risk"},
+			{ID: "cost"},
+			{ID: "demand", Status: "positive"},
+			{ID: "sales"},
+		},
+		CausalLinks: []models.CausalLink{
+			{ID: "l1", From: "supplier", To: "risk", Polarity: "negative", Weight: 1},
+			{ID: "l2", From: "risk", To: "cost", Polarity: "negative", Weight: 1},
+			{ID: "l3", From: "demand", To: "sales", Weight: 1},
+		},
+	})
+	if got := findNode(board.CausalNodes, "cost").Status; got != "positive" {
+		t.Fatalf("expected a positive baseline cost, got %q", got)
+	}
+
+	weight := 1.0
+	scenario := models.Scenario{
+		ID:    "s1",
+		Name:  "Supplier fails",
+		Nodes: []models.NodeOverride{{NodeID: "risk", Status: "positive"}, {NodeID: "gone", Status: "negative"}},
+		Links: []models.LinkOverride{{LinkID: "l3", Polarity: "negative", Weight: &weight}},
+	}
+	outcome := WhatIf(board, scenario)
+
+	var changed []string
+	for _, c := range outcome.Changes {
+		changed = append(changed, fmt.Sprintf("%s:%s->%s:%v", c.NodeID, c.Baseline, c.Status, c.Overridden))
+	}
+	want := "[risk:negative->positive:true cost:positive->negative:false sales:positive->negative:false]"
+	if fmt.Sprint(changed) != want {
+		t.Fatalf("expected changes %s, got %v", want, changed)
+	}
+	if fmt.Sprint(outcome.Ignored) != "[gone]" {
+		t.Fatalf("expected the missing node to be ignored, got %v", outcome.Ignored)
+	}
+	if got := findNode(board.CausalNodes, "risk").Status; got != "negative" {
+		t.Fatalf("expected the board to be left alone, got risk %q", got)
+	}
+}
+
+func TestDriversRanksAncestorsByInfluence(t *testing.T) {
+	board := models.Board{
+		CausalNodes: []models.CausalNode{
+			{ID: "goal"}, {ID: "a"}, {ID: "b", Status: "positive"}, {ID: "d", Status: "negative"}, {ID: "unrelated", Status: "positive"},
+		},
+		CausalLinks: []models.CausalLink{
+			{ID: "l1", From: "a", To: "goal", Weight: 1},
+			{ID: "l2", From: "b", To: "goal", Weight: 0.5},
+			{ID: "l3", From: "d", To: "a", Polarity: "negative", Weight: 1},
+		},
+	}
+
+	analysis, ok := Drivers(Propagate(board), "goal", 2)
+	if !ok {
+		t.Fatalf("expected the goal to be found")
+	}
+	if analysis.Status != "positive" || almostDiff(analysis.Score, 1) {
+		t.Fatalf("expected a positive goal at 1, got %s at %.4f", analysis.Status, analysis.Score)
+	}
+	var drivers []string
+	for _, d := range analysis.Drivers {
+		drivers = append(drivers, fmt.Sprintf("%s:%.3f@%d", d.NodeID, d.Influence, d.Distance))
+	}
+	if want := "[a:0.667@1 d:-0.667@2 b:0.333@1]"; fmt.Sprint(drivers) != want {
+		t.Fatalf("expected drivers %s, got %v", want, drivers)
+	}
+	var paths []string
+	for _, p := range analysis.Paths {
+		paths = append(paths, fmt.Sprintf("%v%v:%g", p.Nodes, p.Links, p.Strength))
+	}
+	if want := "[[a goal][l1]:1 [d a goal][l3 l1]:-1]"; fmt.Sprint(paths) != want {
+		t.Fatalf("expected paths %s, got %v", want, paths)
+	}
+	if _, ok := Drivers(board, "missing", 2); ok {
+		t.Fatalf("expected a missing target to be reported")
+	}
+}
+
+func TestSimulateShowsLoopBehaviour(t *testing.T) {
+	board := models.Board{
+		CausalNodes: []models.CausalNode{
+			{ID: "population", Value: 1},
+			{ID: "goal", Value: 10}, {ID: "gap"}, {ID: "level"},
+			{ID: "prey", Value: 1}, {ID: "predators"},
+			{ID: "one", Value: 1}, {ID: "clock"}, {ID: "late"},
+		},
+		CausalLinks: []models.CausalLink{
+			{ID: "births", From: "population", To: "population", Rate: 0.1},
+			{ID: "target", From: "goal", To: "gap", Weight: 1},
+			{ID: "progress", From: "level", To: "gap", Polarity: "negative", Weight: 1},
+			{ID: "closing", From: "gap", To: "level", Rate: 0.2},
+			{ID: "feeding", From: "prey", To: "predators", Rate: 0.3},
+			{ID: "eaten", From: "predators", To: "prey", Rate: 0.3, Polarity: "negative"},
+			{ID: "tick", From: "one", To: "clock", Rate: 1},
+			{ID: "lag", From: "clock", To: "late", Delay: 2},
+		},
+	}
+
+	sim := Simulate(board, 40)
+	behaviours := map[string]string{}
+	for _, s := range sim.Series {
+		if len(s.Values) != 41 {
+			t.Fatalf("expected 41 values for %s, got %d", s.NodeID, len(s.Values))
+		}
+		behaviours[s.NodeID] = s.Behaviour
+	}
+	want := map[string]string{
+		"population": BehaviourGrowth, "goal": BehaviourSteady, "level": BehaviourSaturation,
+		"prey": BehaviourOscillation, "predators": BehaviourOscillation, "clock": BehaviourGrowth,
+	}
+	for id, b := range want {
+		if behaviours[id] != b {
+			t.Fatalf("expected %s to show %s, got %s", id, b, behaviours[id])
+		}
+	}
+	level := sim.Series[3].Values
+	if almostDiff(math.Round(level[40]), 10) {
+		t.Fatalf("expected the level to approach its goal of 10, got %.4f", level[40])
+	}
+	if late := sim.Series[8].Values[:6]; fmt.Sprint(late) != "[0 0 0 1 2 3]" {
+		t.Fatalf("expected the delayed link to lag two ticks, got %v", late)
+	}
+}
+
+func TestSimulateActsWithinTheTickWithoutDelay(t *testing.T) {
+	// echo is listed before the clock it follows; loop and back link to each
+	// other, so back reads loop from the tick before and loop follows back
+	// within the tick.
+	board := models.Board{
+		CausalNodes: []models.CausalNode{
+			{ID: "echo"}, {ID: "one", Value: 1}, {ID: "clock"},
+			{ID: "loop", Value: 1}, {ID: "back"},
+		},
+		CausalLinks: []models.CausalLink{
+			{ID: "l1", From: "clock", To: "echo"},
+			{ID: "l2", From: "one", To: "clock", Rate: 1},
+			{ID: "l3", From: "loop", To: "back", Weight: 2},
+			{ID: "l4", From: "back", To: "loop"},
+		},
+	}
+
+	sim := Simulate(board, 4)
+	if echo := sim.Series[0].Values; fmt.Sprint(echo) != "[0 1 2 3 4]" {
+		t.Fatalf("expected echo to follow the clock in the same tick, got %v", echo)
+	}
+	if loop := sim.Series[3].Values; fmt.Sprint(loop) != "[1 2 4 8 16]" {
+		t.Fatalf("expected the loop to lag one tick where it closes, got %v", loop)
+	}
+}
+
+func TestSimulateDrainsThroughNegativeRates(t *testing.T) {
+	board := models.Board{
+		CausalNodes: []models.CausalNode{{ID: "tank", Value: 10}},
+		CausalLinks: []models.CausalLink{{ID: "leak", From: "tank", To: "tank", Rate: -0.1}},
+	}
+
+	tank := Simulate(board, 20).Series[0]
+	if almostDiff(tank.Values[1], 9) || almostDiff(tank.Values[20], 10*math.Pow(0.9, 20)) {
+		t.Fatalf("expected the tank to lose a tenth each tick, got %v", tank.Values)
+	}
+	if tank.Behaviour != BehaviourSaturation {
+		t.Fatalf("expected the drain to level off, got %s", tank.Behaviour)
+	}
+}
+
+func TestAnalyzeSpreadsGuessesOverRuns(t *testing.T) {
+	board := models.Board{
+		CausalNodes: []models.CausalNode{
+			{ID: "demand", Probabilities: &models.StatusProbabilities{Positive: 7, Negative: 3}},
+			{ID: "sales"},
+			{ID: "morale", Status: "positive"},
+			{ID: "output", Operator: OpSum},
+		},
+		CausalLinks: []models.CausalLink{
+			{ID: "l1", From: "demand", To: "sales", Weight: 1},
+			{ID: "l2", From: "morale", To: "output", Distribution: &models.WeightDistribution{Min: 0.2, Mode: 0.5, Max: 0.8}},
+		},
+	}
+
+	analysis := Analyze(board, 4000, 0.9, 42)
+	sales := analysis.Nodes[1]
+	if p := sales.Probabilities; math.Abs(p.Positive-0.7) > 0.03 || math.Abs(p.Negative-0.3) > 0.03 || p.Neutral != 0 {
+		t.Fatalf("expected sales to follow demand 70/30, got %+v", p)
+	}
+	output := analysis.Nodes[3]
+	if math.Abs(output.Mean-0.5) > 0.02 || output.Low <= 0.2 || output.Low >= 0.4 || output.High <= 0.6 || output.High >= 0.8 {
+		t.Fatalf("expected output around 0.5 within the weight's range, got %.3f in [%.3f, %.3f]", output.Mean, output.Low, output.High)
+	}
+	if again := Analyze(board, 4000, 0.9, 42); fmt.Sprint(again) != fmt.Sprint(analysis) {
+		t.Fatalf("expected the same seed to give the same analysis")
+	}
+}
+
+func TestAnalyzeKeepsDrawsOfNoEffectWeightless(t *testing.T) {
+	board := models.Board{
+		CausalNodes: []models.CausalNode{
+			{ID: "for", Status: "positive"}, {ID: "against", Status: "negative"}, {ID: "out"},
+		},
+		CausalLinks: []models.CausalLink{
+			{ID: "l1", From: "for", To: "out", Weight: 1},
+			{ID: "l2", From: "against", To: "out", Distribution: &models.WeightDistribution{Min: 0, Mode: 0, Max: 0}},
+		},
+	}
+
+	out := Analyze(board, 100, 0.9, 1).Nodes[2]
+	if almostDiff(out.Mean, 1) || out.Probabilities.Positive != 1 {
+		t.Fatalf("expected a zero draw to leave out positive, got %.4f with %+v", out.Mean, out.Probabilities)
+	}
+}
+
 func findNode(nodes []models.CausalNode, id string) models.CausalNode {
 	for _, n := range nodes {
 		if n.ID == id {
@@ -0,0 +1,97 @@
+package status
+
+import "test1/models"
+
+// Outcome is a board's causal model propagated under a scenario.
+type Outcome struct {
+	Scenario       models.Scenario       `json:"scenario"`
+	Nodes          []models.CausalNode   `json:"nodes"`
+	UnsettledLoops []models.FeedbackLoop `json:"unsettledLoops,omitempty"`
+	// Changes lists the nodes whose status or confidence differs from the
+	// baseline, in board order.
+	Changes []StatusChange `json:"changes"`
+	// Ignored lists the node and link IDs the scenario overrides that are no
+	// longer on the board.
+	Ignored []string `json:"ignored,omitempty"`
+}
+
+// StatusChange compares a node under a scenario with the baseline.
+type StatusChange struct {
+	NodeID             string  `json:"nodeId"`
+	Label              string  `json:"label,omitempty"`
+	Baseline           string  `json:"baseline"`
+	BaselineConfidence float64 `json:"baselineConfidence"`
+	Status             string  `json:"status"`
+	Confidence         float64 `json:"confidence"`
+	// Overridden is set for the nodes the scenario pins; the others changed
+	// because of them.
+	Overridden bool `json:"overridden,omitempty"`
+}
+
+// WhatIf propagates the board with the scenario's overrides applied and
+// compares the result with the board propagated as it is. The board is not
+// changed.
+func WhatIf(board models.Board, scenario models.Scenario) Outcome {
+	baseline := Propagate(board.Clone())
+	changed := board.Clone()
+	outcome := Outcome{Scenario: scenario, Changes: []StatusChange{}}
+
+	links := make(map[string]*models.CausalLink, len(changed.CausalLinks))
+	for i := range changed.CausalLinks {
+		links[changed.CausalLinks[i].ID] = &changed.CausalLinks[i]
+	}
+	for _, o := range scenario.Links {
+		link := links[o.LinkID]
+		if link == nil {
+			outcome.Ignored = append(outcome.Ignored, o.LinkID)
+			continue
+		}
+		if o.Weight != nil {
+			link.Weight = *o.Weight
+		}
+		if o.Polarity != "" {
+			link.Polarity = o.Polarity
+		}
+	}
+
+	nodes := make(map[string]*models.CausalNode, len(changed.CausalNodes))
+	for i := range changed.CausalNodes {
+		nodes[changed.CausalNodes[i].ID] = &changed.CausalNodes[i]
+	}
+	pinned := make(map[string]bool, len(scenario.Nodes))
+	for _, o := range scenario.Nodes {
+		node := nodes[o.NodeID]
+		if node == nil {
+			outcome.Ignored = append(outcome.Ignored, o.NodeID)
+			continue
+		}
+		pinned[o.NodeID] = true
+		if o.Status != "" {
+			node.Status = o.Status
+		}
+		if o.Confidence != nil {
+			node.Confidence = clamp(*o.Confidence, 0, 1)
+		}
+		node.Evidence = nil
+	}
+
+	changed, _ = propagate(changed, pinned)
+	outcome.Nodes = changed.CausalNodes
+	outcome.UnsettledLoops = changed.UnsettledLoops
+	for i, node := range changed.CausalNodes {
+		before := baseline.CausalNodes[i]
+		if node.Status == before.Status && !almostDiff(node.Confidence, before.Confidence) {
+			continue
+		}
+		outcome.Changes = append(outcome.Changes, StatusChange{
+			NodeID:             node.ID,
+			Label:              node.Label,
+			Baseline:           before.Status,
+			BaselineConfidence: before.Confidence,
+			Status:             node.Status,
+			Confidence:         node.Confidence,
+			Overridden:         pinned[node.ID],
+		})
+	}
+	return outcome
+}
@@ -0,0 +1,169 @@
+package status
+
+import (
+	"math"
+
+	"test1/models"
+)
+
+// Simulation limits. Values are held within ±valueLimit so runaway growth
+// stays finite and can still be encoded.
+const (
+	DefaultTicks = 50
+	MaxTicks     = 10000
+	valueLimit   = 1e12
+)
+
+// Behaviours a simulated series is classified as.
+const (
+	BehaviourSteady      = "steady"
+	BehaviourGrowth      = "growth"
+	BehaviourDecline     = "decline"
+	BehaviourSaturation  = "saturation"
+	BehaviourOscillation = "oscillation"
+)
+
+// Simulation is the time series of every causal node over a run.
+type Simulation struct {
+	Ticks  int      `json:"ticks"`
+	Series []Series `json:"series"`
+}
+
+// Series is one node's values over a simulation.
+type Series struct {
+	NodeID string `json:"nodeId"`
+	Label  string `json:"label,omitempty"`
+	// Values run from the node's starting value at tick 0 to tick Ticks.
+	Values    []float64 `json:"values"`
+	Behaviour string    `json:"behaviour"`
+}
+
+// Simulate steps the board's causal nodes through ticks time steps, starting
+// each from its Value. A link reads its source times its signed weight. Links
+// with a Rate are flows: each tick the target adds Rate times the reading of
+// the source as it was at the start of the tick, Delay ticks further back, so
+// it accumulates like a stock, or drains when the rate is negative. Links
+// without one set the target's value to the sum of their readings of the
+// source Delay ticks before the tick being computed; with no delay they act
+// within the same tick, except that in a loop of such links one reads the
+// value from the tick before. Nodes nothing links into keep their value.
+func Simulate(board models.Board, ticks int) Simulation {
+	g := newGraph(&board, nil)
+	values := make(map[string][]float64, len(g.ids))
+	for _, id := range g.ids {
+		values[id] = make([]float64, 1, ticks+1)
+		values[id][0] = bounded(g.nodes[id].Value)
+	}
+	// at is a node's value at a tick: the starting value before the run, and
+	// the last value computed for a tick not computed yet.
+	at := func(id string, tick int) float64 {
+		series := values[id]
+		return series[max(min(tick, len(series)-1), 0)]
+	}
+
+	order := g.simulationOrder()
+	for t := 0; t < ticks; t++ {
+		for _, id := range order {
+			next := values[id][t]
+			var set, flow float64
+			sets := false
+			for _, link := range g.incoming[id] {
+				if g.nodes[link.From] == nil {
+					continue
+				}
+				delay := max(link.Delay, 0)
+				if link.Rate != 0 {
+					flow += link.Rate * at(link.From, t-delay) * linkWeight(link)
+				} else {
+					set += at(link.From, t+1-delay) * linkWeight(link)
+					sets = true
+				}
+			}
+			if sets {
+				next = set
+			}
+			values[id] = append(values[id], bounded(next+flow))
+		}
+	}
+
+	sim := Simulation{Ticks: ticks, Series: make([]Series, 0, len(g.ids))}
+	for _, id := range g.ids {
+		sim.Series = append(sim.Series, Series{
+			NodeID:    id,
+			Label:     g.nodes[id].Label,
+			Values:    values[id],
+			Behaviour: behaviour(values[id]),
+		})
+	}
+	return sim
+}
+
+// simulationOrder lists the nodes so that each comes after the sources of
+// its links that act within a tick, those without rate or delay. A loop of
+// such links is cut where the walk comes back round to a node in it.
+func (g *graph) simulationOrder() []string {
+	order := make([]string, 0, len(g.ids))
+	seen := make(map[string]bool, len(g.ids))
+	var visit func(id string)
+	visit = func(id string) {
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		for _, link := range g.incoming[id] {
+			if link.Rate == 0 && link.Delay <= 0 && g.nodes[link.From] != nil {
+				visit(link.From)
+			}
+		}
+		order = append(order, id)
+	}
+	for _, id := range g.ids {
+		visit(id)
+	}
+	return order
+}
+
+// bounded holds a value within ±valueLimit.
+func bounded(v float64) float64 {
+	if math.IsNaN(v) {
+		return 0
+	}
+	return clamp(v, -valueLimit, valueLimit)
+}
+
+// behaviour classifies a series by its shape: steady when it barely moves,
+// oscillation when it changes direction more than once, saturation when it
+// heads one way with shrinking steps, and growth or decline when it heads one
+// way without slowing down.
+func behaviour(values []float64) string {
+	lo, hi := minOf(values), maxOf(values)
+	flat := 1e-9 * math.Max(1, math.Max(math.Abs(lo), math.Abs(hi)))
+	if hi-lo <= flat {
+		return BehaviourSteady
+	}
+
+	reversals, direction := 0, 0.0
+	largest := 0.0
+	for i := 1; i < len(values); i++ {
+		step := values[i] - values[i-1]
+		if math.Abs(step) <= flat {
+			continue
+		}
+		if direction != 0 && step*direction < 0 {
+			reversals++
+		}
+		direction = step
+		largest = math.Max(largest, math.Abs(step))
+	}
+	last := math.Abs(values[len(values)-1] - values[len(values)-2])
+	switch {
+	case reversals > 1:
+		return BehaviourOscillation
+	case last < largest/2:
+		return BehaviourSaturation
+	case values[len(values)-1] > values[0]:
+		return BehaviourGrowth
+	default:
+		return BehaviourDecline
+	}
+}
@@ -0,0 +1,211 @@
+package status
+
+import (
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"sort"
+	"sync"
+
+	"test1/models"
+)
+
+// Uncertainty analysis limits.
+const (
+	DefaultRuns  = 2000
+	MaxRuns      = 10000
+	DefaultLevel = 0.9
+)
+
+// Uncertainty is the spread of outcomes over many propagations of a board
+// whose guessed statuses and weights were drawn at random each time.
+type Uncertainty struct {
+	Runs int `json:"runs"`
+	// Seed reproduces the analysis when passed in again.
+	Seed uint64 `json:"seed"`
+	// Level is the share of runs each node's interval covers.
+	Level float64           `json:"level"`
+	Nodes []NodeUncertainty `json:"nodes"`
+}
+
+// NodeUncertainty is how a node came out over the runs of an analysis.
+type NodeUncertainty struct {
+	NodeID string `json:"nodeId"`
+	Label  string `json:"label,omitempty"`
+	// Probabilities are the shares of runs the node ended up in each status.
+	Probabilities models.StatusProbabilities `json:"probabilities"`
+	// Mean is the node's average score, from -1 to 1; Low and High bound the
+	// middle Level of its scores.
+	Mean float64 `json:"mean"`
+	Low  float64 `json:"low"`
+	High float64 `json:"high"`
+}
+
+// Analyze propagates runs variations of the board, spread over as many
+// goroutines as can run at once. Each run draws the status of nodes with
+// Probabilities and the weight of links with a Distribution; everything else
+// is as on the board. Every run has its own random source derived from seed,
+// so the same seed gives the same result however the runs are scheduled.
+func Analyze(board models.Board, runs int, level float64, seed uint64) Uncertainty {
+	g := newGraph(&board, nil)
+	index := make(map[string]int, len(g.ids))
+	for i, id := range g.ids {
+		index[id] = i
+	}
+	scores := make([][]float64, len(g.ids))
+	for i := range scores {
+		scores[i] = make([]float64, runs)
+	}
+	counts := make([][3]int, len(g.ids))
+
+	workers := max(min(runtime.GOMAXPROCS(0), runs), 1)
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			local := make([][3]int, len(g.ids))
+			for run := w; run < runs; run += workers {
+				rng := rand.New(rand.NewPCG(seed, uint64(run)))
+				result, signals := propagate(sample(board, rng), nil)
+				seen := make(map[string]bool, len(g.ids))
+				for _, node := range result.CausalNodes {
+					i, ok := index[node.ID]
+					if !ok || seen[node.ID] {
+						continue
+					}
+					seen[node.ID] = true
+					scores[i][run] = signals[node.ID]
+					local[i][statusBucket(node.Status)]++
+				}
+			}
+			mu.Lock()
+			for i := range local {
+				for b := range local[i] {
+					counts[i][b] += local[i][b]
+				}
+			}
+			mu.Unlock()
+		}(w)
+	}
+	wg.Wait()
+
+	analysis := Uncertainty{Runs: runs, Seed: seed, Level: level, Nodes: make([]NodeUncertainty, 0, len(g.ids))}
+	for i, id := range g.ids {
+		result := NodeUncertainty{NodeID: id, Label: g.nodes[id].Label}
+		if runs > 0 {
+			share := func(n int) float64 { return float64(n) / float64(runs) }
+			result.Probabilities = models.StatusProbabilities{
+				Positive: share(counts[i][0]),
+				Neutral:  share(counts[i][1]),
+				Negative: share(counts[i][2]),
+			}
+			sorted := scores[i]
+			sort.Float64s(sorted)
+			sum := 0.0
+			for _, s := range sorted {
+				sum += s
+			}
+			result.Mean = sum / float64(runs)
+			result.Low = quantile(sorted, (1-level)/2)
+			result.High = quantile(sorted, (1+level)/2)
+		}
+		analysis.Nodes = append(analysis.Nodes, result)
+	}
+	return analysis
+}
+
+// sample copies the causal part of board with guessed statuses and weights drawn.
+func sample(board models.Board, rng *rand.Rand) models.Board {
+	trial := causalCopy(board)
+	trial.CausalLinks = append([]models.CausalLink(nil), board.CausalLinks...)
+	for i := range trial.CausalNodes {
+		if odds := trial.CausalNodes[i].Probabilities; odds != nil {
+			if status, ok := drawStatus(*odds, rng); ok {
+				trial.CausalNodes[i].Status = status
+			}
+		}
+	}
+	for i := range trial.CausalLinks {
+		if spread := trial.CausalLinks[i].Distribution; spread != nil {
+			trial.CausalLinks[i].Weight = drawWeight(*spread, rng)
+		}
+	}
+	return trial
+}
+
+// drawStatus picks a status in proportion to its chance; ok is false when
+// there are no positive chances to pick from.
+func drawStatus(odds models.StatusProbabilities, rng *rand.Rand) (string, bool) {
+	positive, neutral, negative := math.Max(odds.Positive, 0), math.Max(odds.Neutral, 0), math.Max(odds.Negative, 0)
+	total := positive + neutral + negative
+	if total == 0 || math.IsNaN(total) || math.IsInf(total, 0) {
+		return "", false
+	}
+	switch u := rng.Float64() * total; {
+	case u < positive:
+		return "positive", true
+	case u < positive+neutral:
+		return "neutral", true
+	default:
+		return "negative", true
+	}
+}
+
+// minWeight is the smallest weight a draw gives. A weight of exactly 0 means
+// the weight is unset, which counts as 1, so a draw of no effect has to stay
+// just clear of it.
+const minWeight = 1e-9
+
+// drawWeight draws a weight from a distribution. Unknown kinds are
+// triangular, and a triangle with its mode outside its range is clamped to it.
+func drawWeight(spread models.WeightDistribution, rng *rand.Rand) float64 {
+	var w float64
+	if spread.Kind == models.DistributionNormal {
+		w = spread.Mean + rng.NormFloat64()*math.Max(spread.StdDev, 0)
+	} else {
+		w = drawTriangular(spread, rng)
+	}
+	if math.Abs(w) < minWeight {
+		return math.Copysign(minWeight, w)
+	}
+	return w
+}
+
+func drawTriangular(spread models.WeightDistribution, rng *rand.Rand) float64 {
+	lo, hi := math.Min(spread.Min, spread.Max), math.Max(spread.Min, spread.Max)
+	if hi == lo {
+		return lo
+	}
+	mode := clamp(spread.Mode, lo, hi)
+	u := rng.Float64()
+	if u < (mode-lo)/(hi-lo) {
+		return lo + math.Sqrt(u*(hi-lo)*(mode-lo))
+	}
+	return hi - math.Sqrt((1-u)*(hi-lo)*(hi-mode))
+}
+
+// statusBucket is the index of a status in the counts: positive, neutral, negative.
+func statusBucket(status string) int {
+	switch deriveStatus(statusValue(status)) {
+	case "positive":
+		return 0
+	case "negative":
+		return 2
+	default:
+		return 1
+	}
+}
+
+// quantile interpolates the value below which a share q of sorted lies.
+func quantile(sorted []float64, q float64) float64 {
+	pos := clamp(q, 0, 1) * float64(len(sorted)-1)
+	i := int(pos)
+	if i+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (pos-float64(i))*(sorted[i+1]-sorted[i])
+}
@@ -0,0 +1,482 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"test1/models"
+)
+
+// ErrNotFound is returned when a board does not exist.
+var ErrNotFound = errors.New("board not found")
+
+const (
+	snapshotFile = "snapshot.json"
+	walFile      = "wal.log"
+
+	walOpPut    = "put"
+	walOpDelete = "delete"
+)
+
+// FileStoreOptions tunes how often the write-ahead log is compacted into a snapshot.
+type FileStoreOptions struct {
+	// SnapshotEvery triggers a snapshot after this many log records. Zero disables the count trigger.
+	SnapshotEvery int
+	// SnapshotInterval triggers a snapshot periodically when the log is not empty. Zero disables the timer.
+	SnapshotInterval time.Duration
+	Logger           *log.Logger
+}
+
+// DefaultFileStoreOptions returns the options used when none are supplied.
+func DefaultFileStoreOptions() FileStoreOptions {
+	return FileStoreOptions{SnapshotEvery: 500, SnapshotInterval: time.Minute}
+}
+
+// walRecord is a single line in the write-ahead log.
+type walRecord struct {
+	Seq   uint64        `json:"seq"`
+	Op    string        `json:"op"`
+	ID    string        `json:"id,omitempty"`
+	Board *models.Board `json:"board,omitempty"`
+}
+
+// snapshot is the compacted on-disk state; records in the log with Seq <= snapshot.Seq are already applied.
+type snapshot struct {
+	Seq    uint64         `json:"seq"`
+	Boards []models.Board `json:"boards"`
+}
+
+// FileStore keeps boards in memory and makes every write durable through an
+// append-only log that is periodically compacted into an atomically replaced snapshot.
+type FileStore struct {
+	mu      sync.RWMutex
+	dir     string
+	opts    FileStoreOptions
+	boards  boardSet
+	wal     *os.File
+	seq     uint64
+	pending int
+	closed  bool
+	// torn is set when a failed append could not be cut back out of the
+	// log; appending after it would bury the torn record, so writes stop.
+	torn error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// OpenFileStore loads the snapshot and replays the log found in dir, creating the directory when needed.
+func OpenFileStore(dir string, opts FileStoreOptions) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+
+	s := &FileStore{
+		dir:    dir,
+		opts:   opts,
+		boards: make(boardSet),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := s.replayLog(); err != nil {
+		return nil, err
+	}
+
+	wal, err := os.OpenFile(filepath.Join(dir, walFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open wal: %w", err)
+	}
+	s.wal = wal
+
+	go s.snapshotLoop()
+	return s, nil
+}
+
+// ListBoards returns copies of all boards.
+func (s *FileStore) ListBoards() []models.Board {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.boards.list()
+}
+
+// CreateBoard adds a new board with a generated ID and persists it before returning.
+func (s *FileStore) CreateBoard(board models.Board) (models.Board, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	board.ID = NewID()
+	board.UpdatedAt = time.Now().UTC()
+	board.Revision = 1
+	if err := s.appendLocked(walRecord{Op: walOpPut, Board: &board}); err != nil {
+		return models.Board{}, err
+	}
+	s.boards[board.ID] = board.Clone()
+	return board.Clone(), nil
+}
+
+// GetBoard returns a board by ID.
+func (s *FileStore) GetBoard(id string) (models.Board, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.boards.get(id)
+}
+
+// HasBoard reports whether a board exists without copying it.
+func (s *FileStore) HasBoard(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.boards[id]
+	return ok
+}
+
+// Lifecycle returns whether a board is archived or in the trash without copying it.
+func (s *FileStore) Lifecycle(id string) (models.Lifecycle, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	board, ok := s.boards[id]
+	return board.Lifecycle, ok
+}
+
+// UpdateBoard replaces the stored board when it exists. A non-zero expected
+// revision must match the stored one or a *ConflictError is returned.
+func (s *FileStore) UpdateBoard(board models.Board, expected int64) (models.Board, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.boards[board.ID]
+	if !ok {
+		return models.Board{}, ErrNotFound
+	}
+	if err := checkRevision(current, expected); err != nil {
+		return models.Board{}, err
+	}
+	board.UpdatedAt = time.Now().UTC()
+	board.Revision = current.Revision + 1
+	if err := s.appendLocked(walRecord{Op: walOpPut, Board: &board}); err != nil {
+		return models.Board{}, err
+	}
+	s.boards[board.ID] = board.Clone()
+	return board.Clone(), nil
+}
+
+// MutateBoard applies fn to a copy of the stored board and persists the result
+// unless fn returns an error. The read, change and write happen atomically.
+func (s *FileStore) MutateBoard(id string, fn func(board *models.Board) error) (models.Board, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	board, ok := s.boards.get(id)
+	if !ok {
+		return models.Board{}, ErrNotFound
+	}
+	revision := board.Revision
+	if err := fn(&board); err != nil {
+		return models.Board{}, err
+	}
+	board.ID = id
+	board.UpdatedAt = time.Now().UTC()
+	board.Revision = revision + 1
+	if err := s.appendLocked(walRecord{Op: walOpPut, Board: &board}); err != nil {
+		return models.Board{}, err
+	}
+	s.boards[id] = board.Clone()
+	return board, nil
+}
+
+// DeleteBoard removes a board by ID, subject to the same revision check as UpdateBoard.
+func (s *FileStore) DeleteBoard(id string, expected int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.boards[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := checkRevision(current, expected); err != nil {
+		return err
+	}
+	if err := s.appendLocked(walRecord{Op: walOpDelete, ID: id}); err != nil {
+		return err
+	}
+	delete(s.boards, id)
+	return nil
+}
+
+// PutBoard stores a board under its existing ID, replacing any board with the same ID.
+func (s *FileStore) PutBoard(board models.Board) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.appendLocked(walRecord{Op: walOpPut, Board: &board}); err != nil {
+		return err
+	}
+	s.boards[board.ID] = board.Clone()
+	return nil
+}
+
+// Snapshot compacts the log into a new snapshot immediately.
+func (s *FileStore) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshotLocked()
+}
+
+// Close writes a final snapshot and releases the log file.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	close(s.stop)
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapErr := s.snapshotLocked()
+	if err := s.wal.Close(); err != nil && snapErr == nil {
+		return fmt.Errorf("close wal: %w", err)
+	}
+	return snapErr
+}
+
+func (s *FileStore) appendLocked(rec walRecord) error {
+	if s.closed {
+		return errors.New("store closed")
+	}
+	if s.torn != nil {
+		return s.torn
+	}
+
+	rec.Seq = s.seq + 1
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encode wal record: %w", err)
+	}
+	line = append(line, '\n')
+
+	info, err := s.wal.Stat()
+	if err != nil {
+		return fmt.Errorf("stat wal: %w", err)
+	}
+	if _, err := s.wal.Write(line); err != nil {
+		return s.rewindLocked(info.Size(), fmt.Errorf("write wal: %w", err))
+	}
+	if err := s.wal.Sync(); err != nil {
+		return s.rewindLocked(info.Size(), fmt.Errorf("sync wal: %w", err))
+	}
+
+	s.seq = rec.Seq
+	s.pending++
+	if s.opts.SnapshotEvery > 0 && s.pending >= s.opts.SnapshotEvery {
+		if err := s.snapshotLocked(); err != nil && s.opts.Logger != nil {
+			// The record is already durable in the log, so a failed compaction is not fatal.
+			s.opts.Logger.Printf("snapshot failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// rewindLocked cuts the log back to size after a failed append, so a partly
+// written record cannot end up in the middle of the log once later records
+// follow it. If that fails too, the store takes no more writes.
+func (s *FileStore) rewindLocked(size int64, cause error) error {
+	if err := s.wal.Truncate(size); err != nil {
+		s.torn = fmt.Errorf("%w (truncate wal: %v)", cause, err)
+		return s.torn
+	}
+	return cause
+}
+
+func (s *FileStore) snapshotLocked() error {
+	if s.pending == 0 {
+		return nil
+	}
+
+	snap := snapshot{Seq: s.seq, Boards: make([]models.Board, 0, len(s.boards))}
+	for _, b := range s.boards {
+		snap.Boards = append(snap.Boards, b)
+	}
+	encoded, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+	if err := WriteFileAtomic(filepath.Join(s.dir, snapshotFile), encoded, 0o644); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+
+	// The snapshot now covers every record, so the log can be replaced with an empty one.
+	// A crash before this point is harmless: replay skips records already in the snapshot.
+	if err := WriteFileAtomic(filepath.Join(s.dir, walFile), nil, 0o644); err != nil {
+		return fmt.Errorf("reset wal: %w", err)
+	}
+	wal, err := os.OpenFile(filepath.Join(s.dir, walFile), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("reopen wal: %w", err)
+	}
+	if s.wal != nil {
+		s.wal.Close()
+	}
+	s.wal = wal
+	s.pending = 0
+	s.torn = nil
+	return nil
+}
+
+func (s *FileStore) snapshotLoop() {
+	defer close(s.done)
+	if s.opts.SnapshotInterval <= 0 {
+		<-s.stop
+		return
+	}
+
+	ticker := time.NewTicker(s.opts.SnapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.Snapshot(); err != nil && s.opts.Logger != nil {
+				s.opts.Logger.Printf("periodic snapshot failed: %v", err)
+			}
+		}
+	}
+}
+
+func (s *FileStore) loadSnapshot() error {
+	content, err := os.ReadFile(filepath.Join(s.dir, snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(content, &snap); err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+	for _, b := range snap.Boards {
+		s.boards[b.ID] = b
+	}
+	s.seq = snap.Seq
+	return nil
+}
+
+// replayLog applies log records newer than the snapshot. A torn final record left by
+// a crash mid-write is truncated away; corruption anywhere else is reported.
+func (s *FileStore) replayLog() error {
+	path := filepath.Join(s.dir, walFile)
+	file, err := os.OpenFile(path, os.O_RDWR, 0o644)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open wal: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var rec walRecord
+			complete := bytes.HasSuffix(line, []byte("\n"))
+			if decodeErr := json.Unmarshal(line, &rec); decodeErr != nil || !complete {
+				if _, peekErr := reader.Peek(1); peekErr == io.EOF {
+					if s.opts.Logger != nil {
+						s.opts.Logger.Printf("truncating torn wal record at offset %d", offset)
+					}
+					if err := file.Truncate(offset); err != nil {
+						return fmt.Errorf("truncate wal: %w", err)
+					}
+					return nil
+				}
+				return fmt.Errorf("corrupt wal record at offset %d", offset)
+			}
+			offset += int64(len(line))
+			s.applyRecord(rec)
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return fmt.Errorf("read wal: %w", readErr)
+		}
+	}
+}
+
+func (s *FileStore) applyRecord(rec walRecord) {
+	if rec.Seq <= s.seq {
+		return
+	}
+	switch rec.Op {
+	case walOpPut:
+		if rec.Board != nil {
+			s.boards[rec.Board.ID] = *rec.Board
+		}
+	case walOpDelete:
+		delete(s.boards, rec.ID)
+	}
+	s.seq = rec.Seq
+	s.pending++
+}
+
+// WriteFileAtomic writes data to a temporary file in the same directory, syncs it
+// and renames it over path so readers never observe a partially written file.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"test1/models"
+)
+
+func TestFileStoreReplaysLogAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	opts := FileStoreOptions{}
+
+	store, err := OpenFileStore(dir, opts)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	created, err := store.CreateBoard(models.Board{
+		Name:        "Plan",
+		CausalNodes: []models.CausalNode{{ID: "a", Label: "Input"}},
+		Comments:    []models.Comment{{ID: "c1", Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	created.Name = "Renamed"
+	if _, err := store.UpdateBoard(created, created.Revision); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	var conflict *ConflictError
+	if _, err := store.UpdateBoard(created, created.Revision); !errors.As(err, &conflict) || conflict.Current != 2 {
+		t.Fatalf("expected stale update to conflict at revision 2, got %v", err)
+	}
+	doomed, _ := store.CreateBoard(models.Board{Name: "Doomed"})
+	if err := store.DeleteBoard(doomed.ID, 0); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	// Simulate a crash: the log is never compacted or closed.
+	store.wal.Close()
+
+	reopened, err := OpenFileStore(dir, opts)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.Close()
+
+	got, ok := reopened.GetBoard(created.ID)
+	if !ok {
+		t.Fatalf("expected board to survive restart")
+	}
+	if got.Name != "Renamed" || len(got.CausalNodes) != 1 || len(got.Comments) != 1 {
+		t.Fatalf("unexpected board after replay: %+v", got)
+	}
+	if _, ok := reopened.GetBoard(doomed.ID); ok {
+		t.Fatalf("expected deleted board to stay deleted")
+	}
+}
+
+func TestFileStoreTruncatesTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir, FileStoreOptions{})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	created, _ := store.CreateBoard(models.Board{Name: "Kept"})
+	store.wal.Close()
+
+	wal, err := os.OpenFile(filepath.Join(dir, walFile), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("open wal: %v", err)
+	}
+	wal.WriteString(`{"seq":2,"op":"put","board":{"id":"x"`)
+	wal.Close()
+
+	reopened, err := OpenFileStore(dir, FileStoreOptions{})
+	if err != nil {
+		t.Fatalf("reopen with torn record: %v", err)
+	}
+	if _, ok := reopened.GetBoard(created.ID); !ok {
+		t.Fatalf("expected intact record to be replayed")
+	}
+	if _, err := reopened.CreateBoard(models.Board{Name: "After"}); err != nil {
+		t.Fatalf("append after truncation: %v", err)
+	}
+	reopened.Close()
+
+	final, err := OpenFileStore(dir, FileStoreOptions{})
+	if err != nil {
+		t.Fatalf("reopen after snapshot: %v", err)
+	}
+	defer final.Close()
+	if n := len(final.ListBoards()); n != 2 {
+		t.Fatalf("expected 2 boards from snapshot, got %d", n)
+	}
+}
+
+func TestImportLegacyFileConvertsWidgets(t *testing.T) {
+	dir := t.TempDir()
+	legacy := filepath.Join(dir, "legacy.json")
+	content := `{
+  "boards": {"b1": {"id": "b1", "name": "Retro", "widgetIds": ["w1", "w2", "w3"]}},
+  "widgets": {
+    "w1": {"id": "w1", "boardId": "b1", "kind": "note", "content": "Went well"},
+    "w2": {"id": "w2", "boardId": "b1", "kind": "text", "content": "Title"},
+    "w3": {"id": "w3", "boardId": "b1", "kind": "comment", "content": "+1"}
+  },
+  "sessions": {}
+}`
+	if err := os.WriteFile(legacy, []byte(content), 0o644); err != nil {
+		t.Fatalf("write legacy file: %v", err)
+	}
+
+	store := NewInMemoryStore()
+	n, err := ImportLegacyFile(legacy, store)
+	if err != nil || n != 1 {
+		t.Fatalf("expected one imported board, got %d (%v)", n, err)
+	}
+	board, ok := store.GetBoard("b1")
+	if !ok {
+		t.Fatalf("expected board to keep its legacy ID")
+	}
+	if len(board.Notes) != 1 || len(board.Texts) != 1 || len(board.Comments) != 1 {
+		t.Fatalf("unexpected conversion: %+v", board)
+	}
+
+	if n, _ := ImportLegacyFile(legacy, store); n != 0 {
+		t.Fatalf("expected re-import to skip existing boards, got %d", n)
+	}
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"test1/models"
+)
+
+// legacyData mirrors the JSON file written by the widget-based store this
+// package used to provide, before boards were stored as models.Board aggregates.
+type legacyData struct {
+	Boards  map[string]legacyBoard  `json:"boards"`
+	Widgets map[string]legacyWidget `json:"widgets"`
+}
+
+type legacyBoard struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	WidgetIDs []string  `json:"widgetIds"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type legacyWidget struct {
+	ID        string    `json:"id"`
+	BoardID   string    `json:"boardId"`
+	Kind      string    `json:"kind"`
+	Content   string    `json:"content"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// BoardPutter stores boards under the IDs they already carry.
+type BoardPutter interface {
+	GetBoard(id string) (models.Board, bool)
+	PutBoard(board models.Board) error
+}
+
+// ImportLegacyFile converts a legacy storage JSON file into models.Board aggregates
+// and writes them to dst, keeping the original board IDs. Boards that already exist
+// in dst are skipped, so running the import again is harmless. Legacy user sessions
+// are not imported. It returns the number of boards written.
+func ImportLegacyFile(path string, dst BoardPutter) (int, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("read legacy file: %w", err)
+	}
+
+	var data legacyData
+	if len(content) > 0 {
+		if err := json.Unmarshal(content, &data); err != nil {
+			return 0, fmt.Errorf("decode legacy file: %w", err)
+		}
+	}
+
+	ids := make([]string, 0, len(data.Boards))
+	for id := range data.Boards {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	imported := 0
+	for _, id := range ids {
+		if _, exists := dst.GetBoard(id); exists {
+			continue
+		}
+		board := convertLegacyBoard(data.Boards[id], data.Widgets)
+		if err := dst.PutBoard(board); err != nil {
+			return imported, fmt.Errorf("import board %s: %w", id, err)
+		}
+		imported++
+	}
+	return imported, nil
+}
+
+// convertLegacyBoard maps widgets onto board items by kind. Legacy widgets had no
+// geometry, so they are laid out on a grid in their original order.
+func convertLegacyBoard(src legacyBoard, widgets map[string]legacyWidget) models.Board {
+	const (
+		columns = 4
+		spacing = 240.0
+	)
+
+	board := models.Board{ID: src.ID, Name: src.Name, UpdatedAt: src.UpdatedAt, Revision: 1}
+	if board.Name == "" {
+		board.Name = "Untitled Board"
+	}
+
+	for i, widgetID := range src.WidgetIDs {
+		widget, ok := widgets[widgetID]
+		if !ok {
+			continue
+		}
+		pos := models.Point{X: float64(i%columns) * spacing, Y: float64(i/columns) * spacing}
+
+		switch strings.ToLower(widget.Kind) {
+		case "text":
+			board.Texts = append(board.Texts, models.TextItem{
+				ID: widget.ID, Content: widget.Content, Position: pos, Color: "#e5e7eb", FontSize: 18,
+			})
+		case "comment", "reaction":
+			board.Comments = append(board.Comments, models.Comment{
+				ID: widget.ID, Content: widget.Content, Position: pos, Type: strings.ToLower(widget.Kind),
+			})
+		default:
+			board.Notes = append(board.Notes, models.StickyNote{
+				ID: widget.ID, Content: widget.Content, Position: pos, Color: "#fcd34d", Width: 180, Height: 120,
+			})
+		}
+	}
+	return board
+}
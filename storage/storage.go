@@ -2,271 +2,170 @@ package storage
 
 import (
 	"crypto/rand"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
-	"os"
 	"sync"
 	"time"
+
+	"test1/models"
 )
 
-// Board represents a collaborative canvas that holds widgets.
-type Board struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	WidgetIDs []string  `json:"widgetIds"`
-	UpdatedAt time.Time `json:"updatedAt"`
+// InMemoryStore keeps boards in a map and is safe for concurrent use. Nothing
+// survives a restart; use FileStore for durable storage.
+type InMemoryStore struct {
+	mu     sync.RWMutex
+	boards boardSet
 }
 
-// Widget holds visual elements that live on a board.
-type Widget struct {
-	ID        string    `json:"id"`
-	BoardID   string    `json:"boardId"`
-	Kind      string    `json:"kind"`
-	Content   string    `json:"content"`
-	UpdatedAt time.Time `json:"updatedAt"`
+// NewInMemoryStore creates an empty store.
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{boards: make(boardSet)}
 }
 
-// UserSession links a user to a board and tracks their activity.
-type UserSession struct {
-	ID        string    `json:"id"`
-	User      string    `json:"user"`
-	BoardID   string    `json:"boardId"`
-	UpdatedAt time.Time `json:"updatedAt"`
+// ListBoards returns copies of all boards.
+func (s *InMemoryStore) ListBoards() []models.Board {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.boards.list()
 }
 
-// Mutation describes a change that should be broadcast to clients.
-type Mutation struct {
-	Type    string       `json:"type"`
-	Board   *Board       `json:"board,omitempty"`
-	Widget  *Widget      `json:"widget,omitempty"`
-	Session *UserSession `json:"session,omitempty"`
+// CreateBoard adds a new board with a generated ID.
+func (s *InMemoryStore) CreateBoard(board models.Board) (models.Board, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	board.ID = NewID()
+	board.UpdatedAt = time.Now().UTC()
+	board.Revision = 1
+	s.boards[board.ID] = board.Clone()
+	return board.Clone(), nil
 }
 
-// PersistentData captures the collections that are stored on disk.
-type PersistentData struct {
-	Boards   map[string]Board       `json:"boards"`
-	Widgets  map[string]Widget      `json:"widgets"`
-	Sessions map[string]UserSession `json:"sessions"`
+// GetBoard returns a board by ID.
+func (s *InMemoryStore) GetBoard(id string) (models.Board, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.boards.get(id)
 }
 
-// InMemoryStore wraps the collections with concurrency control and optional file persistence.
-type InMemoryStore struct {
-	mu   sync.RWMutex
-	path string
-	data PersistentData
+// HasBoard reports whether a board exists without copying it.
+func (s *InMemoryStore) HasBoard(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.boards[id]
+	return ok
 }
 
-// NewInMemoryStore creates a store and loads persisted state if available.
-func NewInMemoryStore(path string) (*InMemoryStore, error) {
-	s := &InMemoryStore{
-		path: path,
-		data: PersistentData{
-			Boards:   make(map[string]Board),
-			Widgets:  make(map[string]Widget),
-			Sessions: make(map[string]UserSession),
-		},
-	}
+// Lifecycle returns whether a board is archived or in the trash without copying it.
+func (s *InMemoryStore) Lifecycle(id string) (models.Lifecycle, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	board, ok := s.boards[id]
+	return board.Lifecycle, ok
+}
 
-	if path == "" {
-		return s, nil
-	}
+// UpdateBoard replaces the stored board when it exists. A non-zero expected
+// revision must match the stored one or a *ConflictError is returned.
+func (s *InMemoryStore) UpdateBoard(board models.Board, expected int64) (models.Board, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
-		return s, nil
+	current, ok := s.boards[board.ID]
+	if !ok {
+		return models.Board{}, ErrNotFound
 	}
-
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, fmt.Errorf("open storage file: %w", err)
+	if err := checkRevision(current, expected); err != nil {
+		return models.Board{}, err
 	}
-	defer file.Close()
+	board.UpdatedAt = time.Now().UTC()
+	board.Revision = current.Revision + 1
+	s.boards[board.ID] = board.Clone()
+	return board.Clone(), nil
+}
 
-	content, err := io.ReadAll(file)
-	if err != nil {
-		return nil, fmt.Errorf("read storage file: %w", err)
-	}
+// MutateBoard applies fn to a copy of the stored board and saves the result
+// unless fn returns an error. The read, change and write happen atomically.
+func (s *InMemoryStore) MutateBoard(id string, fn func(board *models.Board) error) (models.Board, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if len(content) == 0 {
-		return s, nil
+	board, ok := s.boards.get(id)
+	if !ok {
+		return models.Board{}, ErrNotFound
 	}
-
-	if err := json.Unmarshal(content, &s.data); err != nil {
-		return nil, fmt.Errorf("decode storage file: %w", err)
+	revision := board.Revision
+	if err := fn(&board); err != nil {
+		return models.Board{}, err
 	}
-
-	return s, nil
+	board.ID = id
+	board.UpdatedAt = time.Now().UTC()
+	board.Revision = revision + 1
+	s.boards[id] = board.Clone()
+	return board, nil
 }
 
-// WithTransaction locks the store for the duration of fn to provide atomic updates.
-func (s *InMemoryStore) WithTransaction(fn func(data *PersistentData) error) error {
+// DeleteBoard removes a board by ID, subject to the same revision check as UpdateBoard.
+func (s *InMemoryStore) DeleteBoard(id string, expected int64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if err := fn(&s.data); err != nil {
+	current, ok := s.boards[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := checkRevision(current, expected); err != nil {
 		return err
 	}
-
-	return s.persistLocked()
+	delete(s.boards, id)
+	return nil
 }
 
-// GetSnapshot returns a copy of the in-memory data for safe reads without external locking.
-func (s *InMemoryStore) GetSnapshot() PersistentData {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	boards := make(map[string]Board, len(s.data.Boards))
-	for k, v := range s.data.Boards {
-		boards[k] = v
-	}
-
-	widgets := make(map[string]Widget, len(s.data.Widgets))
-	for k, v := range s.data.Widgets {
-		widgets[k] = v
-	}
-
-	sessions := make(map[string]UserSession, len(s.data.Sessions))
-	for k, v := range s.data.Sessions {
-		sessions[k] = v
-	}
+// PutBoard stores a board under its existing ID, replacing any board with the same ID.
+func (s *InMemoryStore) PutBoard(board models.Board) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	return PersistentData{
-		Boards:   boards,
-		Widgets:  widgets,
-		Sessions: sessions,
-	}
+	s.boards[board.ID] = board.Clone()
+	return nil
 }
 
-// CreateBoard adds a new board and returns the mutation describing the change.
-func (s *InMemoryStore) CreateBoard(name string) (Board, Mutation, error) {
-	now := time.Now().UTC()
-	board := Board{
-		ID:        newID(),
-		Name:      name,
-		WidgetIDs: []string{},
-		UpdatedAt: now,
-	}
-
-	err := s.WithTransaction(func(data *PersistentData) error {
-		data.Boards[board.ID] = board
-		return nil
-	})
-
-	if err != nil {
-		return Board{}, Mutation{}, err
-	}
-
-	return board, Mutation{Type: "board_created", Board: &board}, nil
+// ConflictError reports a write made against a revision that is no longer current.
+type ConflictError struct {
+	Current int64
 }
 
-// AddWidget creates a widget on a board and returns the corresponding mutation.
-func (s *InMemoryStore) AddWidget(boardID, kind, content string) (Widget, Mutation, error) {
-	now := time.Now().UTC()
-	widget := Widget{
-		ID:        newID(),
-		BoardID:   boardID,
-		Kind:      kind,
-		Content:   content,
-		UpdatedAt: now,
-	}
-
-	err := s.WithTransaction(func(data *PersistentData) error {
-		board, ok := data.Boards[boardID]
-		if !ok {
-			return fmt.Errorf("board %s not found", boardID)
-		}
-
-		board.WidgetIDs = append(board.WidgetIDs, widget.ID)
-		board.UpdatedAt = now
-		data.Boards[boardID] = board
-		data.Widgets[widget.ID] = widget
-		return nil
-	})
-
-	if err != nil {
-		return Widget{}, Mutation{}, err
-	}
-
-	return widget, Mutation{Type: "widget_created", Board: nil, Widget: &widget}, nil
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("board revision conflict: current revision is %d", e.Current)
 }
 
-// UpdateWidget updates an existing widget and returns the mutation to broadcast.
-func (s *InMemoryStore) UpdateWidget(widgetID, newContent string) (Widget, Mutation, error) {
-	now := time.Now().UTC()
-	var updated Widget
-
-	err := s.WithTransaction(func(data *PersistentData) error {
-		widget, ok := data.Widgets[widgetID]
-		if !ok {
-			return fmt.Errorf("widget %s not found", widgetID)
-		}
-
-		widget.Content = newContent
-		widget.UpdatedAt = now
-		data.Widgets[widgetID] = widget
-		updated = widget
-
-		if board, ok := data.Boards[widget.BoardID]; ok {
-			board.UpdatedAt = now
-			data.Boards[widget.BoardID] = board
-		}
-		return nil
-	})
-
-	if err != nil {
-		return Widget{}, Mutation{}, err
+// checkRevision accepts any write when expected is zero.
+func checkRevision(current models.Board, expected int64) error {
+	if expected != 0 && current.Revision != expected {
+		return &ConflictError{Current: current.Revision}
 	}
-
-	return updated, Mutation{Type: "widget_updated", Widget: &updated}, nil
+	return nil
 }
 
-// UpsertSession records a user session for a board and returns the mutation describing the change.
-func (s *InMemoryStore) UpsertSession(user, boardID string) (UserSession, Mutation, error) {
-	now := time.Now().UTC()
-	session := UserSession{
-		ID:        newID(),
-		User:      user,
-		BoardID:   boardID,
-		UpdatedAt: now,
-	}
-
-	err := s.WithTransaction(func(data *PersistentData) error {
-		for id, existing := range data.Sessions {
-			if existing.User == user && existing.BoardID == boardID {
-				session.ID = id
-				break
-			}
-		}
-		data.Sessions[session.ID] = session
-		return nil
-	})
+// boardSet is the map shared by the store implementations; callers hold the lock.
+type boardSet map[string]models.Board
 
-	if err != nil {
-		return UserSession{}, Mutation{}, err
+func (set boardSet) list() []models.Board {
+	boards := make([]models.Board, 0, len(set))
+	for _, b := range set {
+		boards = append(boards, b.Clone())
 	}
-
-	return session, Mutation{Type: "session_upserted", Session: &session}, nil
+	return boards
 }
 
-func (s *InMemoryStore) persistLocked() error {
-	if s.path == "" {
-		return nil
-	}
-
-	encoded, err := json.MarshalIndent(s.data, "", "  ")
-	if err != nil {
-		return fmt.Errorf("marshal storage: %w", err)
+func (set boardSet) get(id string) (models.Board, bool) {
+	board, ok := set[id]
+	if !ok {
+		return models.Board{}, false
 	}
-
-	if err := os.WriteFile(s.path, encoded, 0o644); err != nil {
-		return fmt.Errorf("write storage: %w", err)
-	}
-
-	return nil
+	return board.Clone(), true
 }
 
-func newID() string {
+// NewID returns a random hex identifier for boards and board items.
+func NewID() string {
 	b := make([]byte, 12)
 	if _, err := rand.Read(b); err != nil {
 		return fmt.Sprintf("id_%d", time.Now().UnixNano())
@@ -0,0 +1,167 @@
+package transport
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSubject is the NATS subject board events are published on.
+const DefaultSubject = "boards.events"
+
+// NATS is a transport over a NATS server, speaking the core text protocol
+// directly (CONNECT, SUB, PUB, MSG, PING/PONG) so no client library is needed.
+type NATS struct {
+	node    string
+	subject string
+	handler handlerSlot
+	link    link
+}
+
+// DialNATS connects to the NATS server at addr ("host:4222") and subscribes to
+// subject, or DefaultSubject when empty. Like DialTCP it reconnects on failure.
+func DialNATS(addr, subject string, logger *log.Logger) (*NATS, error) {
+	if subject == "" {
+		subject = DefaultSubject
+	}
+	if strings.ContainsAny(subject, " \t\r\n*>") {
+		return nil, fmt.Errorf("invalid NATS subject %q", subject)
+	}
+	n := &NATS{node: newNodeID(), subject: subject}
+	n.link = link{
+		name:   "nats transport",
+		logger: logger,
+		dial:   func() (net.Conn, error) { return n.handshake(addr) },
+		serve:  func(conn net.Conn) error { return n.serve(conn.(*bufferedConn).reader) },
+	}
+	if err := n.link.start(); err != nil {
+		return nil, fmt.Errorf("dial nats: %w", err)
+	}
+	return n, nil
+}
+
+// bufferedConn keeps the reader used during the handshake, which may already
+// hold bytes sent after it.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// handshake reads the server INFO, identifies itself and subscribes. Echo is
+// disabled so the server does not return this node's own events.
+func (n *NATS) handshake(addr string) (*bufferedConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, writeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(writeTimeout))
+	reader := bufio.NewReader(conn)
+	line, err := readLine(reader)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected greeting %q", line)
+	}
+
+	options, _ := json.Marshal(map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"echo":     false,
+		"protocol": 1,
+		"name":     "boards-" + n.node,
+	})
+	hello := "CONNECT " + string(options) + "\r\nSUB " + n.subject + " 1\r\nPING\r\n"
+	if _, err := io.WriteString(conn, hello); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// The PONG confirms the server accepted CONNECT and SUB.
+	for {
+		line, err := readLine(reader)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if line == "PONG" {
+			break
+		}
+		if strings.HasPrefix(line, "-ERR") {
+			conn.Close()
+			return nil, errors.New(line)
+		}
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+func (n *NATS) Publish(boardID string, message []byte) error {
+	payload, err := encode(n.node, boardID, message)
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 0, len(payload)+len(n.subject)+32)
+	frame = append(frame, "PUB "...)
+	frame = append(frame, n.subject...)
+	frame = append(frame, ' ')
+	frame = strconv.AppendInt(frame, int64(len(payload)), 10)
+	frame = append(frame, "\r\n"...)
+	frame = append(frame, payload...)
+	frame = append(frame, "\r\n"...)
+	return n.link.write(frame)
+}
+
+func (n *NATS) Subscribe(h Handler) { n.handler.set(h) }
+
+func (n *NATS) Close() error { return n.link.close() }
+
+func (n *NATS) serve(reader *bufio.Reader) error {
+	for {
+		line, err := readLine(reader)
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PING":
+			if err := n.link.write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			fields := strings.Fields(line)
+			if len(fields) < 4 {
+				return fmt.Errorf("malformed %q", line)
+			}
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil || size < 0 || size > maxFrame {
+				return fmt.Errorf("malformed %q", line)
+			}
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return err
+			}
+			if env, ok := decode(n.node, payload[:size]); ok {
+				n.handler.deliver(env.Board, env.Data)
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			n.link.logf("nats: %s", line)
+		}
+	}
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,121 @@
+package transport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeNATS speaks just enough of the NATS protocol to route PUB to the other
+// connections' subscriptions, as a server does with echo disabled.
+type fakeNATS struct {
+	ln    net.Listener
+	mu    sync.Mutex
+	conns map[net.Conn]string // connection -> subscription id
+}
+
+func startFakeNATS(t *testing.T) *fakeNATS {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	f := &fakeNATS{ln: ln, conns: make(map[net.Conn]string)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	t.Cleanup(func() {
+		ln.Close()
+		f.mu.Lock()
+		for conn := range f.conns {
+			conn.Close()
+		}
+		f.mu.Unlock()
+	})
+	return f
+}
+
+func (f *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprint(conn, "INFO {\"server_id\":\"fake\",\"proto\":1}\r\n")
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := readLine(reader)
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "SUB":
+			f.mu.Lock()
+			f.conns[conn] = fields[2]
+			f.mu.Unlock()
+		case "PING":
+			fmt.Fprint(conn, "PING\r\n") // exercise the client's PONG reply
+			fmt.Fprint(conn, "PONG\r\n")
+		case "PUB":
+			size, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			f.mu.Lock()
+			for peer, sid := range f.conns {
+				if peer != conn {
+					fmt.Fprintf(peer, "MSG %s %s %d\r\n%s", fields[1], sid, size, payload)
+				}
+			}
+			f.mu.Unlock()
+		}
+	}
+}
+
+func TestNATSDeliversToOtherNodes(t *testing.T) {
+	server := startFakeNATS(t)
+
+	received := make(chan string, 4)
+	a, err := DialNATS(server.ln.Addr().String(), "", nil)
+	if err != nil {
+		t.Fatalf("dial a: %v", err)
+	}
+	defer a.Close()
+	a.Subscribe(func(boardID string, message []byte) { received <- "a:" + boardID + ":" + string(message) })
+
+	b, err := DialNATS(server.ln.Addr().String(), "", nil)
+	if err != nil {
+		t.Fatalf("dial b: %v", err)
+	}
+	defer b.Close()
+	b.Subscribe(func(boardID string, message []byte) { received <- "b:" + boardID + ":" + string(message) })
+
+	if err := a.Publish("board-1", []byte("hello\r\nMSG inside")); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	select {
+	case got := <-received:
+		if got != "b:board-1:hello\r\nMSG inside" {
+			t.Fatalf("unexpected delivery %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("b did not receive the event")
+	}
+	select {
+	case got := <-received:
+		t.Fatalf("unexpected extra delivery %q", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
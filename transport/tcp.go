@@ -0,0 +1,190 @@
+package transport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxFrame bounds a single relayed event.
+const maxFrame = 16 << 20
+
+// Relay is a minimal TCP event hub: every length-prefixed frame received from
+// one connection is copied to all the others. It is meant for loopback setups
+// and tests; production deployments would use a real message bus.
+type Relay struct {
+	ln     net.Listener
+	logger *log.Logger
+
+	mu     sync.Mutex
+	conns  map[net.Conn]*sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// ListenRelay starts a relay on addr, e.g. "127.0.0.1:0".
+func ListenRelay(addr string, logger *log.Logger) (*Relay, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen relay: %w", err)
+	}
+	r := &Relay{ln: ln, logger: logger, conns: make(map[net.Conn]*sync.Mutex)}
+	r.wg.Add(1)
+	go r.accept()
+	return r, nil
+}
+
+// Addr returns the address the relay listens on.
+func (r *Relay) Addr() string {
+	return r.ln.Addr().String()
+}
+
+// Close stops the relay and drops all connections.
+func (r *Relay) Close() error {
+	err := r.ln.Close()
+	r.mu.Lock()
+	r.closed = true
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+	return err
+}
+
+func (r *Relay) accept() {
+	defer r.wg.Done()
+	for {
+		conn, err := r.ln.Accept()
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			conn.Close()
+			return
+		}
+		r.conns[conn] = &sync.Mutex{}
+		r.mu.Unlock()
+		r.wg.Add(1)
+		go r.serve(conn)
+	}
+}
+
+func (r *Relay) serve(conn net.Conn) {
+	defer r.wg.Done()
+	defer func() {
+		r.mu.Lock()
+		delete(r.conns, conn)
+		r.mu.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		frame, err := readFrame(reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) && r.logger != nil {
+				r.logger.Printf("relay: %v", err)
+			}
+			return
+		}
+		r.mu.Lock()
+		peers := make(map[net.Conn]*sync.Mutex, len(r.conns))
+		for peer, mu := range r.conns {
+			if peer != conn {
+				peers[peer] = mu
+			}
+		}
+		r.mu.Unlock()
+		for peer, mu := range peers {
+			mu.Lock()
+			_ = peer.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if _, err := peer.Write(frame); err != nil {
+				peer.Close()
+			}
+			mu.Unlock()
+		}
+	}
+}
+
+// TCP is a transport client for a Relay.
+type TCP struct {
+	node    string
+	handler handlerSlot
+	link    link
+}
+
+// DialTCP connects to a relay. The connection is re-established automatically
+// if it drops; events published meanwhile fail with ErrDisconnected.
+func DialTCP(addr string, logger *log.Logger) (*TCP, error) {
+	t := &TCP{node: newNodeID()}
+	t.link = link{
+		name:   "tcp transport",
+		logger: logger,
+		dial: func() (net.Conn, error) {
+			return net.DialTimeout("tcp", addr, writeTimeout)
+		},
+		serve: t.serve,
+	}
+	if err := t.link.start(); err != nil {
+		return nil, fmt.Errorf("dial relay: %w", err)
+	}
+	return t, nil
+}
+
+func (t *TCP) Publish(boardID string, message []byte) error {
+	payload, err := encode(t.node, boardID, message)
+	if err != nil {
+		return err
+	}
+	return t.link.write(appendFrame(nil, payload))
+}
+
+func (t *TCP) Subscribe(h Handler) { t.handler.set(h) }
+
+func (t *TCP) Close() error { return t.link.close() }
+
+func (t *TCP) serve(conn net.Conn) error {
+	reader := bufio.NewReader(conn)
+	for {
+		frame, err := readFrame(reader)
+		if err != nil {
+			return err
+		}
+		if env, ok := decode(t.node, frame[4:]); ok {
+			t.handler.deliver(env.Board, env.Data)
+		}
+	}
+}
+
+// appendFrame appends payload with its 4-byte big-endian length prefix.
+func appendFrame(dst, payload []byte) []byte {
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(payload)))
+	return append(dst, payload...)
+}
+
+// readFrame reads one frame and returns it including its length prefix.
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(header[:])
+	if n > maxFrame {
+		return nil, fmt.Errorf("frame of %d bytes exceeds limit", n)
+	}
+	frame := make([]byte, 4+n)
+	copy(frame, header[:])
+	if _, err := io.ReadFull(r, frame[4:]); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
@@ -0,0 +1,229 @@
+// Package transport carries board events between server instances so that
+// participants connected to different replicas see each other's edits.
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"test1/storage"
+)
+
+// ErrDisconnected is returned by Publish while a networked transport is reconnecting.
+var ErrDisconnected = errors.New("transport disconnected")
+
+// Handler receives an event published by another node.
+type Handler func(boardID string, message []byte)
+
+// Transport fans board events out to the other nodes of a deployment. Events
+// published by a node are never handed back to that node's own handler.
+type Transport interface {
+	Publish(boardID string, message []byte) error
+	Subscribe(h Handler)
+	Close() error
+}
+
+// envelope is the wire form of an event; Node lets receivers drop their own echoes.
+type envelope struct {
+	Node  string `json:"node"`
+	Board string `json:"board"`
+	Data  []byte `json:"data"`
+}
+
+func encode(node, boardID string, message []byte) ([]byte, error) {
+	return json.Marshal(envelope{Node: node, Board: boardID, Data: message})
+}
+
+// decode parses an envelope, reporting false for malformed ones and echoes of node.
+func decode(node string, payload []byte) (envelope, bool) {
+	var env envelope
+	if err := json.Unmarshal(payload, &env); err != nil || env.Node == node {
+		return envelope{}, false
+	}
+	return env, true
+}
+
+// handlerSlot holds the subscribed handler of a transport.
+type handlerSlot struct {
+	mu sync.RWMutex
+	h  Handler
+}
+
+func (s *handlerSlot) set(h Handler) {
+	s.mu.Lock()
+	s.h = h
+	s.mu.Unlock()
+}
+
+func (s *handlerSlot) deliver(boardID string, message []byte) {
+	s.mu.RLock()
+	h := s.h
+	s.mu.RUnlock()
+	if h != nil {
+		h(boardID, message)
+	}
+}
+
+// Bus is an in-process transport: every node attached to it receives the events
+// published by the others. It suits single-binary deployments and tests.
+type Bus struct {
+	mu    sync.RWMutex
+	nodes map[*busNode]struct{}
+}
+
+// NewBus creates an empty in-process bus.
+func NewBus() *Bus {
+	return &Bus{nodes: make(map[*busNode]struct{})}
+}
+
+// Node attaches a new node to the bus.
+func (b *Bus) Node() Transport {
+	n := &busNode{bus: b}
+	b.mu.Lock()
+	b.nodes[n] = struct{}{}
+	b.mu.Unlock()
+	return n
+}
+
+type busNode struct {
+	bus     *Bus
+	handler handlerSlot
+}
+
+func (n *busNode) Publish(boardID string, message []byte) error {
+	n.bus.mu.RLock()
+	defer n.bus.mu.RUnlock()
+	if _, ok := n.bus.nodes[n]; !ok {
+		return ErrDisconnected
+	}
+	for other := range n.bus.nodes {
+		if other != n {
+			other.handler.deliver(boardID, message)
+		}
+	}
+	return nil
+}
+
+func (n *busNode) Subscribe(h Handler) { n.handler.set(h) }
+
+func (n *busNode) Close() error {
+	n.bus.mu.Lock()
+	delete(n.bus.nodes, n)
+	n.bus.mu.Unlock()
+	return nil
+}
+
+// link keeps a network connection open, redialling with backoff when it drops.
+// dial performs any protocol handshake; serve reads from the connection until it fails.
+type link struct {
+	name   string
+	logger *log.Logger
+	dial   func() (net.Conn, error)
+	serve  func(conn net.Conn) error
+
+	mu     sync.Mutex
+	conn   net.Conn
+	closed bool
+	done   chan struct{}
+}
+
+const (
+	writeTimeout = 5 * time.Second
+	maxBackoff   = 5 * time.Second
+)
+
+// start dials once, failing fast if the peer is unreachable, then keeps the link alive.
+func (l *link) start() error {
+	conn, err := l.dial()
+	if err != nil {
+		return err
+	}
+	l.done = make(chan struct{})
+	l.conn = conn
+	go l.run(conn)
+	return nil
+}
+
+func (l *link) run(conn net.Conn) {
+	defer close(l.done)
+	backoff := 100 * time.Millisecond
+	for {
+		err := l.serve(conn)
+		l.mu.Lock()
+		l.conn = nil
+		closed := l.closed
+		l.mu.Unlock()
+		conn.Close()
+		if closed {
+			return
+		}
+		l.logf("%s connection lost: %v", l.name, err)
+
+		for {
+			time.Sleep(backoff)
+			if backoff < maxBackoff {
+				backoff *= 2
+			}
+			l.mu.Lock()
+			closed = l.closed
+			l.mu.Unlock()
+			if closed {
+				return
+			}
+			if conn, err = l.dial(); err == nil {
+				break
+			}
+		}
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			conn.Close()
+			return
+		}
+		l.conn = conn
+		l.mu.Unlock()
+		backoff = 100 * time.Millisecond
+		l.logf("%s reconnected", l.name)
+	}
+}
+
+// write sends data on the current connection.
+func (l *link) write(data []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return ErrDisconnected
+	}
+	_ = l.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := l.conn.Write(data)
+	return err
+}
+
+func (l *link) close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	if l.conn != nil {
+		l.conn.Close()
+	}
+	l.mu.Unlock()
+	<-l.done
+	return nil
+}
+
+func (l *link) logf(format string, args ...interface{}) {
+	if l.logger != nil {
+		l.logger.Printf(format, args...)
+	}
+}
+
+func newNodeID() string {
+	return storage.NewID()
+}
@@ -0,0 +1,265 @@
+// Package undo keeps per-participant undo and redo stacks over recorded board
+// revisions and computes the selective inverse of one participant's change.
+package undo
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+
+	"test1/history"
+	"test1/models"
+)
+
+// Stacks tracks, per board and participant, which revisions can be undone or redone.
+type Stacks struct {
+	mu    sync.Mutex
+	limit int
+	undo  map[key][]int64
+	redo  map[key][]int64
+}
+
+type key struct {
+	board string
+	actor string
+}
+
+// NewStacks creates stacks that remember up to limit steps per participant and board.
+func NewStacks(limit int) *Stacks {
+	return &Stacks{limit: limit, undo: make(map[key][]int64), redo: make(map[key][]int64)}
+}
+
+// Record registers a new change by actor; like any editor, a fresh change clears the redo stack.
+func (s *Stacks) Record(boardID, actor string, revision int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := key{boardID, actor}
+	s.undo[k] = s.push(s.undo[k], revision)
+	delete(s.redo, k)
+}
+
+// PopUndo removes and returns the actor's most recent undoable revision.
+func (s *Stacks) PopUndo(boardID, actor string) (int64, bool) {
+	return s.pop(s.undo, key{boardID, actor})
+}
+
+// PopRedo removes and returns the revision produced by the actor's most recent undo.
+func (s *Stacks) PopRedo(boardID, actor string) (int64, bool) {
+	return s.pop(s.redo, key{boardID, actor})
+}
+
+// PushUndo makes revision undoable without clearing the redo stack (used by redo).
+func (s *Stacks) PushUndo(boardID, actor string, revision int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := key{boardID, actor}
+	s.undo[k] = s.push(s.undo[k], revision)
+}
+
+// PushRedo makes the revision produced by an undo redoable.
+func (s *Stacks) PushRedo(boardID, actor string, revision int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := key{boardID, actor}
+	s.redo[k] = s.push(s.redo[k], revision)
+}
+
+// Forget drops all stacks for a board.
+func (s *Stacks) Forget(boardID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k := range s.undo {
+		if k.board == boardID {
+			delete(s.undo, k)
+		}
+	}
+	for k := range s.redo {
+		if k.board == boardID {
+			delete(s.redo, k)
+		}
+	}
+}
+
+func (s *Stacks) push(stack []int64, revision int64) []int64 {
+	stack = append(stack, revision)
+	if s.limit > 0 && len(stack) > s.limit {
+		stack = append([]int64(nil), stack[len(stack)-s.limit:]...)
+	}
+	return stack
+}
+
+func (s *Stacks) pop(stacks map[key][]int64, k key) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stack := stacks[k]
+	if len(stack) == 0 {
+		return 0, false
+	}
+	revision := stack[len(stack)-1]
+	stacks[k] = stack[:len(stack)-1]
+	return revision, true
+}
+
+// Revert undoes the change that turned before into after on top of current, touching
+// only what that change touched: items it added are removed, items it removed come
+// back, and for items it modified only the fields it changed are reset. Edits made by
+// others to other items or fields are kept. The board's name and propagation mode
+// go back unless they have changed again since. changed is false when nothing was
+// left to revert, for example because someone already deleted the item.
+func Revert(before, after, current models.Board) (result models.Board, changed bool, err error) {
+	b, err := toFields(before)
+	if err != nil {
+		return models.Board{}, false, err
+	}
+	a, err := toFields(after)
+	if err != nil {
+		return models.Board{}, false, err
+	}
+	c, err := toFields(current)
+	if err != nil {
+		return models.Board{}, false, err
+	}
+
+	for _, field := range []string{"name", "propagation"} {
+		if !bytes.Equal(b[field], a[field]) && bytes.Equal(c[field], a[field]) {
+			c[field] = b[field]
+			changed = true
+		}
+	}
+
+	for _, name := range history.Collections {
+		beforeItems, err := toItems(b[name])
+		if err != nil {
+			return models.Board{}, false, err
+		}
+		afterItems, err := toItems(a[name])
+		if err != nil {
+			return models.Board{}, false, err
+		}
+		currentItems, err := toItems(c[name])
+		if err != nil {
+			return models.Board{}, false, err
+		}
+
+		reverted, collChanged := revertItems(beforeItems, afterItems, currentItems)
+		if collChanged {
+			encoded, err := json.Marshal(reverted)
+			if err != nil {
+				return models.Board{}, false, err
+			}
+			c[name] = encoded
+			changed = true
+		}
+	}
+	if !changed {
+		return current, false, nil
+	}
+
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		return models.Board{}, false, err
+	}
+	if err := json.Unmarshal(encoded, &result); err != nil {
+		return models.Board{}, false, err
+	}
+	dropDanglingLinks(&result)
+	return result, true, nil
+}
+
+type item = map[string]json.RawMessage
+
+func revertItems(before, after, current []item) ([]item, bool) {
+	beforeByID := index(before)
+	afterByID := index(after)
+	changed := false
+
+	out := make([]item, 0, len(current))
+	for _, cur := range current {
+		id := itemID(cur)
+		old, existed := beforeByID[id]
+		newer, exists := afterByID[id]
+		switch {
+		case !existed && exists:
+			// Added by the change being undone.
+			changed = true
+			continue
+		case existed && exists:
+			for field, oldValue := range old {
+				if !bytes.Equal(oldValue, newer[field]) && bytes.Equal(cur[field], newer[field]) {
+					cur[field] = oldValue
+					changed = true
+				}
+			}
+			for field := range newer {
+				if _, had := old[field]; !had {
+					delete(cur, field)
+					changed = true
+				}
+			}
+		}
+		out = append(out, cur)
+	}
+
+	present := index(current)
+	for _, old := range before {
+		id := itemID(old)
+		if _, stillThere := afterByID[id]; stillThere {
+			continue
+		}
+		if _, back := present[id]; back {
+			continue
+		}
+		// Removed by the change being undone.
+		out = append(out, old)
+		changed = true
+	}
+	return out, changed
+}
+
+// dropDanglingLinks removes causal links whose endpoints no longer exist after a revert.
+func dropDanglingLinks(board *models.Board) {
+	nodes := make(map[string]bool, len(board.CausalNodes))
+	for _, n := range board.CausalNodes {
+		nodes[n.ID] = true
+	}
+	kept := board.CausalLinks[:0]
+	for _, l := range board.CausalLinks {
+		if nodes[l.From] && nodes[l.To] {
+			kept = append(kept, l)
+		}
+	}
+	board.CausalLinks = kept
+}
+
+func toFields(board models.Board) (map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(board)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(encoded, &fields)
+	return fields, err
+}
+
+func toItems(raw json.RawMessage) ([]item, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var items []item
+	err := json.Unmarshal(raw, &items)
+	return items, err
+}
+
+func index(items []item) map[string]item {
+	out := make(map[string]item, len(items))
+	for _, it := range items {
+		out[itemID(it)] = it
+	}
+	return out
+}
+
+func itemID(it item) string {
+	var id string
+	_ = json.Unmarshal(it["id"], &id)
+	return id
+}
@@ -0,0 +1,75 @@
+package undo
+
+import (
+	"testing"
+
+	"test1/models"
+)
+
+func TestRevertKeepsOtherParticipantsEdits(t *testing.T) {
+	before := models.Board{ID: "b", Name: "Plan",
+		Notes: []models.StickyNote{{ID: "n1", Content: "a", Color: "yellow"}, {ID: "n2", Content: "b"}}}
+	// Alice recolors n1 and deletes n2.
+	after := before.Clone()
+	after.Notes = []models.StickyNote{{ID: "n1", Content: "a", Color: "red"}}
+	// Bob then edits n1's text and adds n3.
+	current := after.Clone()
+	current.Notes = []models.StickyNote{{ID: "n1", Content: "bob", Color: "red"}, {ID: "n3"}}
+
+	reverted, changed, err := Revert(before, after, current)
+	if err != nil || !changed {
+		t.Fatalf("expected a revert, got changed=%v err=%v", changed, err)
+	}
+	if len(reverted.Notes) != 3 {
+		t.Fatalf("expected n1, n3 and restored n2, got %+v", reverted.Notes)
+	}
+	n1 := reverted.Notes[0]
+	if n1.Color != "yellow" || n1.Content != "bob" {
+		t.Fatalf("expected color reverted and bob's text kept, got %+v", n1)
+	}
+	if reverted.Notes[1].ID != "n3" || reverted.Notes[2].ID != "n2" {
+		t.Fatalf("unexpected notes %+v", reverted.Notes)
+	}
+
+	if _, changed, _ := Revert(before, after, reverted); changed {
+		t.Fatal("expected a second revert of the same step to be a no-op")
+	}
+}
+
+func TestRevertResetsThePropagationMode(t *testing.T) {
+	before := models.Board{ID: "b", Name: "Plan"}
+	after := before.Clone()
+	after.Propagation = "confidence"
+
+	reverted, changed, err := Revert(before, after, after)
+	if err != nil || !changed || reverted.Propagation != "" {
+		t.Fatalf("expected the default mode back, got %q changed=%v err=%v", reverted.Propagation, changed, err)
+	}
+	undone := models.Board{ID: "b", Name: "Plan", Propagation: "noisy-or"}
+	if _, changed, _ := Revert(before, after, undone); changed {
+		t.Fatal("expected a mode changed again since to be kept")
+	}
+}
+
+func TestStacksRedoClearedByNewChange(t *testing.T) {
+	s := NewStacks(2)
+	s.Record("b", "alice", 1)
+	s.Record("b", "alice", 2)
+	s.Record("b", "alice", 3)
+	if rev, _ := s.PopUndo("b", "alice"); rev != 3 {
+		t.Fatalf("expected revision 3, got %d", rev)
+	}
+	s.PushRedo("b", "alice", 4)
+	if _, ok := s.PopUndo("b", "bob"); ok {
+		t.Fatal("bob must not see alice's steps")
+	}
+	s.Record("b", "alice", 5)
+	if _, ok := s.PopRedo("b", "alice"); ok {
+		t.Fatal("expected redo to be cleared by a new change")
+	}
+	s.PopUndo("b", "alice")
+	s.PopUndo("b", "alice")
+	if _, ok := s.PopUndo("b", "alice"); ok {
+		t.Fatal("expected the depth limit to drop revision 1")
+	}
+}
@@ -0,0 +1,443 @@
+// Package workspace organises boards for teams. A workspace has members with
+// a role that applies to every board in it, and folders its boards can be
+// filed in. Boards outside any workspace are personal and governed by their
+// own access list only.
+package workspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"test1/access"
+	"test1/storage"
+)
+
+var (
+	// ErrNotFound is returned for unknown workspaces, folders and members.
+	ErrNotFound = errors.New("not found")
+	// ErrNotEmpty is returned when deleting a workspace that still has boards.
+	ErrNotEmpty = errors.New("the workspace still has boards, counting those in the trash; move them out or purge them first")
+	// ErrNameRequired is returned for workspaces and folders without a name.
+	ErrNameRequired = errors.New("name is required")
+)
+
+// Workspace is a team's space for boards.
+type Workspace struct {
+	ID        string                 `json:"id"`
+	Name      string                 `json:"name"`
+	CreatedAt time.Time              `json:"createdAt"`
+	Members   map[string]access.Role `json:"members"`
+}
+
+// Folder groups boards within a workspace.
+type Folder struct {
+	ID          string    `json:"id"`
+	WorkspaceID string    `json:"workspaceId"`
+	Name        string    `json:"name"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Placement is where a board is filed. The zero value is a personal board.
+type Placement struct {
+	WorkspaceID string `json:"workspaceId,omitempty"`
+	FolderID    string `json:"folderId,omitempty"`
+}
+
+type state struct {
+	Workspaces map[string]*Workspace `json:"workspaces"`
+	Folders    map[string]*Folder    `json:"folders"`
+	Boards     map[string]Placement  `json:"boards"`
+}
+
+// Store keeps workspaces, folders and board placements in memory and, when
+// given a path, in a JSON file rewritten on every change.
+type Store struct {
+	mu   sync.RWMutex
+	path string
+	now  func() time.Time
+	st   state
+}
+
+// NewStore loads the store from path when it exists. An empty path keeps everything in memory.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, now: time.Now, st: state{
+		Workspaces: make(map[string]*Workspace),
+		Folders:    make(map[string]*Folder),
+		Boards:     make(map[string]Placement),
+	}}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read workspaces: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.st); err != nil {
+		return nil, fmt.Errorf("decode workspaces: %w", err)
+	}
+	return s, nil
+}
+
+// Create makes a workspace owned by owner.
+func (s *Store) Create(name, owner string) (Workspace, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Workspace{}, ErrNameRequired
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ws := &Workspace{ID: storage.NewID(), Name: name, CreatedAt: s.now().UTC(), Members: map[string]access.Role{owner: access.Owner}}
+	s.st.Workspaces[ws.ID] = ws
+	if err := s.saveLocked(); err != nil {
+		delete(s.st.Workspaces, ws.ID)
+		return Workspace{}, err
+	}
+	return ws.clone(), nil
+}
+
+// Get returns a workspace.
+func (s *Store) Get(id string) (Workspace, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ws, ok := s.st.Workspaces[id]
+	if !ok {
+		return Workspace{}, false
+	}
+	return ws.clone(), true
+}
+
+// List returns the workspaces principal is a member of, by name.
+func (s *Store) List(principal string) []Workspace {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := []Workspace{}
+	for _, ws := range s.st.Workspaces {
+		if _, ok := ws.Members[principal]; ok && principal != "" {
+			list = append(list, ws.clone())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if a, b := strings.ToLower(list[i].Name), strings.ToLower(list[j].Name); a != b {
+			return a < b
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Role returns principal's role in the workspace.
+func (s *Store) Role(id, principal string) access.Role {
+	if principal == "" {
+		return access.None
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if ws, ok := s.st.Workspaces[id]; ok {
+		return ws.Members[principal]
+	}
+	return access.None
+}
+
+// Rename changes a workspace's name.
+func (s *Store) Rename(id, name string) (Workspace, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Workspace{}, ErrNameRequired
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ws, ok := s.st.Workspaces[id]
+	if !ok {
+		return Workspace{}, ErrNotFound
+	}
+	previous := ws.Name
+	ws.Name = name
+	if err := s.saveLocked(); err != nil {
+		ws.Name = previous
+		return Workspace{}, err
+	}
+	return ws.clone(), nil
+}
+
+// Delete removes an empty workspace and its folders.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ws, ok := s.st.Workspaces[id]
+	if !ok {
+		return ErrNotFound
+	}
+	for _, p := range s.st.Boards {
+		if p.WorkspaceID == id {
+			return ErrNotEmpty
+		}
+	}
+	folders := make(map[string]*Folder)
+	for fid, f := range s.st.Folders {
+		if f.WorkspaceID == id {
+			folders[fid] = f
+			delete(s.st.Folders, fid)
+		}
+	}
+	delete(s.st.Workspaces, id)
+	if err := s.saveLocked(); err != nil {
+		s.st.Workspaces[id] = ws
+		for fid, f := range folders {
+			s.st.Folders[fid] = f
+		}
+		return err
+	}
+	return nil
+}
+
+// SetMember gives principal a role in the workspace. The last owner cannot be demoted.
+func (s *Store) SetMember(id, principal string, role access.Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ws, ok := s.st.Workspaces[id]
+	if !ok {
+		return ErrNotFound
+	}
+	previous, had := ws.Members[principal]
+	if previous == access.Owner && role != access.Owner && owners(ws) == 1 {
+		return access.ErrLastOwner
+	}
+	ws.Members[principal] = role
+	if err := s.saveLocked(); err != nil {
+		if had {
+			ws.Members[principal] = previous
+		} else {
+			delete(ws.Members, principal)
+		}
+		return err
+	}
+	return nil
+}
+
+// RemoveMember takes principal out of the workspace.
+func (s *Store) RemoveMember(id, principal string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ws, ok := s.st.Workspaces[id]
+	if !ok {
+		return ErrNotFound
+	}
+	role, ok := ws.Members[principal]
+	if !ok {
+		return ErrNotFound
+	}
+	if role == access.Owner && owners(ws) == 1 {
+		return access.ErrLastOwner
+	}
+	delete(ws.Members, principal)
+	if err := s.saveLocked(); err != nil {
+		ws.Members[principal] = role
+		return err
+	}
+	return nil
+}
+
+// CreateFolder adds a folder to the workspace.
+func (s *Store) CreateFolder(workspaceID, name string) (Folder, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Folder{}, ErrNameRequired
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.st.Workspaces[workspaceID]; !ok {
+		return Folder{}, ErrNotFound
+	}
+	f := &Folder{ID: storage.NewID(), WorkspaceID: workspaceID, Name: name, CreatedAt: s.now().UTC()}
+	s.st.Folders[f.ID] = f
+	if err := s.saveLocked(); err != nil {
+		delete(s.st.Folders, f.ID)
+		return Folder{}, err
+	}
+	return *f, nil
+}
+
+// Folders lists the workspace's folders by name.
+func (s *Store) Folders(workspaceID string) []Folder {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	folders := []Folder{}
+	for _, f := range s.st.Folders {
+		if f.WorkspaceID == workspaceID {
+			folders = append(folders, *f)
+		}
+	}
+	sort.Slice(folders, func(i, j int) bool {
+		if a, b := strings.ToLower(folders[i].Name), strings.ToLower(folders[j].Name); a != b {
+			return a < b
+		}
+		return folders[i].ID < folders[j].ID
+	})
+	return folders
+}
+
+// Folder returns one of the workspace's folders.
+func (s *Store) Folder(workspaceID, folderID string) (Folder, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, ok := s.st.Folders[folderID]
+	if !ok || f.WorkspaceID != workspaceID {
+		return Folder{}, false
+	}
+	return *f, true
+}
+
+// RenameFolder changes a folder's name.
+func (s *Store) RenameFolder(workspaceID, folderID, name string) (Folder, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Folder{}, ErrNameRequired
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.st.Folders[folderID]
+	if !ok || f.WorkspaceID != workspaceID {
+		return Folder{}, ErrNotFound
+	}
+	previous := f.Name
+	f.Name = name
+	if err := s.saveLocked(); err != nil {
+		f.Name = previous
+		return Folder{}, err
+	}
+	return *f, nil
+}
+
+// DeleteFolder removes a folder; its boards move to the top of the workspace.
+func (s *Store) DeleteFolder(workspaceID, folderID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.st.Folders[folderID]
+	if !ok || f.WorkspaceID != workspaceID {
+		return ErrNotFound
+	}
+	moved := []string{}
+	for boardID, p := range s.st.Boards {
+		if p.FolderID == folderID {
+			s.st.Boards[boardID] = Placement{WorkspaceID: workspaceID}
+			moved = append(moved, boardID)
+		}
+	}
+	delete(s.st.Folders, folderID)
+	if err := s.saveLocked(); err != nil {
+		s.st.Folders[folderID] = f
+		for _, boardID := range moved {
+			s.st.Boards[boardID] = Placement{WorkspaceID: workspaceID, FolderID: folderID}
+		}
+		return err
+	}
+	return nil
+}
+
+// Place files a board. A zero Placement makes it a personal board again.
+func (s *Store) Place(boardID string, p Placement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p.WorkspaceID == "" && p.FolderID != "" {
+		return ErrNotFound
+	}
+	if p.WorkspaceID != "" {
+		if _, ok := s.st.Workspaces[p.WorkspaceID]; !ok {
+			return ErrNotFound
+		}
+	}
+	if p.FolderID != "" {
+		if f, ok := s.st.Folders[p.FolderID]; !ok || f.WorkspaceID != p.WorkspaceID {
+			return ErrNotFound
+		}
+	}
+	previous, had := s.st.Boards[boardID]
+	if p == (Placement{}) {
+		delete(s.st.Boards, boardID)
+	} else {
+		s.st.Boards[boardID] = p
+	}
+	if err := s.saveLocked(); err != nil {
+		if had {
+			s.st.Boards[boardID] = previous
+		} else {
+			delete(s.st.Boards, boardID)
+		}
+		return err
+	}
+	return nil
+}
+
+// Placement returns where a board is filed.
+func (s *Store) Placement(boardID string) Placement {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.st.Boards[boardID]
+}
+
+// Boards lists the boards filed in the workspace.
+func (s *Store) Boards(workspaceID string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := []string{}
+	for boardID, p := range s.st.Boards {
+		if p.WorkspaceID == workspaceID {
+			ids = append(ids, boardID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Forget drops the placement of a deleted board.
+func (s *Store) Forget(boardID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.st.Boards[boardID]; !ok {
+		return nil
+	}
+	delete(s.st.Boards, boardID)
+	return s.saveLocked()
+}
+
+func (ws *Workspace) clone() Workspace {
+	c := *ws
+	c.Members = make(map[string]access.Role, len(ws.Members))
+	for k, v := range ws.Members {
+		c.Members[k] = v
+	}
+	return c
+}
+
+func owners(ws *Workspace) int {
+	n := 0
+	for _, role := range ws.Members {
+		if role == access.Owner {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Store) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode workspaces: %w", err)
+	}
+	if err := storage.WriteFileAtomic(s.path, data, 0o600); err != nil {
+		return fmt.Errorf("write workspaces: %w", err)
+	}
+	return nil
+}
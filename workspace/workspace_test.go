@@ -0,0 +1,67 @@
+package workspace
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"test1/access"
+)
+
+func TestWorkspacesFoldersAndPlacement(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "workspaces.json")
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, err := s.Create("Design", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetMember(ws.ID, "bob", access.Editor); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetMember(ws.ID, "alice", access.Viewer); !errors.Is(err, access.ErrLastOwner) {
+		t.Fatalf("expected the last owner to stay, got %v", err)
+	}
+	folder, err := s.CreateFolder(ws.ID, "Roadmaps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Place("b1", Placement{WorkspaceID: ws.ID, FolderID: folder.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Place("b2", Placement{WorkspaceID: "elsewhere", FolderID: folder.ID}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected a folder of another workspace to be refused, got %v", err)
+	}
+
+	// Everything survives a restart.
+	if s, err = NewStore(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Role(ws.ID, "bob"); got != access.Editor {
+		t.Fatalf("expected bob to be an editor, got %q", got)
+	}
+	if list := s.List("bob"); len(list) != 1 || list[0].Name != "Design" {
+		t.Fatalf("expected bob to see the workspace, got %+v", list)
+	}
+	if list := s.List("carol"); len(list) != 0 {
+		t.Fatalf("expected carol to see nothing, got %+v", list)
+	}
+
+	if err := s.Delete(ws.ID); !errors.Is(err, ErrNotEmpty) {
+		t.Fatalf("expected a workspace with boards not to be deletable, got %v", err)
+	}
+	if err := s.DeleteFolder(ws.ID, folder.ID); err != nil {
+		t.Fatal(err)
+	}
+	if p := s.Placement("b1"); p != (Placement{WorkspaceID: ws.ID}) {
+		t.Fatalf("expected the board to move to the top of the workspace, got %+v", p)
+	}
+	if err := s.Place("b1", Placement{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ws.ID); err != nil {
+		t.Fatalf("expected the empty workspace to be deletable: %v", err)
+	}
+}